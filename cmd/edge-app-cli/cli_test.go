@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/record"
+	"github.com/qingcloud-iot/edge-app-go/testhub"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 3 * time.Second
+
+//并发安全的输出缓存，watch命令在回调中输出
+type syncBuffer struct {
+	lock 	sync.Mutex
+	buf 	bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestParseArgs(t *testing.T) {
+	assert := assert.New(t)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	params := fs.String("params", "", "")
+	positional, err := parseArgs(fs, []string{"iott-001", "-params", `{"a":1}`, "iotd-001", "open"})
+	if assert.Nil(err) {
+		assert.Equal([]string{"iott-001", "iotd-001", "open"}, positional)
+		assert.Equal(`{"a":1}`, *params)
+	}
+	_, err = parseArgs(fs, []string{"-unknown"})
+	assert.True(errors.Is(err, errUsage))
+
+	values, keys, err := parseValues([]string{"temp=25.5", "name=pump", "on=true", "cfg={\"a\":1}", "temp=26"})
+	if assert.Nil(err) {
+		assert.Equal([]string{"temp", "name", "on", "cfg"}, keys)
+		assert.Equal(26.0, values["temp"])
+		assert.Equal("pump", values["name"])
+		assert.Equal(true, values["on"])
+		assert.Equal(map[string]interface{}{"a": 1.0}, values["cfg"])
+	}
+	_, _, err = parseValues([]string{"=1"})
+	assert.True(errors.Is(err, errUsage))
+
+	merged, err := mergeParams(`{"a":1,"b":2}`, []string{"b=3"})
+	if assert.Nil(err) {
+		assert.Equal(map[string]interface{}{"a": 1.0, "b": 3.0}, merged)
+	}
+}
+
+func TestWatchFilter(t *testing.T) {
+	assert := assert.New(t)
+	rec := &watchRecord{
+		Type: "service_call",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+		Payload: json.RawMessage(`{"identifier":"open"}`),
+	}
+	assert.True((&watchFilter{types: map[string]bool{"service": true}}).match(rec))
+	assert.False((&watchFilter{types: map[string]bool{"property": true}}).match(rec))
+	assert.True((&watchFilter{deviceId: "iotd-001", identifier: "open"}).match(rec))
+	assert.False((&watchFilter{identifier: "close"}).match(rec))
+	rec = &watchRecord{
+		Type: "property",
+		Payload: json.RawMessage(`[{"identifier":"temp"},{"identifier":"humi"}]`),
+	}
+	assert.True((&watchFilter{identifier: "humi"}).match(rec))
+	assert.False((&watchFilter{types: map[string]bool{"property_set": true}}).match(rec))
+}
+
+func TestCli(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := testhub.NewHub(&testhub.Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) || !assert.Nil(hub.Setenv()) {
+		return
+	}
+	defer hub.Close()
+
+	//info
+	out := &syncBuffer{}
+	assert.Nil(newCli(out, waitTimeout).run([]string{"info"}))
+	info := make(map[string]interface{})
+	if assert.Nil(json.Unmarshal([]byte(out.String()), &info)) {
+		assert.Equal("iotd-001", info["deviceId"])
+		assert.Equal(false, info["proxyMode"])
+	}
+
+	//props post
+	out = &syncBuffer{}
+	assert.Nil(newCli(out, waitTimeout).run([]string{"props", "post", "temp=25", "mode=auto"}))
+	props, err := hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout).Properties()
+	if assert.Nil(err) && assert.Len(props, 2) {
+		values := make(map[string]interface{})
+		for _, prop := range props {
+			values[prop.Identifier] = prop.Value
+		}
+		assert.EqualValues(25, values["temp"])
+		assert.Equal("auto", values["mode"])
+	}
+
+	//event post
+	assert.Nil(newCli(out, waitTimeout).run([]string{"event", "post", "alarm", "-level", "warn", "code=3"}))
+	evt, err := hub.RequirePublished(t, common.AppSdkMessageType_Event, waitTimeout).Event()
+	if assert.Nil(err) {
+		assert.Equal("alarm", evt.Identifier)
+		assert.Equal(common.EventLevel_Warn, evt.Level)
+		assert.EqualValues(3, evt.Params["code"])
+	}
+
+	//endpoints list
+	hub.SetEndpoints(&common.EndpointInfo{ThingId: "iott-sub", DeviceId: "iotd-sub", DeviceName: "pump"})
+	out = &syncBuffer{}
+	assert.Nil(newCli(out, waitTimeout).run([]string{"endpoints", "list"}))
+	assert.Contains(out.String(), "iotd-sub")
+	assert.Contains(out.String(), "pump")
+
+	//service call
+	hub.OnEndpointCall(func(thingId string, deviceId string, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply {
+		return &common.AppSdkMsgServiceReply{Code: 200, Params: call.Params}
+	})
+	out = &syncBuffer{}
+	assert.Nil(newCli(out, waitTimeout).run([]string{"service", "call", "iott-sub", "iotd-sub", "open", "-params", `{"speed":2}`}))
+	reply := &common.AppSdkMsgServiceReply{}
+	if assert.Nil(json.Unmarshal([]byte(out.String()), reply)) {
+		assert.EqualValues(200, reply.Code)
+		assert.EqualValues(2, reply.Params["speed"])
+	}
+
+	assert.Equal(errUsage, newCli(out, waitTimeout).run([]string{"props", "get"}))
+}
+
+func TestCli_Watch(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := testhub.NewHub(&testhub.Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) || !assert.Nil(hub.Setenv()) {
+		return
+	}
+	defer hub.Close()
+	out := &syncBuffer{}
+	c := newCli(out, waitTimeout)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.run([]string{"watch", "-thing", "iott-sub", "-json"})
+	}()
+	propTopic, _ := hub.Topic(codec.TopicType_SubProperty, "", "iott-sub", "+")
+	callTopic, _ := hub.Topic(codec.TopicType_SubService, "+", "iott-sub", "+")
+	if !assert.Nil(hub.WaitSubscribed(propTopic, waitTimeout)) || !assert.Nil(hub.WaitSubscribed(callTopic, waitTimeout)) {
+		return
+	}
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 20}))
+	assert.Nil(hub.InjectProperties("iott-other", "iotd-other", &common.AppSdkMsgProperty{Identifier: "temp", Value: 30}))
+	//其他应用调用子设备服务
+	call, _ := json.Marshal(&common.AppSdkMsgServiceCall{MessageId: "msg-001", Identifier: "open"})
+	topic, payload, err := codec.NewCodec("app-002", "iotd-002", "iott-002", false).EncodeMessage(codec.TopicType_PubService, "iott-sub", "iotd-sub", call)
+	if assert.Nil(err) {
+		hub.InjectRaw(topic, payload, false)
+	}
+	deadline := time.Now().Add(waitTimeout)
+	for strings.Count(out.String(), "\n") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(c.stop)
+	assert.Nil(<-errCh)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(lines, 2) {
+		return
+	}
+	types := make([]string, 0)
+	for _, line := range lines {
+		rec := &watchRecord{}
+		if assert.Nil(json.Unmarshal([]byte(line), rec)) {
+			assert.Equal("iotd-sub", rec.DeviceId)
+			types = append(types, rec.Type)
+		}
+	}
+	assert.ElementsMatch([]string{"property", "service_call"}, types)
+}
+
+func TestCli_Replay(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := testhub.NewHub(&testhub.Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) || !assert.Nil(hub.Setenv()) {
+		return
+	}
+	defer hub.Close()
+	dir, err := ioutil.TempDir("", "replay")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traffic.jsonl")
+	recorder, err := record.CreateRecorder(path)
+	if !assert.Nil(err) {
+		return
+	}
+	props, _ := json.Marshal([]*common.AppSdkMsgProperty{{Identifier: "temp", Value: 20}})
+	topic, payload, err := codec.NewCodec("app-002", "iotd-002", "iott-002", false).EncodeMessage(codec.TopicType_PubProperty, "iott-sub", "iotd-sub", props)
+	if !assert.Nil(err) {
+		return
+	}
+	now := time.Now()
+	assert.Nil(recorder.Record(&record.Record{Time: now, Direction: record.Direction_In, Topic: topic, Raw: payload}))
+	assert.Nil(recorder.Record(&record.Record{Time: now.Add(time.Second), Direction: record.Direction_Out, Topic: "ignored", Raw: payload}))
+	assert.Nil(recorder.Close())
+
+	out := &syncBuffer{}
+	assert.Nil(newCli(out, waitTimeout).run([]string{"replay", path, "-speed", "100"}))
+	assert.Equal("replayed 1 messages\n", out.String())
+	msg := hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout)
+	assert.Equal(topic, msg.Topic)
+}
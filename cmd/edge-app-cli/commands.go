@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/config"
+	"github.com/qingcloud-iot/edge-app-go/record"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//命令参数错误，输出用法
+var errUsage = errors.New("invalid usage")
+
+type cli struct {
+	out 		io.Writer
+	timeout 	time.Duration
+	//关闭时结束watch命令
+	stop 		chan struct{}
+}
+
+func newCli(out io.Writer, timeout time.Duration) *cli {
+	return &cli{
+		out: out,
+		timeout: timeout,
+		stop: make(chan struct{}),
+	}
+}
+
+func (c *cli) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	command := args[0]
+	if len(args) > 1 && (command == "props" || command == "event" || command == "service" || command == "endpoints") {
+		command += " " + args[1]
+		args = args[1:]
+	}
+	switch command {
+	case "info":
+		return c.info(args[1:])
+	case "props post":
+		return c.postProperties(args[1:])
+	case "event post":
+		return c.postEvent(args[1:])
+	case "service call":
+		return c.callService(args[1:])
+	case "endpoints list":
+		return c.listEndpoints(args[1:])
+	case "watch":
+		return c.watch(args[1:])
+	case "replay":
+		return c.replay(args[1:])
+	}
+	return errUsage
+}
+
+//指定-edgeconfig时为二进制应用，否则为Docker应用
+func runtimeType() common.AppSdkRuntimeType {
+	if f := flag.Lookup("edgeconfig"); f != nil && f.Value.String() != "" {
+		return common.AppSdkRuntimeType_Exec
+	}
+	return common.AppSdkRuntimeType_Docker
+}
+
+func loadConfig() (*config.EdgeConfig, error) {
+	cfg := &config.EdgeConfig{}
+	err := cfg.Load(runtimeType())
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+/*
+	初始化SDK，connect为true时启动并等待连接成功，返回时已经完成消息订阅
+*/
+func (c *cli) newClient(opt *edge_app_go.Options, connect bool) (edge_app_go.Client, error) {
+	opt.Type = runtimeType()
+	client, err := edge_app_go.NewClient(opt)
+	if err != nil {
+		return nil, err
+	}
+	err = client.Init()
+	if err != nil {
+		return nil, err
+	}
+	if !connect {
+		return client, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	err = client.StartContext(ctx)
+	if err != nil {
+		client.Cleanup()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, errors.New("connect to edge hub timeout")
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+/*
+	解析命令参数，flag和位置参数可以交替出现
+*/
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(ioutil.Discard)
+	positional := make([]string, 0)
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errUsage, err.Error())
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+/*
+	解析key=value格式的参数，value是合法的JSON时按JSON解析，否则作为字符串
+*/
+func parseValues(args []string) (map[string]interface{}, []string, error) {
+	values := make(map[string]interface{})
+	keys := make([]string, 0, len(args))
+	for _, arg := range args {
+		index := strings.Index(arg, "=")
+		if index <= 0 {
+			return nil, nil, fmt.Errorf("%w: invalid key=value argument %q", errUsage, arg)
+		}
+		key := arg[:index]
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = parseValue(arg[index+1:])
+	}
+	return values, keys, nil
+}
+
+func parseValue(raw string) interface{} {
+	var value interface{}
+	if json.Unmarshal([]byte(raw), &value) == nil {
+		return value
+	}
+	return raw
+}
+
+//合并-params参数和key=value参数，key=value优先
+func mergeParams(raw string, args []string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if raw != "" {
+		err := json.Unmarshal([]byte(raw), &params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid params: %s", errUsage, err.Error())
+		}
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+	}
+	values, _, err := parseValues(args)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		params[k] = v
+	}
+	return params, nil
+}
+
+func (c *cli) printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.out, string(data))
+	return err
+}
+
+func (c *cli) info(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	payloadFormat := cfg.PayloadFormat
+	if payloadFormat == "" {
+		payloadFormat = "json"
+	}
+	return c.printJSON(map[string]interface{}{
+		"appId": cfg.AppId,
+		"thingId": cfg.ThingId,
+		"deviceId": cfg.DeviceId,
+		"hub": fmt.Sprintf("%s://%s:%d", cfg.Protocol, cfg.HubAddr, cfg.HubPort),
+		"metaPort": cfg.MetaPort,
+		"proxyMode": cfg.ProxyMode,
+		"payloadFormat": payloadFormat,
+		"topicTemplates": cfg.TopicTemplates,
+	})
+}
+
+func (c *cli) postProperties(args []string) error {
+	fs := flag.NewFlagSet("props post", flag.ContinueOnError)
+	ts := fs.Int64("ts", 0, "timestamp in milliseconds, default now")
+	source := fs.String("source", "", "comma separated device source")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+	values, keys, err := parseValues(positional)
+	if err != nil {
+		return err
+	}
+	timestamp := *ts
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	props := make([]*common.AppSdkMsgProperty, 0, len(keys))
+	for _, key := range keys {
+		props = append(props, &common.AppSdkMsgProperty{
+			Identifier: key,
+			Timestamp: timestamp,
+			Value: values[key],
+		})
+	}
+	data, _ := json.Marshal(props)
+	return c.send(common.AppSdkMessageType_Property, data, *source)
+}
+
+func (c *cli) postEvent(args []string) error {
+	fs := flag.NewFlagSet("event post", flag.ContinueOnError)
+	ts := fs.Int64("ts", 0, "timestamp in milliseconds, default now")
+	level := fs.String("level", "", "event level: info, warn, error or critical")
+	message := fs.String("message", "", "event message")
+	rawParams := fs.String("params", "", "event params in JSON object")
+	source := fs.String("source", "", "comma separated device source")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return errUsage
+	}
+	params, err := mergeParams(*rawParams, positional[1:])
+	if err != nil {
+		return err
+	}
+	timestamp := *ts
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	evt := &common.AppSdkMsgEvent{
+		Identifier: positional[0],
+		Timestamp: timestamp,
+		Params: params,
+		Level: common.EventLevel(*level),
+		Message: *message,
+	}
+	data, _ := json.Marshal(evt)
+	return c.send(common.AppSdkMessageType_Event, data, *source)
+}
+
+func (c *cli) send(msgType common.AppSdkMessageType, data []byte, source string) error {
+	client, err := c.newClient(&edge_app_go.Options{}, true)
+	if err != nil {
+		return err
+	}
+	defer client.Cleanup()
+	var meta *common.AppSdkMessageMeta
+	if source != "" {
+		meta = &common.AppSdkMessageMeta{Source: strings.Split(source, ",")}
+	}
+	err = client.SendMessageWithMeta(msgType, data, meta)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.out, string(data))
+	return err
+}
+
+func (c *cli) callService(args []string) error {
+	fs := flag.NewFlagSet("service call", flag.ContinueOnError)
+	rawParams := fs.String("params", "", "service params in JSON object")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 3 {
+		return errUsage
+	}
+	params, err := mergeParams(*rawParams, positional[3:])
+	if err != nil {
+		return err
+	}
+	client, err := c.newClient(&edge_app_go.Options{}, true)
+	if err != nil {
+		return err
+	}
+	defer client.Cleanup()
+	reply, err := client.CallEndpoint(positional[0], positional[1], &common.AppSdkMsgServiceCall{
+		Identifier: positional[2],
+		Params: params,
+	})
+	if err != nil {
+		return err
+	}
+	return c.printJSON(reply)
+}
+
+func (c *cli) listEndpoints(args []string) error {
+	fs := flag.NewFlagSet("endpoints list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print in JSON")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return errUsage
+	}
+	client, err := c.newClient(&edge_app_go.Options{}, false)
+	if err != nil {
+		return err
+	}
+	defer client.Cleanup()
+	infos, err := client.GetEndpointInfos()
+	if err != nil {
+		return err
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].ThingId != infos[j].ThingId {
+			return infos[i].ThingId < infos[j].ThingId
+		}
+		return infos[i].DeviceId < infos[j].DeviceId
+	})
+	if *asJSON {
+		return c.printJSON(infos)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "THING ID\tDEVICE ID\tNAME")
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", info.ThingId, info.DeviceId, info.DeviceName)
+	}
+	return w.Flush()
+}
+
+/*
+	将录制的消息发布到EdgeHub，默认只回放收到的消息，按照原始速度回放
+*/
+func (c *cli) replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := fs.Float64("speed", 1, "replay speed, 2 means twice as fast, negative means no waiting")
+	direction := fs.String("direction", record.Direction_In, "only replay messages of this direction: in, out, or empty for all")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	records, err := record.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	client, err := c.newClient(&edge_app_go.Options{}, true)
+	if err != nil {
+		return err
+	}
+	defer client.Cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	count := 0
+	publish := record.PublishHandler(client.PublishRaw)
+	replayer := &record.Replayer{
+		Speed: *speed,
+		Direction: *direction,
+	}
+	err = replayer.Replay(ctx, records, func(rec *record.Record) error {
+		err := publish(rec)
+		if err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil && err != context.Canceled {
+		return err
+	}
+	_, err = fmt.Fprintf(c.out, "replayed %d messages\n", count)
+	return err
+}
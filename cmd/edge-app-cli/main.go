@@ -0,0 +1,74 @@
+/*
+	edge-app-cli 通过SDK连接EdgeHub，用于在网关上调试应用消息，不需要编写临时程序
+
+	用法：
+		edge-app-cli [-edgeconfig config.json] [-timeout 10s] <command> [args]
+
+	命令：
+		info                                            显示边设备信息和EdgeHub配置
+		props post [-ts ms] [-source a,b] id=value ...  上报边设备属性，value为JSON格式时按JSON解析，否则为字符串
+		event post <id> [-level warn] [-message text] [-params JSON] [key=value ...]
+		                                                上报边设备事件
+		service call <thingId> <deviceId> <id> [-params JSON] [key=value ...]
+		                                                调用子设备服务，输出回应
+		endpoints list [-json]                          显示子设备列表
+		watch [-type property,event,service] [-thing id] [-device id] [-id identifier] [-json]
+		                                                实时显示解码后的属性、事件和服务调用消息
+		replay <file> [-speed 1] [-direction in]        将SDK录制的消息发布到EdgeHub，-speed为回放倍速
+
+	指定-edgeconfig时按照二进制应用加载配置文件，否则按照Docker应用从环境变量加载配置
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var timeout = flag.Duration("timeout", 10*time.Second, "timeout of connecting to edge hub")
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	//SDK日志输出到标准错误，标准输出只包含命令结果
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	c := newCli(out, *timeout)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		close(c.stop)
+	}()
+	err := c.run(flag.Args())
+	if err == errUsage {
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "edge-app-cli failed, err:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: edge-app-cli [-edgeconfig config.json] [-timeout 10s] <command> [args]
+
+commands:
+  info
+  props post [-ts ms] [-source a,b] id=value ...
+  event post <id> [-level warn] [-message text] [-params JSON] [key=value ...]
+  service call <thingId> <deviceId> <id> [-params JSON] [key=value ...]
+  endpoints list [-json]
+  watch [-type property,event,service] [-thing id] [-device id] [-id identifier] [-json]
+  replay <file> [-speed 1] [-direction in]`)
+	flag.PrintDefaults()
+}
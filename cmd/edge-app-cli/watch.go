@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/core/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+//消息类型的显示名称
+var messageTypeNames = map[common.AppSdkMessageType]string{
+	common.AppSdkMessageType_Property: 			"property",
+	common.AppSdkMessageType_Event: 			"event",
+	common.AppSdkMessageType_ServiceCall: 		"service_call",
+	common.AppSdkMessageType_ServiceReply: 		"service_reply",
+	common.AppSdkMessageType_PropertySet: 		"property_set",
+	common.AppSdkMessageType_PropertySetReply: 	"property_set_reply",
+}
+
+/*
+	watch命令的过滤条件，为空的字段表示不做限制
+*/
+type watchFilter struct {
+	//消息类型名称，service同时匹配service_call和service_reply
+	types 		map[string]bool
+	thingId 	string
+	deviceId 	string
+	identifier 	string
+}
+
+func (f *watchFilter) match(record *watchRecord) bool {
+	if len(f.types) > 0 && !f.types[record.Type] && !(f.types["service"] && strings.HasPrefix(record.Type, "service_")) {
+		return false
+	}
+	if f.thingId != "" && f.thingId != record.ThingId {
+		return false
+	}
+	if f.deviceId != "" && f.deviceId != record.DeviceId {
+		return false
+	}
+	if f.identifier == "" {
+		return true
+	}
+	for _, id := range record.identifiers() {
+		if id == f.identifier {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	watch命令输出的消息记录
+*/
+type watchRecord struct {
+	Time 		time.Time 			`json:"time"`
+	Type 		string 				`json:"type"`
+	ThingId 	string 				`json:"thingId"`
+	DeviceId 	string 				`json:"deviceId"`
+	Topic 		string 				`json:"topic,omitempty"`
+	Payload 	json.RawMessage 	`json:"payload"`
+}
+
+//消息中的属性、事件或服务标识id
+func (r *watchRecord) identifiers() []string {
+	result := make([]string, 0)
+	switch r.Type {
+	case "property":
+		props := make([]*common.AppSdkMsgProperty, 0)
+		json.Unmarshal(r.Payload, &props)
+		for _, prop := range props {
+			result = append(result, prop.Identifier)
+		}
+	case "property_set":
+		set := &common.AppSdkMsgPropertySet{}
+		json.Unmarshal(r.Payload, set)
+		for _, prop := range set.Properties {
+			result = append(result, prop.Identifier)
+		}
+	default:
+		header := &struct {
+			Identifier 	string 	`json:"identifier"`
+		}{}
+		json.Unmarshal(r.Payload, header)
+		result = append(result, header.Identifier)
+	}
+	return result
+}
+
+func (r *watchRecord) String() string {
+	return fmt.Sprintf("%s %-13s %s/%s %s", r.Time.Format("15:04:05.000"), r.Type, r.ThingId, r.DeviceId, string(r.Payload))
+}
+
+/*
+	实时显示消息：模型消息通过MessageCB接收；非代理模式下通过原始消息订阅子设备服务调用和回应，
+	按照普通模式解码；代理模式下只能接收边设备自身的消息
+*/
+func (c *cli) watch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	types := fs.String("type", "", "comma separated message types: property, event, service, property_set")
+	thingId := fs.String("thing", "", "only show messages of this thing id")
+	deviceId := fs.String("device", "", "only show messages of this device id")
+	identifier := fs.String("id", "", "only show messages with this property, event or service identifier")
+	asJSON := fs.Bool("json", false, "print one JSON object per line")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return errUsage
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	filter := &watchFilter{
+		types: make(map[string]bool),
+		thingId: *thingId,
+		deviceId: *deviceId,
+		identifier: *identifier,
+	}
+	for _, t := range strings.Split(*types, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.types[t] = true
+		}
+	}
+	var lock sync.Mutex
+	output := func(record *watchRecord) {
+		if !filter.match(record) {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if *asJSON {
+			data, _ := json.Marshal(record)
+			fmt.Fprintln(c.out, string(data))
+		} else {
+			fmt.Fprintln(c.out, record.String())
+		}
+	}
+	opt := &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, param interface{}) {
+			output(&watchRecord{
+				Time: time.Now(),
+				Type: messageTypeName(data.Type),
+				ThingId: data.ThingId,
+				DeviceId: data.DeviceId,
+				Payload: json.RawMessage(data.Payload),
+			})
+		},
+	}
+	if cfg.ProxyMode {
+		opt.ServiceIds = []string{wildcard(*identifier)}
+	} else {
+		opt.EndpointFilters = []*common.EndpointFilter{{
+			ThingId: wildcard(*thingId),
+			DeviceIds: []string{wildcard(*deviceId)},
+		}}
+	}
+	client, err := c.newClient(opt, true)
+	if err != nil {
+		return err
+	}
+	defer client.Cleanup()
+	if !cfg.ProxyMode {
+		err = c.watchServices(client, cfg, filter, output)
+		if err != nil {
+			return err
+		}
+	}
+	<-c.stop
+	return nil
+}
+
+//订阅服务调用和回应的原始消息并解码
+func (c *cli) watchServices(client edge_app_go.Client, cfg *config.EdgeConfig, filter *watchFilter, output func(*watchRecord)) error {
+	payloadCodec, err := codec.NewPayloadCodec(cfg.PayloadFormat)
+	if err != nil {
+		return err
+	}
+	handler := codec.NewCodec(cfg.AppId, cfg.DeviceId, cfg.ThingId, false)
+	handler.Payload = payloadCodec
+	cb := func(topic string, payload []byte) {
+		decoded, err := handler.Decode(topic, payload)
+		if err != nil {
+			fmt.Println("edge-app-cli decode message failed, topic:", topic, "err:", err.Error())
+			return
+		}
+		msgType := common.AppSdkMessageType_ServiceCall
+		if decoded.TopicType == codec.TopicType_SubServiceReply {
+			msgType = common.AppSdkMessageType_ServiceReply
+		}
+		output(&watchRecord{
+			Time: time.Now(),
+			Type: messageTypeName(msgType),
+			ThingId: decoded.ThingId,
+			DeviceId: decoded.DeviceId,
+			Topic: topic,
+			Payload: json.RawMessage(decoded.Payload),
+		})
+	}
+	for _, topicType := range []string{codec.TopicType_SubService, codec.TopicType_SubServiceReply} {
+		topic, err := handler.EncodeTopic(topicType, wildcard(filter.identifier), wildcard(filter.thingId), wildcard(filter.deviceId))
+		if err != nil {
+			return err
+		}
+		err = client.SubscribeRaw(topic, cb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func messageTypeName(msgType common.AppSdkMessageType) string {
+	if name, ok := messageTypeNames[msgType]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func wildcard(value string) string {
+	if value == "" {
+		return "+"
+	}
+	return value
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/core/thingmodel"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//生成代码使用的字段定义
+type genField struct {
+	//Go字段名
+	Name 		string
+	//Go类型
+	Type 		string
+	//物模型标识id
+	Identifier 	string
+	//注释
+	Comment 	string
+}
+
+//生成代码使用的结构体定义
+type genStruct struct {
+	Name 		string
+	Comment 	string
+	Fields 		[]*genField
+}
+
+//生成代码使用的服务定义
+type genService struct {
+	Name 		string
+	Identifier 	string
+	Comment 	string
+	Input 		string
+	Output 		string
+}
+
+//生成代码使用的事件定义
+type genEvent struct {
+	Name 		string
+	Identifier 	string
+	Comment 	string
+	Params 		string
+}
+
+type generator struct {
+	Package 	string
+	ThingId 	string
+	Properties 	[]*genField
+	Events 		[]*genEvent
+	Services 	[]*genService
+	Structs 	[]*genStruct
+	names 		map[string]int
+}
+
+//根据物模型生成Go代码
+func generate(model *thingmodel.Model, pkg string) ([]byte, error) {
+	g := &generator{
+		Package: pkg,
+		ThingId: model.ThingId,
+		names: make(map[string]int),
+	}
+	//生成代码中固定使用的包级别名称
+	for _, name := range []string{"ThingId", "Properties", "Thing", "ServiceHandler", "UnimplementedServiceHandler", "toParams", "fromParams"} {
+		g.names[name] = 1
+	}
+	//标识id重复时生成的常量和switch分支重复，无法编译
+	if id, ok := duplicateId(propertyIds(model)); ok {
+		return nil, fmt.Errorf("duplicate property identifier %q", id)
+	}
+	if id, ok := duplicateId(eventIds(model)); ok {
+		return nil, fmt.Errorf("duplicate event identifier %q", id)
+	}
+	if id, ok := duplicateId(serviceIds(model)); ok {
+		return nil, fmt.Errorf("duplicate service identifier %q", id)
+	}
+	//Properties的方法名不能作为字段名
+	propNames := map[string]bool{"ToMsgProperties": true, "FromMsgProperties": true}
+	props := make([]*genField, 0)
+	for _, prop := range model.Properties {
+		field := &genField{
+			Name: g.memberName(propNames, prop.Identifier, "Property%s"),
+			Identifier: prop.Identifier,
+			Comment: fieldComment(prop.Name, prop.DataType),
+		}
+		field.Type = g.goType(field.Name, prop.DataType)
+		props = append(props, field)
+	}
+	g.Properties = props
+	evtNames := make(map[string]bool)
+	for _, evt := range model.Events {
+		name := g.memberName(evtNames, evt.Identifier, "Event%s", "%sEvent")
+		g.Events = append(g.Events, &genEvent{
+			Name: name,
+			Identifier: evt.Identifier,
+			Comment: evt.Name,
+			Params: g.paramStruct(name+"Event", evt.Name, evt.Params),
+		})
+	}
+	srvNames := make(map[string]bool)
+	for _, srv := range model.Services {
+		name := g.memberName(srvNames, srv.Identifier, "Service%s", "%sInput", "%sOutput")
+		g.Services = append(g.Services, &genService{
+			Name: name,
+			Identifier: srv.Identifier,
+			Comment: srv.Name,
+			Input: g.paramStruct(name+"Input", srv.Name+"输入参数", srv.Input),
+			Output: g.paramStruct(name+"Output", srv.Name+"输出参数", srv.Output),
+		})
+	}
+	buf := &bytes.Buffer{}
+	err := codeTemplate.Execute(buf, g)
+	if err != nil {
+		return nil, err
+	}
+	result, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code failed: %s", err.Error())
+	}
+	return result, nil
+}
+
+//生成参数结构体，name需要已经通过uniqueName或者memberName分配，返回结构体名称
+func (g *generator) paramStruct(name string, comment string, params []*thingmodel.Param) string {
+	st := &genStruct{
+		Name: name,
+		Comment: comment,
+	}
+	//先占位，保证嵌套结构体在外层结构体之后输出
+	g.Structs = append(g.Structs, st)
+	fieldNames := make(map[string]bool)
+	for _, param := range params {
+		field := &genField{
+			Name: g.memberName(fieldNames, param.Identifier),
+			Identifier: param.Identifier,
+			Comment: fieldComment(param.Name, param.DataType),
+		}
+		field.Type = g.goType(name+field.Name, param.DataType)
+		st.Fields = append(st.Fields, field)
+	}
+	return name
+}
+
+//物模型数据类型转换为Go类型，结构体类型会生成新的结构体定义
+func (g *generator) goType(name string, dt *thingmodel.DataType) string {
+	if dt == nil {
+		return "interface{}"
+	}
+	switch dt.Type {
+	case thingmodel.DataType_Int, thingmodel.DataType_Date:
+		return "int64"
+	case thingmodel.DataType_Float, thingmodel.DataType_Double:
+		return "float64"
+	case thingmodel.DataType_Bool:
+		return "bool"
+	case thingmodel.DataType_String:
+		return "string"
+	case thingmodel.DataType_Enum:
+		for key := range dt.Enum {
+			if _, err := strconv.ParseInt(key, 10, 64); err != nil {
+				return "string"
+			}
+		}
+		return "int64"
+	case thingmodel.DataType_Struct:
+		return g.paramStruct(g.uniqueName(name), "", dt.Specs)
+	case thingmodel.DataType_Array:
+		return "[]" + g.goType(name+"Item", dt.Item)
+	}
+	return "interface{}"
+}
+
+//分配包级别名称，已经被使用时增加数字后缀
+func (g *generator) uniqueName(name string) string {
+	result := name
+	for i := 2; g.names[result] > 0; i++ {
+		result = fmt.Sprintf("%s%d", name, i)
+	}
+	g.names[result] = 1
+	return result
+}
+
+/*
+	为标识id分配Go名称，used为同一作用域中已经使用的名称，如结构体字段和接口方法；
+	patterns为根据名称派生的包级别名称，如常量和结构体，派生名称同样不能重复；
+	不同标识id转换后的名称相同时增加数字后缀，如 reset 和 reset_ 分别为 Reset 和 Reset2
+*/
+func (g *generator) memberName(used map[string]bool, identifier string, patterns ...string) string {
+	base := goName(identifier)
+	name := base
+	for i := 2; !g.available(used, name, patterns); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	used[name] = true
+	for _, pattern := range patterns {
+		g.names[fmt.Sprintf(pattern, name)] = 1
+	}
+	return name
+}
+
+func (g *generator) available(used map[string]bool, name string, patterns []string) bool {
+	if used[name] {
+		return false
+	}
+	for _, pattern := range patterns {
+		if g.names[fmt.Sprintf(pattern, name)] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func propertyIds(model *thingmodel.Model) []string {
+	ids := make([]string, 0, len(model.Properties))
+	for _, prop := range model.Properties {
+		ids = append(ids, prop.Identifier)
+	}
+	return ids
+}
+
+func eventIds(model *thingmodel.Model) []string {
+	ids := make([]string, 0, len(model.Events))
+	for _, evt := range model.Events {
+		ids = append(ids, evt.Identifier)
+	}
+	return ids
+}
+
+func serviceIds(model *thingmodel.Model) []string {
+	ids := make([]string, 0, len(model.Services))
+	for _, srv := range model.Services {
+		ids = append(ids, srv.Identifier)
+	}
+	return ids
+}
+
+func duplicateId(ids []string) (string, bool) {
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			return id, true
+		}
+		seen[id] = true
+	}
+	return "", false
+}
+
+//字段注释，包含名称、单位、取值范围和枚举值
+func fieldComment(name string, dt *thingmodel.DataType) string {
+	parts := make([]string, 0)
+	if name != "" {
+		parts = append(parts, name)
+	}
+	if dt == nil {
+		return strings.Join(parts, " ")
+	}
+	if dt.Unit != "" {
+		parts = append(parts, "单位: "+dt.Unit)
+	}
+	if dt.Min != nil || dt.Max != nil {
+		min, max := "-", "-"
+		if dt.Min != nil {
+			min = strconv.FormatFloat(*dt.Min, 'g', -1, 64)
+		}
+		if dt.Max != nil {
+			max = strconv.FormatFloat(*dt.Max, 'g', -1, 64)
+		}
+		parts = append(parts, fmt.Sprintf("范围: [%s, %s]", min, max))
+	}
+	if len(dt.Enum) > 0 {
+		keys := make([]string, 0, len(dt.Enum))
+		for key := range dt.Enum {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(keys))
+		for _, key := range keys {
+			values = append(values, key+"-"+dt.Enum[key])
+		}
+		parts = append(parts, "枚举: "+strings.Join(values, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+//将标识id转换为导出的Go名称，如 random_data -> RandomData
+func goName(identifier string) string {
+	words := strings.FieldsFunc(identifier, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	buf := &strings.Builder{}
+	for _, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		buf.WriteString(string(runes))
+	}
+	name := buf.String()
+	if name == "" {
+		return "X"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+var codeTemplate = template.Must(template.New("code").Parse(`// Code generated by edge-app-gen. DO NOT EDIT.
+{{if .ThingId}}// 物模型id: {{.ThingId}}{{end}}
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"time"
+)
+
+//物模型id
+const ThingId = "{{.ThingId}}"
+
+//属性标识id
+const (
+{{- range .Properties}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	Property{{.Name}} = "{{.Identifier}}"
+{{- end}}
+)
+
+//事件标识id
+const (
+{{- range .Events}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	Event{{.Name}} = "{{.Identifier}}"
+{{- end}}
+)
+
+//服务标识id
+const (
+{{- range .Services}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	Service{{.Name}} = "{{.Identifier}}"
+{{- end}}
+)
+
+//物模型属性，为nil的字段不上报
+type Properties struct {
+{{- range .Properties}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	{{.Name}} *{{.Type}} ` + "`json:\"{{.Identifier}},omitempty\"`" + `
+{{- end}}
+}
+
+//转换为属性消息，所有属性使用相同的时间戳
+func (p *Properties) ToMsgProperties(timestamp int64) []*common.AppSdkMsgProperty {
+	props := make([]*common.AppSdkMsgProperty, 0)
+{{- range .Properties}}
+	if p.{{.Name}} != nil {
+		props = append(props, &common.AppSdkMsgProperty{Identifier: Property{{.Name}}, Timestamp: timestamp, Value: *p.{{.Name}}})
+	}
+{{- end}}
+	return props
+}
+
+//从属性消息解析属性，未知的属性标识id会被忽略
+func (p *Properties) FromMsgProperties(props []*common.AppSdkMsgProperty) error {
+	params := make(map[string]interface{})
+	for _, prop := range props {
+		params[prop.Identifier] = prop.Value
+	}
+	return fromParams(params, p)
+}
+{{range .Structs}}
+{{- if .Comment}}
+//{{.Comment}}
+{{- end}}
+type {{.Name}} struct {
+{{- range .Fields}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	{{.Name}} {{.Type}} ` + "`json:\"{{.Identifier}}\"`" + `
+{{- end}}
+}
+{{end}}
+//边设备物模型客户端，封装类型安全的消息发送接口
+type Thing struct {
+	Client edge_app_go.Client
+}
+
+//上报属性
+func (t *Thing) PostProperties(p *Properties) error {
+	props := p.ToMsgProperties(time.Now().UnixNano() / 1e6)
+	if len(props) == 0 {
+		return errors.New("properties is empty")
+	}
+	payload, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	return t.Client.SendMessage(common.AppSdkMessageType_Property, payload)
+}
+{{range .Events}}
+//上报事件{{if .Comment}} {{.Comment}}{{end}}
+func (t *Thing) Post{{.Name}}Event(evt *{{.Params}}) error {
+	return t.postEvent(Event{{.Name}}, evt)
+}
+{{end}}
+func (t *Thing) postEvent(identifier string, evt interface{}) error {
+	params, err := toParams(evt)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&common.AppSdkMsgEvent{
+		Identifier: identifier,
+		Timestamp: time.Now().UnixNano() / 1e6,
+		Params: params,
+	})
+	if err != nil {
+		return err
+	}
+	return t.Client.SendMessage(common.AppSdkMessageType_Event, payload)
+}
+
+//服务调用处理接口，返回error时回应code 500
+type ServiceHandler interface {
+{{- range .Services}}
+	{{- if .Comment}}
+	//{{.Comment}}
+	{{- end}}
+	{{.Name}}(in *{{.Input}}) (*{{.Output}}, error)
+{{- end}}
+}
+
+//服务调用处理接口的默认实现，嵌入到应用的实现中，未实现的服务返回错误
+type UnimplementedServiceHandler struct{}
+{{range .Services}}
+func (UnimplementedServiceHandler) {{.Name}}(in *{{.Input}}) (*{{.Output}}, error) {
+	return nil, errors.New("service {{.Identifier}} not implemented")
+}
+{{end}}
+//处理服务调用消息并回应，不是本物模型的服务调用时返回false
+func (t *Thing) HandleServiceCall(msg *common.AppSdkMessageData, handler ServiceHandler) (bool, error) {
+	if msg == nil || msg.Type != common.AppSdkMessageType_ServiceCall {
+		return false, nil
+	}
+	call := &common.AppSdkMsgServiceCall{}
+	err := json.Unmarshal(msg.Payload, call)
+	if err != nil {
+		return false, err
+	}
+{{- if .Services}}
+	var output interface{}
+	var callErr error
+	switch call.Identifier {
+{{- range .Services}}
+	case Service{{.Name}}:
+		in := &{{.Input}}{}
+		callErr = fromParams(call.Params, in)
+		if callErr == nil {
+			output, callErr = handler.{{.Name}}(in)
+		}
+{{- end}}
+	default:
+		return false, nil
+	}
+	reply := &common.AppSdkMsgServiceReply{
+		MessageId: call.MessageId,
+		Identifier: call.Identifier,
+		Code: 200,
+	}
+	if callErr != nil {
+		reply.Code = 500
+		reply.Params = map[string]interface{}{"message": callErr.Error()}
+	} else {
+		reply.Params, err = toParams(output)
+		if err != nil {
+			return true, err
+		}
+	}
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		return true, err
+	}
+	return true, t.Client.SendMessage(common.AppSdkMessageType_ServiceReply, payload)
+{{- else}}
+	return false, nil
+{{- end}}
+}
+
+func toParams(v interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return params, nil
+	}
+	err = json.Unmarshal(data, &params)
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func fromParams(params map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+`))
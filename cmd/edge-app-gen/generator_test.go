@@ -0,0 +1,113 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"github.com/qingcloud-iot/edge-app-go/core/thingmodel"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+//从源码导入依赖的包，多个测试共用以缓存已经导入的包
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+//解析并类型检查生成的代码，保证可以编译
+func checkCompile(t *testing.T, code []byte) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "model_gen.go", code, 0)
+	if !assert.Nil(t, err) {
+		return
+	}
+	conf := &types.Config{Importer: sourceImporter}
+	_, err = conf.Check("model", fset, []*ast.File{file}, nil)
+	assert.Nil(t, err, string(code))
+}
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+	model, err := thingmodel.Parse([]byte(`{
+		"thingId": "iott-test",
+		"properties": [{"identifier": "random_data", "dataType": {"type": "int", "min": 0, "max": 100}}],
+		"events": [{"identifier": "data_event", "params": [{"identifier": "event_value", "dataType": {"type": "string"}}]}],
+		"services": [{"identifier": "test_app_call", "input": [{"identifier": "temperature", "dataType": {"type": "int"}}], "output": []}]
+	}`))
+	if !assert.Nil(err) {
+		return
+	}
+	code, err := generate(model, "model")
+	if !assert.Nil(err) {
+		return
+	}
+	src := string(code)
+	assert.True(strings.Contains(src, `PropertyRandomData = "random_data"`))
+	assert.True(strings.Contains(src, "RandomData *int64"))
+	assert.True(strings.Contains(src, "func (t *Thing) PostDataEventEvent(evt *DataEventEvent) error"))
+	assert.True(strings.Contains(src, "TestAppCall(in *TestAppCallInput) (*TestAppCallOutput, error)"))
+	checkCompile(t, code)
+}
+
+//不同标识id转换后的Go名称相同时增加数字后缀
+func TestGenerate_NameCollision(t *testing.T) {
+	assert := assert.New(t)
+	model, err := thingmodel.Parse([]byte(`{
+		"thingId": "iott-test",
+		"properties": [
+			{"identifier": "a-b", "dataType": {"type": "int"}},
+			{"identifier": "a_b", "dataType": {"type": "int"}},
+			{"identifier": "to_msg_properties", "dataType": {"type": "bool"}},
+			{"identifier": "event_reset", "dataType": {"type": "struct", "specs": [
+				{"identifier": "x-y", "dataType": {"type": "int"}},
+				{"identifier": "x_y", "dataType": {"type": "int"}}
+			]}}
+		],
+		"events": [
+			{"identifier": "reset", "params": []},
+			{"identifier": "reset_", "params": []}
+		],
+		"services": [
+			{"identifier": "reset", "input": [], "output": []},
+			{"identifier": "reset_", "input": [], "output": []},
+			{"identifier": "reset2", "input": [], "output": []}
+		]
+	}`))
+	if !assert.Nil(err) {
+		return
+	}
+	code, err := generate(model, "model")
+	if !assert.Nil(err) {
+		return
+	}
+	src := string(code)
+	assert.True(strings.Contains(src, "PropertyAB2 "))
+	assert.True(strings.Contains(src, "ToMsgProperties2 *bool"))
+	assert.True(strings.Contains(src, "XY2 int64"))
+	//EventReset已经被属性event_reset的结构体使用
+	assert.True(strings.Contains(src, "func (t *Thing) PostReset2Event(evt *Reset2Event) error"))
+	assert.True(strings.Contains(src, "func (t *Thing) PostReset3Event(evt *Reset3Event) error"))
+	assert.True(strings.Contains(src, "Reset22(in *Reset22Input) (*Reset22Output, error)"))
+	checkCompile(t, code)
+
+	model, err = thingmodel.Parse([]byte(`{
+		"thingId": "iott-test",
+		"services": [
+			{"identifier": "reset", "input": [], "output": []},
+			{"identifier": "reset", "input": [], "output": []}
+		]
+	}`))
+	if !assert.Nil(err) {
+		return
+	}
+	_, err = generate(model, "model")
+	assert.EqualError(err, `duplicate service identifier "reset"`)
+}
+
+func TestGoName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("RandomData", goName("random_data"))
+	assert.Equal("SetTemperature", goName("setTemperature"))
+	assert.Equal("X1stValue", goName("1st-value"))
+}
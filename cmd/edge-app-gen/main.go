@@ -0,0 +1,49 @@
+/*
+	edge-app-gen 根据物模型JSON文件生成类型安全的Go代码，包括属性、事件和服务调用输入输出的结构体，
+	封装Client.SendMessage的上报接口，以及服务调用处理接口
+
+	用法：
+		edge-app-gen -model thing_model.json -pkg model -o model/model_gen.go
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/core/thingmodel"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	modelPath = flag.String("model", "", "thing model json file path")
+	pkgName   = flag.String("pkg", "model", "package name of generated code")
+	output    = flag.String("o", "", "output file path, print to stdout if empty")
+)
+
+func main() {
+	flag.Parse()
+	if *modelPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	model, err := thingmodel.LoadFile(*modelPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load thing model failed, err:", err.Error())
+		os.Exit(1)
+	}
+	code, err := generate(model, *pkgName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "generate code failed, err:", err.Error())
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(code)
+		return
+	}
+	err = ioutil.WriteFile(*output, code, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "write code failed, err:", err.Error())
+		os.Exit(1)
+	}
+}
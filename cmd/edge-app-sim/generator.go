@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+	属性值生成器，elapsed为模拟开始后经过的时间
+*/
+type generator interface {
+	next(elapsed time.Duration) (interface{}, bool)
+}
+
+//根据属性定义创建生成器，每个设备使用独立的生成器
+func newGenerator(spec *PropertySpec, rnd *rand.Rand) (generator, error) {
+	switch spec.Generator {
+	case "sine":
+		if spec.Period <= 0 {
+			return nil, errors.New("sine generator of " + spec.Identifier + " should have positive period")
+		}
+		return &sineGenerator{spec: spec}, nil
+	case "random_walk":
+		if spec.Min != nil && spec.Max != nil && *spec.Min > *spec.Max {
+			return nil, errors.New("random_walk generator of " + spec.Identifier + " has min greater than max")
+		}
+		return &randomWalkGenerator{spec: spec, rnd: rnd, value: spec.Start}, nil
+	case "csv":
+		return newCsvGenerator(spec)
+	case "constant", "":
+		return &constantGenerator{value: spec.Value}, nil
+	}
+	return nil, errors.New("unsupported generator: " + spec.Generator)
+}
+
+type sineGenerator struct {
+	spec 	*PropertySpec
+}
+
+func (g *sineGenerator) next(elapsed time.Duration) (interface{}, bool) {
+	phase := 2 * math.Pi * float64(elapsed) / float64(g.spec.Period)
+	return round(g.spec.Offset+g.spec.Amplitude*math.Sin(phase), g.spec.Precision), true
+}
+
+type randomWalkGenerator struct {
+	spec 	*PropertySpec
+	rnd 	*rand.Rand
+	value 	float64
+}
+
+func (g *randomWalkGenerator) next(elapsed time.Duration) (interface{}, bool) {
+	g.value += (g.rnd.Float64()*2 - 1) * g.spec.Step
+	if g.spec.Min != nil && g.value < *g.spec.Min {
+		g.value = *g.spec.Min
+	}
+	if g.spec.Max != nil && g.value > *g.spec.Max {
+		g.value = *g.spec.Max
+	}
+	return round(g.value, g.spec.Precision), true
+}
+
+/*
+	CSV回放生成器，文件在创建时全部加载，回放结束并且不循环时不再上报该属性
+*/
+type csvGenerator struct {
+	values 	[]interface{}
+	index 	int
+	loop 	bool
+}
+
+func newCsvGenerator(spec *PropertySpec) (*csvGenerator, error) {
+	file, err := os.Open(spec.File)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("read csv header failed, file: " + spec.File + ", err: " + err.Error())
+	}
+	column := -1
+	for i, name := range header {
+		if name == spec.Column || (spec.Column == "" && name == spec.Identifier) {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		return nil, errors.New("column not found in csv file: " + spec.File)
+	}
+	g := &csvGenerator{
+		values: make([]interface{}, 0),
+		loop: spec.Loop,
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("read csv failed, file: " + spec.File + ", err: " + err.Error())
+		}
+		if column >= len(record) {
+			continue
+		}
+		g.values = append(g.values, parseCsvValue(record[column]))
+	}
+	if len(g.values) == 0 {
+		return nil, errors.New("no values in csv file: " + spec.File)
+	}
+	return g, nil
+}
+
+func (g *csvGenerator) next(elapsed time.Duration) (interface{}, bool) {
+	if g.index >= len(g.values) {
+		if !g.loop {
+			return nil, false
+		}
+		g.index = 0
+	}
+	value := g.values[g.index]
+	g.index++
+	return value, true
+}
+
+//数字和布尔值按照对应类型回放，其他按字符串回放
+func parseCsvValue(raw string) interface{} {
+	if value, err := strconv.ParseFloat(raw, 64); err == nil {
+		return value
+	}
+	if value, err := strconv.ParseBool(raw); err == nil {
+		return value
+	}
+	return raw
+}
+
+type constantGenerator struct {
+	value 	interface{}
+}
+
+func (g *constantGenerator) next(elapsed time.Duration) (interface{}, bool) {
+	return g.value, g.value != nil
+}
+
+func round(value float64, precision int) float64 {
+	if precision <= 0 {
+		return value
+	}
+	scale := math.Pow(10, float64(precision))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestGenerator_Sine(t *testing.T) {
+	assert := assert.New(t)
+	g, err := newGenerator(&PropertySpec{Identifier: "temp", Generator: "sine", Offset: 20, Amplitude: 5, Period: 4 * time.Second, Precision: 2}, nil)
+	if !assert.Nil(err) {
+		return
+	}
+	value, ok := g.next(0)
+	assert.True(ok)
+	assert.Equal(20.0, value)
+	value, _ = g.next(time.Second)
+	assert.Equal(25.0, value)
+	value, _ = g.next(3 * time.Second)
+	assert.Equal(15.0, value)
+	_, err = newGenerator(&PropertySpec{Identifier: "temp", Generator: "sine"}, nil)
+	assert.NotNil(err)
+}
+
+func TestGenerator_RandomWalk(t *testing.T) {
+	assert := assert.New(t)
+	min, max := 0.0, 2.0
+	spec := &PropertySpec{Identifier: "humi", Generator: "random_walk", Start: 1, Step: 1, Min: &min, Max: &max}
+	g1, err := newGenerator(spec, rand.New(rand.NewSource(1)))
+	if !assert.Nil(err) {
+		return
+	}
+	g2, _ := newGenerator(spec, rand.New(rand.NewSource(1)))
+	prev := 1.0
+	for i := 0; i < 100; i++ {
+		v1, _ := g1.next(0)
+		v2, _ := g2.next(0)
+		//相同的种子生成相同的序列
+		assert.Equal(v1, v2)
+		value := v1.(float64)
+		assert.True(value >= min && value <= max)
+		assert.True(value-prev <= 1 && prev-value <= 1)
+		prev = value
+	}
+	_, err = newGenerator(&PropertySpec{Generator: "random_walk", Min: &max, Max: &min}, nil)
+	assert.NotNil(err)
+}
+
+func TestGenerator_Csv(t *testing.T) {
+	assert := assert.New(t)
+	g, err := newGenerator(&PropertySpec{Identifier: "state", Generator: "csv", File: "testdata/power.csv"}, nil)
+	if !assert.Nil(err) {
+		return
+	}
+	values := make([]interface{}, 0)
+	for {
+		value, ok := g.next(0)
+		if !ok {
+			break
+		}
+		values = append(values, value)
+	}
+	assert.Equal([]interface{}{"on", "on", "off"}, values)
+
+	g, err = newGenerator(&PropertySpec{Identifier: "p", Generator: "csv", File: "testdata/power.csv", Column: "power", Loop: true}, nil)
+	if !assert.Nil(err) {
+		return
+	}
+	for _, expected := range []float64{10.5, 11, 12.5, 10.5} {
+		value, ok := g.next(0)
+		assert.True(ok)
+		assert.Equal(expected, value)
+	}
+	_, err = newGenerator(&PropertySpec{Identifier: "p", Generator: "csv", File: "testdata/power.csv", Column: "none"}, nil)
+	assert.NotNil(err)
+	_, err = newGenerator(&PropertySpec{Identifier: "p", Generator: "unknown"}, nil)
+	assert.NotNil(err)
+}
+
+func TestScenario(t *testing.T) {
+	assert := assert.New(t)
+	s, err := LoadScenario("testdata/scenario.yaml")
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(time.Minute, s.Duration)
+	ep := s.Endpoints[0]
+	assert.Equal(50*time.Millisecond, ep.interval())
+	assert.Equal([]string{"iotd-meter-1", "iotd-meter-2"}, ep.deviceIds())
+	assert.Equal("testdata/power.csv", ep.Properties[2].File)
+	assert.Equal("open", ep.service("open").Identifier)
+	assert.Equal("*", ep.service("close").Identifier)
+	assert.Equal(map[string]interface{}{"code": 1}, ep.Events[0].Params)
+
+	_, err = ParseScenario([]byte("endpoints: []"))
+	assert.NotNil(err)
+	_, err = ParseScenario([]byte("endpoints: [{thingId: iott-001}]"))
+	assert.NotNil(err)
+	_, err = ParseScenario([]byte("endpoints: [{thingId: iott-001, deviceId: iotd-001, events: [{identifier: alarm}]}]"))
+	assert.NotNil(err)
+}
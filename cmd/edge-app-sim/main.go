@@ -0,0 +1,94 @@
+/*
+	edge-app-sim 模拟子设备，按照YAML场景文件上报属性和事件，并回应服务调用，用于在没有真实设备时测试应用
+
+	用法：
+		edge-app-sim -scenario scenario.yaml [-hub tcp://127.0.0.1:1883] [-v]
+
+	场景示例：
+		hub: tcp://127.0.0.1:1883
+		duration: 10m
+		endpoints:
+		  - thingId: iott-meter
+		    deviceId: iotd-meter
+		    count: 3
+		    interval: 1s
+		    properties:
+		      - {identifier: temp, generator: sine, offset: 20, amplitude: 5, period: 60s, precision: 2}
+		      - {identifier: humi, generator: random_walk, start: 50, step: 1, min: 0, max: 100}
+		      - {identifier: power, generator: csv, file: power.csv, column: power, loop: true}
+		    events:
+		      - {identifier: alarm, interval: 30s, level: warn, params: {code: 1}}
+		    services:
+		      - {identifier: open, code: 200, params: {result: ok}, delay: 100ms}
+		      - {identifier: "*", echo: true}
+
+	EdgeHub地址的优先级为-hub参数、场景文件中的hub、EDGE_HUB_PROTO/EDGE_HUB_HOST/EDGE_HUB_PORT环境变量
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/core/config"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	scenarioPath = flag.String("scenario", "", "scenario yaml file path")
+	hubUrl       = flag.String("hub", "", "edge hub url, such as tcp://127.0.0.1:1883")
+	verbose      = flag.Bool("v", false, "print every message")
+)
+
+func main() {
+	flag.Parse()
+	if *scenarioPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	scenario, err := LoadScenario(*scenarioPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load scenario failed, err:", err.Error())
+		os.Exit(1)
+	}
+	sim, err := newSimulator(scenario, resolveHubUrl(*hubUrl, scenario.Hub), *verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "create simulator failed, err:", err.Error())
+		os.Exit(1)
+	}
+	stop := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		close(stop)
+	}()
+	err = sim.run(stop)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "run simulator failed, err:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func resolveHubUrl(flagUrl string, scenarioUrl string) string {
+	if flagUrl != "" {
+		return flagUrl
+	}
+	if scenarioUrl != "" {
+		return scenarioUrl
+	}
+	protocol := os.Getenv(config.ENV_EDGE_HUB_PROTOCOL)
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	host := os.Getenv(config.ENV_EDGE_HUB_HOST)
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := os.Getenv(config.ENV_EDGE_HUB_PORT)
+	if port == "" {
+		port = "1883"
+	}
+	return fmt.Sprintf("%s://%s:%s", protocol, host, port)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+//默认的属性上报间隔
+const defaultInterval = time.Second
+
+/*
+	模拟场景，通过YAML文件定义
+*/
+type Scenario struct {
+	//EdgeHub地址，如tcp://127.0.0.1:1883，为空时使用-hub参数或者环境变量
+	Hub 			string 				`yaml:"hub"`
+	//消息负载格式，支持json、cbor、protobuf，为空默认为json
+	PayloadFormat 	string 				`yaml:"payloadFormat"`
+	//模拟时长，为0时一直运行直到中断
+	Duration 		time.Duration 		`yaml:"duration"`
+	//随机数种子，为0时使用当前时间
+	Seed 			int64 				`yaml:"seed"`
+	//模拟的子设备
+	Endpoints 		[]*EndpointSpec 	`yaml:"endpoints"`
+}
+
+/*
+	子设备定义，Count大于1时生成Count个设备，设备id为DeviceId加"-序号"
+*/
+type EndpointSpec struct {
+	ThingId 	string 				`yaml:"thingId"`
+	DeviceId 	string 				`yaml:"deviceId"`
+	Count 		int 				`yaml:"count"`
+	//属性上报间隔，为0时默认为1秒
+	Interval 	time.Duration 		`yaml:"interval"`
+	Properties 	[]*PropertySpec 	`yaml:"properties"`
+	Events 		[]*EventSpec 		`yaml:"events"`
+	Services 	[]*ServiceSpec 		`yaml:"services"`
+}
+
+/*
+	属性定义，Generator为sine、random_walk、csv或constant
+*/
+type PropertySpec struct {
+	Identifier 	string 			`yaml:"identifier"`
+	Generator 	string 			`yaml:"generator"`
+	//保留的小数位数，为0时不处理
+	Precision 	int 			`yaml:"precision"`
+	//sine: Offset + Amplitude * sin(2π * t / Period)
+	Offset 		float64 		`yaml:"offset"`
+	Amplitude 	float64 		`yaml:"amplitude"`
+	Period 		time.Duration 	`yaml:"period"`
+	//random_walk: 从Start开始，每次变化不超过Step，限制在[Min, Max]之间
+	Start 		float64 		`yaml:"start"`
+	Step 		float64 		`yaml:"step"`
+	Min 		*float64 		`yaml:"min"`
+	Max 		*float64 		`yaml:"max"`
+	//csv: 按行回放CSV文件中Column列的值，第一行为列名，Loop为true时循环回放
+	File 		string 			`yaml:"file"`
+	Column 		string 			`yaml:"column"`
+	Loop 		bool 			`yaml:"loop"`
+	//constant: 固定值
+	Value 		interface{} 	`yaml:"value"`
+}
+
+/*
+	事件定义，按照Interval周期上报
+*/
+type EventSpec struct {
+	Identifier 	string 					`yaml:"identifier"`
+	Interval 	time.Duration 			`yaml:"interval"`
+	Level 		string 					`yaml:"level"`
+	Message 	string 					`yaml:"message"`
+	Params 		map[string]interface{} 	`yaml:"params"`
+}
+
+/*
+	服务调用回应定义，Identifier为"*"时回应所有未定义的服务
+*/
+type ServiceSpec struct {
+	Identifier 	string 					`yaml:"identifier"`
+	//回应状态码，为0时默认为200
+	Code 		int32 					`yaml:"code"`
+	Params 		map[string]interface{} 	`yaml:"params"`
+	//为true时回应参数包含调用参数，Params中的同名参数优先
+	Echo 		bool 					`yaml:"echo"`
+	//回应延迟
+	Delay 		time.Duration 			`yaml:"delay"`
+}
+
+//加载场景文件，CSV文件的相对路径相对于场景文件所在目录
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseScenario(data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	for _, ep := range s.Endpoints {
+		for _, prop := range ep.Properties {
+			if prop.File != "" && !filepath.IsAbs(prop.File) {
+				prop.File = filepath.Join(dir, prop.File)
+			}
+		}
+	}
+	return s, nil
+}
+
+func ParseScenario(data []byte) (*Scenario, error) {
+	s := &Scenario{}
+	err := yaml.Unmarshal(data, s)
+	if err != nil {
+		return nil, errors.New("parse scenario failed, err: " + err.Error())
+	}
+	err = s.validate()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Endpoints) == 0 {
+		return errors.New("invalid scenario: no endpoints")
+	}
+	for i, ep := range s.Endpoints {
+		if ep.ThingId == "" || ep.DeviceId == "" {
+			return fmt.Errorf("invalid scenario: endpoint %d should have thingId and deviceId", i)
+		}
+		if ep.Count < 0 || ep.Interval < 0 {
+			return fmt.Errorf("invalid scenario: endpoint %s has negative count or interval", ep.DeviceId)
+		}
+		for _, prop := range ep.Properties {
+			if prop.Identifier == "" {
+				return fmt.Errorf("invalid scenario: endpoint %s has property without identifier", ep.DeviceId)
+			}
+		}
+		for _, evt := range ep.Events {
+			if evt.Identifier == "" || evt.Interval <= 0 {
+				return fmt.Errorf("invalid scenario: endpoint %s event should have identifier and interval", ep.DeviceId)
+			}
+		}
+		for _, srv := range ep.Services {
+			if srv.Identifier == "" {
+				return fmt.Errorf("invalid scenario: endpoint %s has service without identifier", ep.DeviceId)
+			}
+		}
+	}
+	return nil
+}
+
+//展开后的设备id列表
+func (ep *EndpointSpec) deviceIds() []string {
+	if ep.Count <= 1 {
+		return []string{ep.DeviceId}
+	}
+	result := make([]string, 0, ep.Count)
+	for i := 1; i <= ep.Count; i++ {
+		result = append(result, fmt.Sprintf("%s-%d", ep.DeviceId, i))
+	}
+	return result
+}
+
+func (ep *EndpointSpec) interval() time.Duration {
+	if ep.Interval == 0 {
+		return defaultInterval
+	}
+	return ep.Interval
+}
+
+//查找服务回应定义，没有时使用"*"定义
+func (ep *EndpointSpec) service(identifier string) *ServiceSpec {
+	var fallback *ServiceSpec
+	for _, srv := range ep.Services {
+		if srv.Identifier == identifier {
+			return srv
+		}
+		if srv.Identifier == "*" {
+			fallback = srv
+		}
+	}
+	return fallback
+}
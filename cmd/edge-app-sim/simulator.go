@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/core/mqtt"
+	"github.com/satori/go.uuid"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//等待连接EdgeHub的超时时间
+const connectTimeout = 10 * time.Second
+
+/*
+	子设备模拟器，按照普通模式的topic上报属性和事件，并回应服务调用
+*/
+type simulator struct {
+	scenario 	*Scenario
+	codec 		*codec.Codec
+	mqtt 		*mqtt.MqttClient
+	devices 	map[string]*device
+	//为true时打印每条消息
+	verbose 	bool
+	connCh 		chan struct{}
+	wg 			sync.WaitGroup
+}
+
+//模拟的子设备
+type device struct {
+	spec 		*EndpointSpec
+	thingId 	string
+	deviceId 	string
+	//与spec.Properties顺序相同，nil表示该属性已经回放结束
+	generators 	[]generator
+}
+
+func newSimulator(scenario *Scenario, hubUrl string, verbose bool) (*simulator, error) {
+	payloadCodec, err := codec.NewPayloadCodec(scenario.PayloadFormat)
+	if err != nil {
+		return nil, err
+	}
+	s := &simulator{
+		scenario: scenario,
+		codec: codec.NewCodec("edge-app-sim", "", "", false),
+		devices: make(map[string]*device),
+		verbose: verbose,
+		connCh: make(chan struct{}, 1),
+	}
+	s.codec.Payload = payloadCodec
+	seed := scenario.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	index := int64(0)
+	for _, spec := range scenario.Endpoints {
+		for _, deviceId := range spec.deviceIds() {
+			d := &device{
+				spec: spec,
+				thingId: spec.ThingId,
+				deviceId: deviceId,
+				generators: make([]generator, 0, len(spec.Properties)),
+			}
+			//每个设备使用独立的随机数序列，相同的种子可以复现模拟数据
+			rnd := rand.New(rand.NewSource(seed + index))
+			index++
+			for _, prop := range spec.Properties {
+				g, err := newGenerator(prop, rnd)
+				if err != nil {
+					return nil, err
+				}
+				d.generators = append(d.generators, g)
+			}
+			key := d.thingId + "/" + d.deviceId
+			if _, ok := s.devices[key]; ok {
+				return nil, errors.New("duplicate endpoint: " + key)
+			}
+			s.devices[key] = d
+		}
+	}
+	s.mqtt, err = mqtt.NewMqttClient("edge-app-sim/"+uuid.NewV4().String(), hubUrl, s.onConnectStatus)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/*
+	连接EdgeHub并开始模拟，直到stop关闭或者达到场景的模拟时长
+*/
+func (s *simulator) run(stop <-chan struct{}) error {
+	for _, d := range s.devices {
+		if len(d.spec.Services) == 0 {
+			continue
+		}
+		topic, err := s.codec.EncodeTopic(codec.TopicType_SubService, "+", d.thingId, d.deviceId)
+		if err != nil {
+			return err
+		}
+		//原始订阅在断线重连后自动恢复
+		err = s.mqtt.SubscribeRaw(topic, s.onServiceCall)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.mqtt.Start()
+	if err != nil {
+		return err
+	}
+	defer s.mqtt.Stop()
+	select {
+	case <-s.connCh:
+	case <-stop:
+		return nil
+	case <-time.After(connectTimeout):
+		return errors.New("connect to edge hub timeout")
+	}
+	fmt.Printf("edge-app-sim started, endpoints: %d\n", len(s.devices))
+	done := make(chan struct{})
+	start := time.Now()
+	for _, d := range s.devices {
+		s.wg.Add(1)
+		go s.runProperties(d, start, done)
+		for _, evt := range d.spec.Events {
+			s.wg.Add(1)
+			go s.runEvent(d, evt, done)
+		}
+	}
+	var timeout <-chan time.Time
+	if s.scenario.Duration > 0 {
+		timeout = time.After(s.scenario.Duration)
+	}
+	select {
+	case <-stop:
+	case <-timeout:
+	}
+	close(done)
+	s.wg.Wait()
+	return nil
+}
+
+func (s *simulator) onConnectStatus(status bool, errMsg string) {
+	if !status {
+		fmt.Println("edge-app-sim disconnected, err: " + errMsg)
+		return
+	}
+	select {
+	case s.connCh <- struct{}{}:
+	default:
+	}
+}
+
+//按照设备的上报间隔上报全部属性
+func (s *simulator) runProperties(d *device, start time.Time, done chan struct{}) {
+	defer s.wg.Done()
+	if len(d.generators) == 0 {
+		return
+	}
+	ticker := time.NewTicker(d.spec.interval())
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		props := make([]*common.AppSdkMsgProperty, 0, len(d.generators))
+		for i, g := range d.generators {
+			if g == nil {
+				continue
+			}
+			value, ok := g.next(now.Sub(start))
+			if !ok {
+				d.generators[i] = nil
+				continue
+			}
+			props = append(props, &common.AppSdkMsgProperty{
+				Identifier: d.spec.Properties[i].Identifier,
+				Timestamp: now.UnixNano() / int64(time.Millisecond),
+				Value: value,
+			})
+		}
+		if len(props) > 0 {
+			data, _ := json.Marshal(props)
+			s.publish(codec.TopicType_PubProperty, d, data)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *simulator) runEvent(d *device, spec *EventSpec, done chan struct{}) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(spec.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			evt := &common.AppSdkMsgEvent{
+				Identifier: spec.Identifier,
+				Timestamp: now.UnixNano() / int64(time.Millisecond),
+				Params: spec.Params,
+				Level: common.EventLevel(spec.Level),
+				Message: spec.Message,
+			}
+			if evt.Params == nil {
+				evt.Params = make(map[string]interface{})
+			}
+			data, _ := json.Marshal(evt)
+			s.publish(codec.TopicType_PubEvent, d, data)
+		}
+	}
+}
+
+//按照场景定义回应服务调用，没有定义的服务不回应
+func (s *simulator) onServiceCall(topic string, payload []byte) {
+	decoded, err := s.codec.Decode(topic, payload)
+	if err != nil {
+		fmt.Println("edge-app-sim decode service call failed, topic: " + topic + ", err: " + err.Error())
+		return
+	}
+	if decoded.TopicType != codec.TopicType_SubService {
+		return
+	}
+	d, ok := s.devices[decoded.ThingId+"/"+decoded.DeviceId]
+	if !ok {
+		return
+	}
+	call := &common.AppSdkMsgServiceCall{}
+	err = json.Unmarshal(decoded.Payload, call)
+	if err != nil {
+		fmt.Println("edge-app-sim decode service call failed, err: " + err.Error())
+		return
+	}
+	spec := d.spec.service(call.Identifier)
+	if spec == nil {
+		if s.verbose {
+			fmt.Printf("edge-app-sim ignore service call, device: %s, identifier: %s\n", d.deviceId, call.Identifier)
+		}
+		return
+	}
+	reply := buildReply(spec, call)
+	data, _ := json.Marshal(reply)
+	if spec.Delay > 0 {
+		time.AfterFunc(spec.Delay, func() {
+			s.publish(codec.TopicType_PubServiceReply, d, data)
+		})
+		return
+	}
+	s.publish(codec.TopicType_PubServiceReply, d, data)
+}
+
+func buildReply(spec *ServiceSpec, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply {
+	reply := &common.AppSdkMsgServiceReply{
+		MessageId: call.MessageId,
+		Identifier: call.Identifier,
+		Code: spec.Code,
+		Params: make(map[string]interface{}),
+	}
+	if reply.Code == 0 {
+		reply.Code = 200
+	}
+	if spec.Echo {
+		for k, v := range call.Params {
+			reply.Params[k] = v
+		}
+	}
+	for k, v := range spec.Params {
+		reply.Params[k] = v
+	}
+	return reply
+}
+
+func (s *simulator) publish(topicType string, d *device, data []byte) {
+	topic, payload, err := s.codec.EncodeMessage(topicType, d.thingId, d.deviceId, data)
+	if err != nil {
+		fmt.Println("edge-app-sim encode message failed, err: " + err.Error())
+		return
+	}
+	err = s.mqtt.Publish(topic, 0, payload)
+	if err != nil {
+		fmt.Println("edge-app-sim publish message failed, topic: " + topic + ", err: " + err.Error())
+		return
+	}
+	if s.verbose {
+		fmt.Println(topic, string(data))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/testhub"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 3 * time.Second
+
+func TestSimulator(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := testhub.NewHub(&testhub.Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) || !assert.Nil(hub.Setenv()) {
+		return
+	}
+	defer hub.Close()
+	scenario, err := LoadScenario("testdata/scenario.yaml")
+	if !assert.Nil(err) {
+		return
+	}
+	sim, err := newSimulator(scenario, fmt.Sprintf("tcp://%s:%d", hub.HubAddr(), hub.HubPort()), false)
+	if !assert.Nil(err) {
+		return
+	}
+	stop := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- sim.run(stop)
+	}()
+	defer func() {
+		close(stop)
+		assert.Nil(<-errCh)
+	}()
+
+	msgCh := make(chan *common.AppSdkMessageData, 100)
+	client, err := edge_app_go.NewClient(&edge_app_go.Options{
+		Type: common.AppSdkRuntimeType_Docker,
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			select {
+			case msgCh <- data:
+			default:
+			}
+		},
+		EndpointThingIds: []string{"iott-meter"},
+	})
+	if !assert.Nil(err) || !assert.Nil(client.Init()) || !assert.Nil(client.Start()) {
+		return
+	}
+	defer client.Cleanup()
+	callTopic, _ := hub.Topic(codec.TopicType_SubService, "+", "iott-meter", "iotd-meter-2")
+	propTopic, _ := hub.Topic(codec.TopicType_SubProperty, "", "iott-meter", "+")
+	if !assert.Nil(hub.WaitSubscribed(callTopic, waitTimeout)) || !assert.Nil(hub.WaitSubscribed(propTopic, waitTimeout)) {
+		return
+	}
+
+	//属性和事件
+	gotProps, gotEvent := false, false
+	deadline := time.After(waitTimeout)
+	for !gotProps || !gotEvent {
+		select {
+		case data := <-msgCh:
+			assert.Equal("iott-meter", data.ThingId)
+			switch data.Type {
+			case common.AppSdkMessageType_Property:
+				props := make([]*common.AppSdkMsgProperty, 0)
+				if assert.Nil(json.Unmarshal(data.Payload, &props)) {
+					assert.Len(props, 4)
+				}
+				gotProps = true
+			case common.AppSdkMessageType_Event:
+				evt := &common.AppSdkMsgEvent{}
+				if assert.Nil(json.Unmarshal(data.Payload, evt)) {
+					assert.Equal("alarm", evt.Identifier)
+					assert.Equal(common.EventLevel_Warn, evt.Level)
+				}
+				gotEvent = true
+			}
+		case <-deadline:
+			t.Fatal("wait for simulated messages timeout")
+		}
+	}
+
+	//服务调用
+	reply, err := client.CallEndpoint("iott-meter", "iotd-meter-2", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	if assert.Nil(err) {
+		assert.EqualValues(200, reply.Code)
+		assert.Equal("ok", reply.Params["result"])
+	}
+	reply, err = client.CallEndpoint("iott-meter", "iotd-meter-1", &common.AppSdkMsgServiceCall{
+		Identifier: "close",
+		Params: map[string]interface{}{"force": true},
+	})
+	if assert.Nil(err) {
+		assert.EqualValues(400, reply.Code)
+		assert.Equal(true, reply.Params["force"])
+	}
+}
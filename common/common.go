@@ -1,11 +1,77 @@
 package common
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 //消息处理回调定义
 type AppSdkMessageCB func(*AppSdkMessageData, interface{})
 
 //SDK事件处理回调定义
 type AppSdkEventCB func(*AppSdkEventData, interface{})
 
+//属性设置处理回调定义，返回nil表示设置成功，否则回应失败
+type AppSdkPropertySetHandler func([]*AppSdkMsgProperty) error
+
+//带context的属性设置处理回调定义，ctx在处理完成或者SDK停止时取消
+type AppSdkPropertySetHandlerContext func(ctx context.Context, props []*AppSdkMsgProperty) error
+
+//设备影子差异回调定义，参数为期望值与上报值不一致的属性
+type AppSdkShadowDeltaCB func([]*AppSdkMsgProperty)
+
+//原始mqtt消息处理回调定义，参数为topic和原始payload
+type AppSdkRawMessageCB func(string, []byte)
+
+//按照模型id、设备id和标识id注册的模型消息处理函数定义
+type AppSdkMessageHandler func(*AppSdkMessageData)
+
+//带context的模型消息处理函数定义，ctx在处理完成或者SDK停止时取消
+type AppSdkMessageHandlerContext func(ctx context.Context, msg *AppSdkMessageData)
+
+/*
+	消息拦截器定义，可以检查或者直接修改msg，返回ErrMessageDropped表示丢弃消息，返回其他错误时同样丢弃消息，
+	发送消息和调用子设备服务时错误包装后返回给调用者，可以通过errors.Is(err, ErrMessageDropped)判断；ctx为发送消息时传入的context，接收消息时为每条消息单独创建的context，
+	在消息处理完成或者SDK停止时取消
+*/
+type AppSdkInterceptor func(ctx context.Context, direction MessageDirection, msg *AppSdkMessageData) error
+
+//拦截器丢弃消息
+var ErrMessageDropped = errors.New("message dropped by interceptor")
+
+/*
+	context取消或者超时导致操作失败时返回的错误，Err为context.Canceled或context.DeadlineExceeded，
+	可以通过errors.Is(err, context.Canceled)判断，或者通过errors.As获取失败的操作
+*/
+type AppSdkContextError struct {
+	//失败的操作，如SendMessage、CallEndpoint
+	Op 			string
+	Err 		error
+}
+
+func (e *AppSdkContextError) Error() string {
+	return "APP SDK " + e.Op + " failed, err: " + e.Err.Error()
+}
+
+func (e *AppSdkContextError) Unwrap() error {
+	return e.Err
+}
+
+/*
+	消息方向枚举定义
+*/
+type MessageDirection int32
+
+const (
+	//未知方向
+	MessageDirection_Unknown MessageDirection = iota
+	//收到的消息
+	MessageDirection_Inbound
+	//发送的消息
+	MessageDirection_Outbound
+)
+
 /*
 	应用类型枚举定义
 */
@@ -22,6 +88,20 @@ const (
 
 type MessageModelType int32
 
+/*
+	物模型校验模式枚举定义
+*/
+type ValidateMode int32
+
+const (
+	//不校验
+	ValidateMode_None ValidateMode = iota
+	//校验失败时只打印警告，消息正常发送
+	ValidateMode_Warn
+	//校验失败时拒绝发送或者接收消息
+	ValidateMode_Strict
+)
+
 /*
 	消息数据类型和消息数据结构定义
 */
@@ -38,6 +118,10 @@ const (
 	AppSdkMessageType_ServiceCall
 	//服务调用消息回应
 	AppSdkMessageType_ServiceReply
+	//属性设置消息
+	AppSdkMessageType_PropertySet
+	//属性设置消息回应
+	AppSdkMessageType_PropertySetReply
 )
 
 //消息数据结构体
@@ -59,14 +143,50 @@ type AppSdkMessageData struct {
 		1. 当为AppSdkMessageType_Property类型时，Payload内容格式为[]*AppSdkMsgProperty通过JSON序列化之后的字符串，如下：
 			`[{"identifier":"id_prop_01","timestamp":1593274999806,"value":"aaaaaa"},{"identifier":"id_prop_02","timestamp":1593274999806,"value":"bbbbbb"}]`
 		2. 当为AppSdkMessageType_Event类型时，Payload内容格式为*AppSdkMsgEvent通过JSON序列花之后的字符串，如下:
-			`{"identifier":"test_event_001","timestamp":1593274999806,"params":{"param1":"aaa","param2":20,"param3":"ccc"}}`
+			`{"identifier":"test_event_001","timestamp":1593274999806,"params":{"param1":"aaa","param2":20,"param3":"ccc"},"level":"warn","message":"xxx"}`
+			其中level和message可为空
 		3. 当为AppSdkMessageType_ServiceCall类型时，Payload内容格式为*AppSdkMsgServiceCall序列化之后的字符串，如下:
 			`{"messageId":"40682013-308D-43DF-B2A3-819D5CDB08BD","identifier":"test_service_001","params":{"param1":"aaa","param2":20,"param3":"ccc"}}`
 		4. 当为AppSdkMessageType_ServiceReply类型时，Payload内容格式为*AppSdkMsgServiceReply序列化之后的字符串，如下:
 			`{"messageId":"40682013-308D-43DF-B2A3-819D5CDB08BD","identifier":"test_service_001","code":200,"params":{"param1":"aaa","param2":20,"param3":"ccc"}}`
-		5. 其他类型，暂不支持，payload为nil
+		5. 当为AppSdkMessageType_PropertySet类型时，Payload内容格式为*AppSdkMsgPropertySet序列化之后的字符串，如下:
+			`{"messageId":"40682013-308D-43DF-B2A3-819D5CDB08BD","properties":[{"identifier":"id_prop_01","timestamp":1593274999806,"value":"aaaaaa"}]}`
+		6. 当为AppSdkMessageType_PropertySetReply类型时，Payload内容格式为*AppSdkMsgPropertySetReply序列化之后的字符串，如下:
+			`{"messageId":"40682013-308D-43DF-B2A3-819D5CDB08BD","code":200}`
+		7. 其他类型，暂不支持，payload为nil
 	*/
 	Payload 		[]byte					`json:"payload"`
+	/*
+		收到的消息的MDMP消息格式版本号，发送消息时不需要设置
+	*/
+	Version 		string 							`json:"version,omitempty"`
+	/*
+		收到的消息的消息id，可用于消息去重
+	*/
+	MessageId 		string 							`json:"messageId,omitempty"`
+	/*
+		收到的消息的设备源，记录消息经过的设备或应用
+	*/
+	Source 			[]string 						`json:"source,omitempty"`
+	/*
+		收到的属性和事件消息的采样时间戳，单位为毫秒，可用于计算消息延迟
+	*/
+	EpochTime 		int64 							`json:"epochTime,omitempty"`
+	/*
+		收到的消息的原始消息类型，如thing.event.{identifier}.post
+	*/
+	RawType 		string 							`json:"rawType,omitempty"`
+}
+
+//发送消息的元信息
+type AppSdkMessageMeta struct {
+	//设备源，只对属性和事件消息有效
+	Source 			[]string
+	/*
+		属性消息使用批量格式(thing.property.batch.post)，同一属性的多个采样值按照时间戳排序后全部发送；
+		为false时使用thing.property.post格式，同一属性有多个值时只保留最后一个
+	*/
+	Batch 			bool
 }
 
 //属性消息结构体，AppSdkMessageType为AppSdkMessageType_Property时的payload
@@ -74,6 +194,37 @@ type AppSdkMsgProperty struct {
 	Identifier 		string 					`json:"identifier"`
 	Timestamp 		int64 					`json:"timestamp"`
 	Value 			interface{}				`json:"value"`
+	//属性单位，可为空，只用于本地和物模型定义进行校验，不会发送到平台
+	Unit 			string 					`json:"unit,omitempty"`
+}
+
+/*
+	模型事件级别定义
+*/
+type EventLevel string
+
+const (
+	//信息
+	EventLevel_Info 	EventLevel = "info"
+	//警告
+	EventLevel_Warn 	EventLevel = "warn"
+	//错误
+	EventLevel_Error 	EventLevel = "error"
+	//严重
+	EventLevel_Critical EventLevel = "critical"
+)
+
+//事件级别的严重程度，用于按级别过滤事件，为空或者未知的级别按照info处理
+func (l EventLevel) Severity() int {
+	switch l {
+	case EventLevel_Warn:
+		return 2
+	case EventLevel_Error:
+		return 3
+	case EventLevel_Critical:
+		return 4
+	}
+	return 1
 }
 
 //事件消息结构体，AppSdkMessageType为AppSdkMessageType_Event时的payload
@@ -81,6 +232,10 @@ type AppSdkMsgEvent struct {
 	Identifier 		string 					`json:"identifier"`
 	Timestamp 		int64 					`json:"timestamp"`
 	Params 			map[string]interface{} 	`json:"params"`
+	//事件级别，可为空
+	Level 			EventLevel 				`json:"level,omitempty"`
+	//事件信息，可为空
+	Message 		string 					`json:"message,omitempty"`
 }
 
 //服务调用消息结构体，AppSdkMessageType为AppSdkMessageType_ServiceCall时的payload
@@ -98,6 +253,20 @@ type AppSdkMsgServiceReply struct {
 	Params 			map[string]interface{} 	`json:"params"`
 }
 
+//属性设置消息结构体，AppSdkMessageType为AppSdkMessageType_PropertySet时的payload
+type AppSdkMsgPropertySet struct {
+	MessageId 		string 					`json:"messageId"`
+	Properties 		[]*AppSdkMsgProperty 	`json:"properties"`
+}
+
+//属性设置回应结构体，AppSdkMessageType为AppSdkMessageType_PropertySetReply时的payload
+type AppSdkMsgPropertySetReply struct {
+	MessageId 		string 					`json:"messageId"`
+	Code			int32 					`json:"code"`
+	//失败原因，可为空
+	Message 		string 					`json:"message,omitempty"`
+}
+
 /*
 	SDK事件类型和事件数据结构定义
 */
@@ -110,6 +279,10 @@ const (
 	EventType_Connected
 	//连接断开事件
 	EventType_Disconnected
+	//消息解码失败或者未知消息事件，Payload为*AppSdkDecodeError
+	EventType_DecodeError
+	//应用回调函数panic事件，Payload为*AppSdkCallbackPanic
+	EventType_CallbackPanic
 )
 
 //SDK事件结构体
@@ -124,3 +297,55 @@ type AppSdkEventData struct {
 	Payload 	interface{}
 }
 
+//解码失败的消息，EventType为EventType_DecodeError时的事件数据
+type AppSdkDecodeError struct {
+	//消息topic
+	Topic 		string
+	//原始消息数据
+	Payload 	[]byte
+	//失败原因
+	Err 		error
+	//是否为无法识别的消息类型，为false表示消息解码失败
+	Unknown 	bool
+}
+
+func (e *AppSdkDecodeError) Error() string {
+	return "decode message of topic " + e.Topic + " failed: " + e.Err.Error()
+}
+
+func (e *AppSdkDecodeError) Unwrap() error {
+	return e.Err
+}
+
+//回调函数panic的信息，EventType为EventType_CallbackPanic时的事件数据
+type AppSdkCallbackPanic struct {
+	//回调函数名称，如MessageCB、MessageHandler、Interceptor、PropertySetHandler、ShadowDeltaCB和RawMessageCB
+	Callback 	string
+	//正在处理的消息类型，与消息无关的回调为AppSdkMessageType_Unknown
+	Type 		AppSdkMessageType
+	//正在处理的消息topic，与消息无关的回调为空
+	Topic 		string
+	//recover得到的panic值
+	Value 		interface{}
+	//panic时的调用栈
+	Stack 		[]byte
+}
+
+func (e *AppSdkCallbackPanic) Error() string {
+	msg := fmt.Sprintf("%s panic: %v", e.Callback, e.Value)
+	if e.Topic != "" {
+		msg += ", topic: " + e.Topic
+	}
+	return msg
+}
+
+//消息接收统计
+type AppSdkMessageStats struct {
+	//收到的模型消息总数
+	Received 		uint64
+	//解码失败的消息数
+	DecodeErrors 	uint64
+	//无法识别类型的消息数
+	Unknown 		uint64
+}
+
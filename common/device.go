@@ -34,4 +34,19 @@ type EndpointInfo struct {
 	ThingId 			string			`json:"thingId"`
 	//设备凭证
 	Token 				string 			`json:"token"`
-}
\ No newline at end of file
+}
+/*
+	子设备消息订阅过滤条件，为空的字段表示不做限制
+*/
+type EndpointFilter struct {
+	//模型id
+	ThingId 			string			`json:"thingId"`
+	//只订阅指定设备id的消息
+	DeviceIds 			[]string		`json:"deviceIds"`
+	//只接收指定标识id的属性，属性topic中不包含标识id，所以在接收时过滤
+	PropertyIds 		[]string		`json:"propertyIds"`
+	//只订阅指定标识id的事件
+	EventIds 			[]string		`json:"eventIds"`
+	//只接收不低于此级别的事件，为空时不过滤，事件级别不在topic中，所以在接收时过滤
+	MinEventLevel 		EventLevel		`json:"minEventLevel"`
+}
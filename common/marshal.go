@@ -0,0 +1,391 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	结构体标签格式：`edge:"identifier,unit=C,omitempty"`
+	identifier为物模型标识id，为"-"时忽略该字段；unit为属性单位；omitempty表示零值时不转换；
+	没有edge标签的字段不参与转换
+*/
+const structTagName = "edge"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//结构体字段标签信息
+type fieldTag struct {
+	identifier 	string
+	unit 		string
+	omitEmpty 	bool
+}
+
+func parseFieldTag(field reflect.StructField) (*fieldTag, bool) {
+	tag, ok := field.Tag.Lookup(structTagName)
+	if !ok || tag == "-" || field.PkgPath != "" {
+		return nil, false
+	}
+	parts := strings.Split(tag, ",")
+	result := &fieldTag{identifier: parts[0]}
+	if result.identifier == "" {
+		result.identifier = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			result.omitEmpty = true
+		} else if strings.HasPrefix(opt, "unit=") {
+			result.unit = strings.TrimPrefix(opt, "unit=")
+		}
+	}
+	return result, true
+}
+
+//将带edge标签的结构体转换为属性消息，所有属性使用相同的时间戳
+func MarshalProperties(v interface{}, timestamp int64) ([]*AppSdkMsgProperty, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	props := make([]*AppSdkMsgProperty, 0)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag, ok := parseFieldTag(rt.Field(i))
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if tag.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		value, err := marshalValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("marshal property %s failed: %s", tag.identifier, err.Error())
+		}
+		props = append(props, &AppSdkMsgProperty{
+			Identifier: tag.identifier,
+			Timestamp: timestamp,
+			Value: value,
+			Unit: tag.unit,
+		})
+	}
+	return props, nil
+}
+
+//将带edge标签的结构体转换为事件或者服务调用参数
+func MarshalParams(v interface{}) (map[string]interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, err
+	}
+	value, err := marshalValue(rv)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("marshal source should be a struct with edge tags")
+	}
+	return params, nil
+}
+
+//将属性消息解析到带edge标签的结构体，v必须是结构体指针
+func UnmarshalProperties(props []*AppSdkMsgProperty, v interface{}) error {
+	params := make(map[string]interface{})
+	for _, prop := range props {
+		if prop == nil {
+			continue
+		}
+		params[prop.Identifier] = prop.Value
+	}
+	return UnmarshalParams(params, v)
+}
+
+//将事件或者服务调用参数解析到带edge标签的结构体，v必须是结构体指针，
+//JSON数字会转换为对应的整型或浮点型，字符串和毫秒时间戳会转换为time.Time
+func UnmarshalParams(params map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("unmarshal target should be a non-nil struct pointer")
+	}
+	return unmarshalStruct(params, rv.Elem())
+}
+
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}, errors.New("marshal source should not be nil")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, errors.New("marshal source should be a struct")
+	}
+	return rv, nil
+}
+
+//转换为可以JSON序列化的值，嵌套的带edge标签的结构体转换为map，time.Time转换为毫秒时间戳
+func marshalValue(fv reflect.Value) (interface{}, error) {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	}
+	if fv.Type() == timeType {
+		return fv.Interface().(time.Time).UnixNano() / 1e6, nil
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if !hasEdgeTags(fv.Type()) {
+			return fv.Interface(), nil
+		}
+		result := make(map[string]interface{})
+		rt := fv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			tag, ok := parseFieldTag(rt.Field(i))
+			if !ok {
+				continue
+			}
+			if tag.omitEmpty && isEmptyValue(fv.Field(i)) {
+				continue
+			}
+			value, err := marshalValue(fv.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			result[tag.identifier] = value
+		}
+		return result, nil
+	case reflect.Slice, reflect.Array:
+		if fv.Kind() == reflect.Slice && fv.IsNil() {
+			return nil, nil
+		}
+		result := make([]interface{}, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			value, err := marshalValue(fv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	}
+	return fv.Interface(), nil
+}
+
+func unmarshalStruct(params map[string]interface{}, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag, ok := parseFieldTag(rt.Field(i))
+		if !ok {
+			continue
+		}
+		value, ok := params[tag.identifier]
+		if !ok {
+			continue
+		}
+		err := setValue(rv.Field(i), value)
+		if err != nil {
+			return fmt.Errorf("unmarshal %s failed: %s", tag.identifier, err.Error())
+		}
+	}
+	return nil
+}
+
+//按照目标类型转换并赋值
+func setValue(fv reflect.Value, value interface{}) error {
+	if value == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		elem := reflect.New(fv.Type().Elem())
+		err := setValue(elem.Elem(), value)
+		if err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := toTime(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, err := ToFloat(value)
+		if err != nil {
+			return err
+		}
+		if num != float64(int64(num)) || fv.OverflowInt(int64(num)) {
+			return fmt.Errorf("%v overflows %s", value, fv.Type())
+		}
+		fv.SetInt(int64(num))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, err := ToFloat(value)
+		if err != nil {
+			return err
+		}
+		if num < 0 || num != float64(uint64(num)) || fv.OverflowUint(uint64(num)) {
+			return fmt.Errorf("%v overflows %s", value, fv.Type())
+		}
+		fv.SetUint(uint64(num))
+	case reflect.Float32, reflect.Float64:
+		num, err := ToFloat(value)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(num)
+	case reflect.Bool:
+		switch v := value.(type) {
+		case bool:
+			fv.SetBool(v)
+		default:
+			num, err := ToFloat(value)
+			if err != nil {
+				return fmt.Errorf("cannot convert %T to bool", value)
+			}
+			fv.SetBool(num != 0)
+		}
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			fv.SetString(v)
+		case json.Number:
+			fv.SetString(v.String())
+		default:
+			fv.SetString(fmt.Sprint(v))
+		}
+	case reflect.Struct:
+		params, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot convert %T to %s", value, fv.Type())
+		}
+		if hasEdgeTags(fv.Type()) {
+			return unmarshalStruct(params, fv)
+		}
+		return convertByJSON(params, fv)
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return convertByJSON(value, fv)
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			err := setValue(slice.Index(i), item)
+			if err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+	case reflect.Map:
+		params, ok := value.(map[string]interface{})
+		if !ok || fv.Type().Key().Kind() != reflect.String {
+			return convertByJSON(value, fv)
+		}
+		m := reflect.MakeMapWithSize(fv.Type(), len(params))
+		for k, item := range params {
+			elem := reflect.New(fv.Type().Elem()).Elem()
+			err := setValue(elem, item)
+			if err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(fv.Type().Key()), elem)
+		}
+		fv.Set(m)
+	case reflect.Interface:
+		if !reflect.TypeOf(value).AssignableTo(fv.Type()) {
+			return fmt.Errorf("cannot convert %T to %s", value, fv.Type())
+		}
+		fv.Set(reflect.ValueOf(value))
+	default:
+		return convertByJSON(value, fv)
+	}
+	return nil
+}
+
+//其他类型通过JSON序列化转换
+func convertByJSON(value interface{}, fv reflect.Value) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, fv.Addr().Interface())
+}
+
+/*
+	将数值转换为float64，支持所有整型和浮点型(包括以数值类型为底层类型的自定义类型)、json.Number和数字字符串，
+	数值可能来自JSON解码(float64、json.Number)或者应用直接赋值(各种整型)
+*/
+func ToFloat(value interface{}) (float64, error) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		//json.Number的底层类型同样为string
+		return strconv.ParseFloat(rv.String(), 64)
+	}
+	return 0, fmt.Errorf("cannot convert %T to number", value)
+}
+
+//支持RFC3339格式字符串、数字字符串和毫秒时间戳
+func toTime(value interface{}) (time.Time, error) {
+	if str, ok := value.(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err == nil {
+			return t, nil
+		}
+	}
+	ms, err := ToFloat(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot convert %v to time", value)
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+}
+
+func hasEdgeTags(rt reflect.Type) bool {
+	for i := 0; i < rt.NumField(); i++ {
+		if _, ok := rt.Field(i).Tag.Lookup(structTagName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testLocation struct {
+	Lat 		float64 		`edge:"lat"`
+	Lng 		float64 		`edge:"lng"`
+}
+
+type testReading struct {
+	Temperature 	float64 		`edge:"temperature,unit=C"`
+	Count 			int 			`edge:"count"`
+	Status 			string 			`edge:"status,omitempty"`
+	UpdatedAt 		time.Time 		`edge:"updated_at"`
+	Location 		*testLocation 	`edge:"location"`
+	Ignored 		string
+}
+
+func TestMarshalProperties(t *testing.T) {
+	assert := assert.New(t)
+	reading := &testReading{
+		Temperature: 25.5,
+		Count: 3,
+		UpdatedAt: time.Unix(1593274999, 806000000),
+		Location: &testLocation{Lat: 30.5, Lng: 114.3},
+		Ignored: "ignored",
+	}
+	props, err := MarshalProperties(reading, 1593274999806)
+	if !assert.Nil(err) {
+		return
+	}
+	payload, _ := json.Marshal(props)
+	assert.Equal(`[{"identifier":"temperature","timestamp":1593274999806,"value":25.5,"unit":"C"},`+
+		`{"identifier":"count","timestamp":1593274999806,"value":3},`+
+		`{"identifier":"updated_at","timestamp":1593274999806,"value":1593274999806},`+
+		`{"identifier":"location","timestamp":1593274999806,"value":{"lat":30.5,"lng":114.3}}]`, string(payload))
+}
+
+func TestUnmarshalProperties(t *testing.T) {
+	assert := assert.New(t)
+	src := `[{"identifier":"temperature","timestamp":1593274999806,"value":25.5},` +
+		`{"identifier":"count","timestamp":1593274999806,"value":3},` +
+		`{"identifier":"status","timestamp":1593274999806,"value":"ok"},` +
+		`{"identifier":"updated_at","timestamp":1593274999806,"value":"2020-06-27T16:23:19Z"},` +
+		`{"identifier":"location","timestamp":1593274999806,"value":{"lat":30.5,"lng":114.3}}]`
+	props := make([]*AppSdkMsgProperty, 0)
+	if !assert.Nil(json.Unmarshal([]byte(src), &props)) {
+		return
+	}
+	reading := &testReading{}
+	if !assert.Nil(UnmarshalProperties(props, reading)) {
+		return
+	}
+	assert.Equal(25.5, reading.Temperature)
+	assert.Equal(3, reading.Count)
+	assert.Equal("ok", reading.Status)
+	assert.Equal(int64(1593274999), reading.UpdatedAt.Unix())
+	if assert.NotNil(reading.Location) {
+		assert.Equal(114.3, reading.Location.Lng)
+	}
+	assert.NotNil(UnmarshalParams(map[string]interface{}{"count": 1.5}, reading))
+}
+
+type testLevel uint8
+
+type testCounters struct {
+	Small 		int8 		`edge:"small"`
+	Medium 		int16 		`edge:"medium"`
+	Count 		uint 		`edge:"count"`
+	Byte 		uint8 		`edge:"byte"`
+	Word 		uint16 		`edge:"word"`
+	Level 		testLevel 	`edge:"level"`
+	Ratio 		float32 	`edge:"ratio"`
+}
+
+func TestMarshalParams(t *testing.T) {
+	assert := assert.New(t)
+	params, err := MarshalParams(&testLocation{Lat: 30.5, Lng: 114.3})
+	if assert.Nil(err) {
+		assert.Equal(map[string]interface{}{"lat": 30.5, "lng": 114.3}, params)
+	}
+	//没有edge标签的结构体和非结构体返回错误
+	_, err = MarshalParams(struct{ Name string }{Name: "test"})
+	assert.NotNil(err)
+	_, err = MarshalParams(25)
+	assert.NotNil(err)
+	_, err = MarshalParams(nil)
+	assert.NotNil(err)
+}
+
+func TestUnmarshalParams_Numbers(t *testing.T) {
+	assert := assert.New(t)
+	params := map[string]interface{}{
+		"small": int8(-3),
+		"medium": int16(300),
+		"count": uint(7),
+		"byte": uint8(200),
+		"word": uint16(60000),
+		"level": testLevel(2),
+		"ratio": json.Number("0.5"),
+	}
+	counters := &testCounters{}
+	if assert.Nil(UnmarshalParams(params, counters)) {
+		assert.Equal(&testCounters{Small: -3, Medium: 300, Count: 7, Byte: 200, Word: 60000, Level: 2, Ratio: 0.5}, counters)
+	}
+	assert.NotNil(UnmarshalParams(map[string]interface{}{"byte": 256}, counters))
+	assert.NotNil(UnmarshalParams(map[string]interface{}{"count": true}, counters))
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"runtime/debug"
+)
+
+/*
+	应用回调函数在mqtt客户端的goroutine中执行，回调函数panic会导致整个应用退出，
+	所有回调都通过以下函数调用，recover之后打印调用栈并通过EventType_CallbackPanic事件通知应用，继续处理后续消息
+*/
+
+//调用MessageCB
+func (c *AppCoreClient) callMessageCB(topic string, msg *common.AppSdkMessageData) {
+	if c.messageCB == nil {
+		return
+	}
+	defer c.recoverCallback("MessageCB", msg.Type, topic)
+	c.messageCB(msg, c.messageParam)
+}
+
+//调用注册的消息处理函数
+func (c *AppCoreClient) callMessageHandler(ctx context.Context, topic string, handler common.AppSdkMessageHandlerContext, msg *common.AppSdkMessageData) {
+	defer c.recoverCallback("MessageHandler", msg.Type, topic)
+	handler(ctx, msg)
+}
+
+//调用EventCB，EventCB自身panic时只打印日志，不再回调EventCB
+func (c *AppCoreClient) callEventCB(evt *common.AppSdkEventData) {
+	if c.eventCB == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("APP SDK callback EventCB panic: %v, event type: %d\n%s", r, evt.Type, debug.Stack())
+		}
+	}()
+	c.eventCB(evt, c.eventParam)
+}
+
+//调用属性设置处理函数，panic时返回错误，按照处理失败回应
+func (c *AppCoreClient) callPropertySetHandler(ctx context.Context, topic string, handler common.AppSdkPropertySetHandlerContext, props []*common.AppSdkMsgProperty) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = c.reportPanic("PropertySetHandler", common.AppSdkMessageType_PropertySet, topic, r)
+		}
+	}()
+	return handler(ctx, props)
+}
+
+//调用消息拦截器，panic时返回错误
+func (c *AppCoreClient) callInterceptor(ctx context.Context, direction common.MessageDirection, topic string, interceptor common.AppSdkInterceptor, msg *common.AppSdkMessageData) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = c.reportPanic("Interceptor", msg.Type, topic, r)
+		}
+	}()
+	return interceptor(ctx, direction, msg)
+}
+
+//包装设备影子差异回调
+func (c *AppCoreClient) wrapShadowDeltaCB(cb common.AppSdkShadowDeltaCB) common.AppSdkShadowDeltaCB {
+	if cb == nil {
+		return nil
+	}
+	return func(delta []*common.AppSdkMsgProperty) {
+		defer c.recoverCallback("ShadowDeltaCB", common.AppSdkMessageType_PropertySet, "")
+		cb(delta)
+	}
+}
+
+//包装原始消息回调
+func (c *AppCoreClient) wrapRawMessageCB(handler common.AppSdkRawMessageCB) func(string, []byte) {
+	return func(topic string, payload []byte) {
+		defer c.recoverCallback("RawMessageCB", common.AppSdkMessageType_Unknown, topic)
+		handler(topic, payload)
+	}
+}
+
+//需要在defer中直接调用
+func (c *AppCoreClient) recoverCallback(callback string, msgType common.AppSdkMessageType, topic string) {
+	if r := recover(); r != nil {
+		c.reportPanic(callback, msgType, topic, r)
+	}
+}
+
+func (c *AppCoreClient) reportPanic(callback string, msgType common.AppSdkMessageType, topic string, value interface{}) *common.AppSdkCallbackPanic {
+	info := &common.AppSdkCallbackPanic{
+		Callback: callback,
+		Type: msgType,
+		Topic: topic,
+		Value: value,
+		Stack: debug.Stack(),
+	}
+	fmt.Printf("APP SDK callback %s, message type: %d\n%s", info.Error(), msgType, info.Stack)
+	c.callEventCB(&common.AppSdkEventData{
+		Type: common.EventType_CallbackPanic,
+		Payload: info,
+	})
+	return info
+}
@@ -0,0 +1,467 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+//解码时允许的最大嵌套层数
+const maxPayloadDepth = 64
+
+/*
+	CBOR主类型定义
+*/
+const (
+	cborMajorUint 		= 0
+	cborMajorNegInt 	= 1
+	cborMajorBytes 		= 2
+	cborMajorText 		= 3
+	cborMajorArray 		= 4
+	cborMajorMap 		= 5
+	cborMajorTag 		= 6
+	cborMajorSimple 	= 7
+)
+
+var errCBORTruncated = errors.New("invalid cbor payload: unexpected end of data")
+
+//CBOR自描述标签(RFC 8949 3.4.6)，标准的CBOR解码器会直接忽略该标签，用于识别CBOR格式的负载
+var cborSelfDescribe = []byte{0xd9, 0xd9, 0xf7}
+
+/*
+	按照encoding/json的规则直接编码Go值：结构体按照json标签编码为map，整数编码为CBOR整数，
+	[]byte编码为字节串，map按照key排序保证编码结果确定
+*/
+func cborEncode(buf *bytes.Buffer, rv reflect.Value, depth int) error {
+	if depth > maxPayloadDepth {
+		return errors.New("cbor: nesting too deep")
+	}
+	if !rv.IsValid() {
+		buf.WriteByte(0xf6)
+		return nil
+	}
+	if rv.Type() == jsonNumberType {
+		value, err := parseNumber(json.Number(rv.String()))
+		if err != nil {
+			return err
+		}
+		return cborEncode(buf, reflect.ValueOf(value), depth)
+	}
+	if value, ok, err := marshalerValue(rv); ok {
+		if err != nil {
+			return err
+		}
+		return cborEncode(buf, reflect.ValueOf(value), depth+1)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		return cborEncode(buf, rv.Elem(), depth+1)
+	case reflect.Bool:
+		if rv.Bool() {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		cborEncodeInt(buf, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		cborEncodeHead(buf, cborMajorUint, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		if _, err := checkFloat(rv.Float()); err != nil {
+			return err
+		}
+		cborEncodeFloat(buf, rv.Float())
+	case reflect.String:
+		cborEncodeHead(buf, cborMajorText, uint64(rv.Len()))
+		buf.WriteString(rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			cborEncodeHead(buf, cborMajorBytes, uint64(rv.Len()))
+			buf.Write(rv.Bytes())
+			return nil
+		}
+		cborEncodeHead(buf, cborMajorArray, uint64(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			err := cborEncode(buf, rv.Index(i), depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		keys, values, err := sortedMapKeys(rv)
+		if err != nil {
+			return fmt.Errorf("cbor: %s", err.Error())
+		}
+		cborEncodeHead(buf, cborMajorMap, uint64(len(keys)))
+		for _, k := range keys {
+			cborEncodeHead(buf, cborMajorText, uint64(len(k)))
+			buf.WriteString(k)
+			err := cborEncode(buf, values[k], depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := cachedFields(rv.Type())
+		values := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			fv := rv.FieldByIndex(field.index)
+			if field.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			values = append(values, fv)
+			names = append(names, field.name)
+		}
+		cborEncodeHead(buf, cborMajorMap, uint64(len(values)))
+		for i, fv := range values {
+			cborEncodeHead(buf, cborMajorText, uint64(len(names[i])))
+			buf.WriteString(names[i])
+			err := cborEncode(buf, fv, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", rv.Type())
+	}
+	return nil
+}
+
+func cborEncodeInt(buf *bytes.Buffer, v int64) {
+	if v >= 0 {
+		cborEncodeHead(buf, cborMajorUint, uint64(v))
+	} else {
+		cborEncodeHead(buf, cborMajorNegInt, uint64(-1-v))
+	}
+}
+
+func cborEncodeFloat(buf *bytes.Buffer, v float64) {
+	buf.WriteByte(0xfb)
+	temp := make([]byte, 8)
+	binary.BigEndian.PutUint64(temp, math.Float64bits(v))
+	buf.Write(temp)
+}
+
+func cborEncodeHead(buf *bytes.Buffer, major byte, n uint64) {
+	temp := make([]byte, 9)
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		temp[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(temp[1:], uint16(n))
+		buf.Write(temp[:3])
+	case n <= math.MaxUint32:
+		temp[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(temp[1:], uint32(n))
+		buf.Write(temp[:5])
+	default:
+		temp[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(temp[1:], n)
+		buf.Write(temp)
+	}
+}
+
+type cborDecoder struct {
+	data 	[]byte
+	pos 	int
+}
+
+//解码一个数据项，整数解码为int64(超出范围时为uint64或者float64)，字节串解码为[]byte
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxPayloadDepth {
+		return nil, errors.New("invalid cbor payload: nesting too deep")
+	}
+	if d.pos >= len(d.data) {
+		return nil, errCBORTruncated
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major := initial >> 5
+	info := initial & 0x1f
+	if major == cborMajorSimple {
+		return d.decodeSimple(info)
+	}
+	if info == 31 {
+		return d.decodeIndefinite(major, depth)
+	}
+	n, err := d.readArg(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborMajorUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborMajorNegInt:
+		if n > math.MaxInt64 {
+			return -1 - float64(n), nil
+		}
+		return -1 - int64(n), nil
+	case cborMajorBytes:
+		data, err := d.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, data...), nil
+	case cborMajorText:
+		data, err := d.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(data) {
+			return nil, errors.New("invalid cbor payload: invalid utf-8 string")
+		}
+		return string(data), nil
+	case cborMajorArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, errCBORTruncated
+		}
+		items := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMajorMap:
+		if n > uint64(len(d.data)-d.pos)/2 {
+			return nil, errCBORTruncated
+		}
+		result := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			err := d.decodeMapEntry(result, depth)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case cborMajorTag:
+		//忽略tag，直接解码内容
+		return d.decode(depth + 1)
+	}
+	return nil, fmt.Errorf("invalid cbor payload: unsupported major type %d", major)
+}
+
+func (d *cborDecoder) decodeMapEntry(result map[string]interface{}, depth int) error {
+	key, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	var k string
+	switch temp := key.(type) {
+	case string:
+		k = temp
+	case int64:
+		k = strconv.FormatInt(temp, 10)
+	case uint64:
+		k = strconv.FormatUint(temp, 10)
+	default:
+		return errors.New("invalid cbor payload: map key should be string")
+	}
+	value, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+	result[k] = value
+	return nil
+}
+
+//解码不定长的字符串、数组和map
+func (d *cborDecoder) decodeIndefinite(major byte, depth int) (interface{}, error) {
+	switch major {
+	case cborMajorBytes, cborMajorText:
+		buf := &bytes.Buffer{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errCBORTruncated
+			}
+			if d.data[d.pos] == 0xff {
+				d.pos++
+				break
+			}
+			chunk, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch temp := chunk.(type) {
+			case string:
+				if major != cborMajorText {
+					return nil, errors.New("invalid cbor payload: mismatched chunk type")
+				}
+				buf.WriteString(temp)
+			case []byte:
+				if major != cborMajorBytes {
+					return nil, errors.New("invalid cbor payload: mismatched chunk type")
+				}
+				buf.Write(temp)
+			default:
+				return nil, errors.New("invalid cbor payload: mismatched chunk type")
+			}
+		}
+		if major == cborMajorText {
+			return buf.String(), nil
+		}
+		return buf.Bytes(), nil
+	case cborMajorArray:
+		items := make([]interface{}, 0)
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errCBORTruncated
+			}
+			if d.data[d.pos] == 0xff {
+				d.pos++
+				return items, nil
+			}
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	case cborMajorMap:
+		result := make(map[string]interface{})
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errCBORTruncated
+			}
+			if d.data[d.pos] == 0xff {
+				d.pos++
+				return result, nil
+			}
+			err := d.decodeMapEntry(result, depth)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("invalid cbor payload: invalid indefinite length item")
+}
+
+func (d *cborDecoder) decodeSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		data, err := d.readBytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return checkFloat(halfToFloat(binary.BigEndian.Uint16(data)))
+	case 26:
+		data, err := d.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return checkFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(data))))
+	case 27:
+		data, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return checkFloat(math.Float64frombits(binary.BigEndian.Uint64(data)))
+	}
+	return nil, fmt.Errorf("invalid cbor payload: unsupported simple value %d", info)
+}
+
+func (d *cborDecoder) readArg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		data, err := d.readBytes(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(data[0]), nil
+	case info == 25:
+		data, err := d.readBytes(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(data)), nil
+	case info == 26:
+		data, err := d.readBytes(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(data)), nil
+	case info == 27:
+		data, err := d.readBytes(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(data), nil
+	}
+	return 0, fmt.Errorf("invalid cbor payload: invalid additional info %d", info)
+}
+
+func (d *cborDecoder) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBORTruncated
+	}
+	data := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return data, nil
+}
+
+//JSON不支持NaN和Inf
+func checkFloat(f float64) (interface{}, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.New("invalid payload: NaN or Inf is not supported")
+	}
+	return f, nil
+}
+
+//半精度浮点数转换
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
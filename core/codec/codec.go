@@ -1,21 +1,27 @@
 package codec
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/qingcloud-iot/edge-app-go/common"
 	"github.com/satori/go.uuid"
-	"strings"
+	"sort"
 	"time"
 )
 
+//代理模式下属性设置topic与属性上报topic相同，收到应用自己上报的属性消息时返回此错误
+var ErrSelfMessage = errors.New("message published by self")
+
 func NewCodec(appId string, deviceId string, thingId string, proxyMode bool) *Codec {
 	return &Codec{
 		AppId: appId,
 		DeviceId: deviceId,
 		ThingId: thingId,
 		ProxyMode: proxyMode,
+		Payload: &JSONPayloadCodec{},
+		Scheme: newDefaultTopicScheme(appId, deviceId, thingId, proxyMode),
 	}
 }
 
@@ -24,13 +30,31 @@ type Codec struct {
 	DeviceId    string
 	ThingId 	string
 	ProxyMode   bool
+	//MDMP消息负载编解码器，为空时使用JSON格式；解码时以"{"开头的负载按JSON解码，其他负载按此格式解码
+	Payload 	PayloadCodec
+	//topic方案，为空时根据ProxyMode选择代理模式或者普通模式的topic格式
+	Scheme 		TopicScheme
 }
 
 //将SDK接口的消息数据编码成平台消息格式的数据
 func (c *Codec) EncodeMessage(topicType string, thingId string, deviceId string, payload []byte) (string, []byte, error) {
+	return c.EncodeMessageWithSource(topicType, thingId, deviceId, payload, nil)
+}
+
+//将SDK接口的消息数据编码成平台消息格式的数据，source为属性和事件消息的设备源，其他类型的消息忽略
+func (c *Codec) EncodeMessageWithSource(topicType string, thingId string, deviceId string, payload []byte, source []string) (string, []byte, error) {
+	return c.EncodeMessageWithMeta(topicType, thingId, deviceId, payload, &common.AppSdkMessageMeta{Source: source})
+}
+
+//将SDK接口的消息数据按照元信息编码成平台消息格式的数据，meta为nil时与EncodeMessage相同
+func (c *Codec) EncodeMessageWithMeta(topicType string, thingId string, deviceId string, payload []byte, meta *common.AppSdkMessageMeta) (string, []byte, error) {
+	if meta == nil {
+		meta = &common.AppSdkMessageMeta{}
+	}
+	source := meta.Source
 	switch topicType {
 	case TopicType_SubProperty:
-		data, err := c.encodePropertyMsg(thingId, deviceId, payload)
+		data, err := c.encodePropertyMsg(thingId, deviceId, payload, source, meta.Batch)
 		if err != nil {
 			return "", nil, err
 		}
@@ -40,7 +64,7 @@ func (c *Codec) EncodeMessage(topicType string, thingId string, deviceId string,
 		}
 		return dstTopic, data, nil
 	case TopicType_PubProperty:
-		data, err := c.encodePropertyMsg(thingId, deviceId, payload)
+		data, err := c.encodePropertyMsg(thingId, deviceId, payload, source, meta.Batch)
 		if err != nil {
 			return "", nil, err
 		}
@@ -50,7 +74,7 @@ func (c *Codec) EncodeMessage(topicType string, thingId string, deviceId string,
 		}
 		return dstTopic, data, nil
 	case TopicType_SubEvent, TopicType_PubEvent:
-		identifier, data, err := c.encodeEventMsg(thingId, deviceId, payload)
+		identifier, data, err := c.encodeEventMsg(thingId, deviceId, payload, source)
 		if err != nil {
 			return "", nil, err
 		}
@@ -69,6 +93,16 @@ func (c *Codec) EncodeMessage(topicType string, thingId string, deviceId string,
 			return "", nil, err
 		}
 		return dstTopic, data, nil
+	case TopicType_PubPropertySetReply:
+		data, err := c.encodePropertySetReplyMsg(payload)
+		if err != nil {
+			return "", nil, err
+		}
+		dstTopic, err := c.EncodeTopic(topicType, "", thingId, deviceId)
+		if err != nil {
+			return "", nil, err
+		}
+		return dstTopic, data, nil
 	case TopicType_PubServiceReply:
 		identifier, data, err := c.encodeServiceReplyMsg(payload)
 		if err != nil {
@@ -83,186 +117,112 @@ func (c *Codec) EncodeMessage(topicType string, thingId string, deviceId string,
 	return "", nil, errors.New("Unsupported topic type: " + topicType)
 }
 
+//解码后的消息
+type DecodedMessage struct {
+	//topic类型
+	TopicType 	string
+	//模型id
+	ThingId 	string
+	//设备id
+	DeviceId 	string
+	//消息格式版本号
+	Version 	string
+	//消息id
+	MessageId 	string
+	//原始消息类型，如thing.event.{identifier}.post
+	RawType 	string
+	//设备源，服务调用和回应消息为空
+	Source 		[]string
+	//采样时间戳，服务调用和回应消息为0
+	EpochTime 	int64
+	//SDK接口的消息数据
+	Payload 	[]byte
+}
+
 //将平台消息格式的数据解码成SDK接口的消息数据
 func (c *Codec) DecodeMessage(topic string, payload []byte) (string, string, string, []byte, error) {
-	topicType, thingId, deviceId, identifier, err := c.DecodeTopic(topic)
+	msg, err := c.Decode(topic, payload)
 	if err != nil {
 		return "", "", "", nil, err
 	}
+	return msg.TopicType, msg.ThingId, msg.DeviceId, msg.Payload, nil
+}
+
+//将平台消息格式的数据解码成SDK接口的消息数据，不支持的消息版本返回ErrUnsupportedVersion
+func (c *Codec) Decode(topic string, payload []byte) (*DecodedMessage, error) {
+	topicType, thingId, deviceId, identifier, err := c.DecodeTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+	payload, version, err := c.negotiateVersion(payload)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
 	switch topicType {
 	case TopicType_SubProperty, TopicType_PubProperty:
-		data, err := c.decodePropertyMsg(payload)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-		return topicType, thingId, deviceId, data, nil
+		data, err = c.decodePropertyMsg(payload)
+	case TopicType_SubPropertySet:
+		data, err = c.decodePropertySetMsg(payload)
 	case TopicType_SubEvent, TopicType_PubEvent:
-		data, err := c.decodeEventMsg(identifier, payload)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-		return topicType, thingId, deviceId, data, nil
+		data, err = c.decodeEventMsg(identifier, payload)
 	case TopicType_PubService, TopicType_SubService:
-		data, err := c.decodeServiceMsg(identifier, payload)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-		return topicType, thingId, deviceId, data, nil
+		data, err = c.decodeServiceMsg(identifier, payload)
 	case TopicType_PubServiceReply, TopicType_SubServiceReply:
-		data, err := c.decodeServiceReplyMsg(identifier, payload)
-		if err != nil {
-			return "", "", "", nil, err
-		}
-		return topicType, thingId, deviceId, data, nil
+		data, err = c.decodeServiceReplyMsg(identifier, payload)
+	default:
+		return nil, errors.New("Unsupported topic type: " + topicType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg := &DecodedMessage{
+		TopicType: topicType,
+		ThingId: thingId,
+		DeviceId: deviceId,
+		Version: version,
+		Payload: data,
+	}
+	header := &struct {
+		ID 			string 			`json:"id"`
+		Type 		string 			`json:"type"`
+		Metadata 	json.RawMessage `json:"metadata"`
+	}{}
+	err = c.unmarshalPayload(payload, header)
+	if err != nil {
+		return nil, err
+	}
+	msg.MessageId = header.ID
+	msg.RawType = header.Type
+	//元信息格式不符合时忽略，不影响消息内容的解码
+	metadata := &ModelMetadata{}
+	if len(header.Metadata) > 0 && json.Unmarshal(header.Metadata, metadata) == nil {
+		msg.Source = metadata.Source
+		msg.EpochTime = metadata.EpochTime
 	}
-	return "", "", "", nil, errors.New("Unsupported topic type: " + topicType)
+	return msg, nil
 }
 
 //编码Topic
 func (c *Codec) EncodeTopic(topicType string, identifier string, thingId string, deviceId string) (string, error) {
-	if topicType == ""  {
-		return "", errors.New("invalid arguments")
-	}
-	topic := ""
-	if c.ProxyMode {
-		//代理模式
-		switch topicType {
-		case TopicType_SubProperty:
-			topic = fmt.Sprintf(topicTemplateV1_SubProperty, c.AppId)
-		case TopicType_PubProperty:
-			topic = fmt.Sprintf(topicTemplateV1_PubProperty, c.AppId)
-		case TopicType_SubEvent:
-			topic = fmt.Sprintf(topicTemplateV1_SubEvent, c.AppId, identifier)
-		case TopicType_PubEvent:
-			topic = fmt.Sprintf(topicTemplateV1_PubEvent, c.AppId, identifier)
-		case TopicType_PubService:
-			topic = fmt.Sprintf(topicTemplateV1_PubService, c.AppId, identifier)
-		case TopicType_SubService:
-			topic = fmt.Sprintf(topicTemplateV1_SubService, thingId, deviceId, identifier)
-		case TopicType_PubServiceReply:
-			topic = fmt.Sprintf(topicTemplateV1_PubServiceReply, thingId, deviceId, identifier)
-		case TopicType_SubServiceReply:
-			topic = fmt.Sprintf(topicTemplateV1_SubServiceReply, thingId, deviceId, identifier)
-		default:
-			return "", errors.New("unsupported topicType: " + topicType)
-		}
-	} else {
-		//普通模式
-		switch topicType {
-		case TopicType_SubProperty:
-			topic = fmt.Sprintf(topicTemplateV2_SubProperty, thingId, deviceId)
-		case TopicType_PubProperty:
-			topic = fmt.Sprintf(topicTemplateV2_PubProperty, thingId, deviceId)
-		case TopicType_SubEvent:
-			topic = fmt.Sprintf(topicTemplateV2_SubEvent, thingId, deviceId, identifier)
-		case TopicType_PubEvent:
-			topic = fmt.Sprintf(topicTemplateV2_PubEvent, thingId, deviceId, identifier)
-		case TopicType_PubService:
-			topic = fmt.Sprintf(topicTemplateV2_PubService, thingId, deviceId, identifier)
-		case TopicType_SubService:
-			topic = fmt.Sprintf(topicTemplateV2_SubService, thingId, deviceId, identifier)
-		case TopicType_PubServiceReply:
-			topic = fmt.Sprintf(topicTemplateV2_PubServiceReply, thingId, deviceId, identifier)
-		case TopicType_SubServiceReply:
-			topic = fmt.Sprintf(topicTemplateV2_SubServiceReply, thingId, deviceId, identifier)
-		default:
-			return "", errors.New("unsupported topicType: " + topicType)
-		}
-
-	}
-	return topic, nil
+	return c.scheme().EncodeTopic(topicType, identifier, thingId, deviceId)
 }
 
-//解码Topic
+//解码Topic，返回topic类型、模型id、设备id和标识id
 func (c *Codec) DecodeTopic(topic string) (string, string, string, string, error) {
-	if topic == "" {
-		return "", "", "", "", errors.New("invalid arguments")
-	}
-	if c.ProxyMode {
-		//代理模式
-		dstUnits := strings.Split(topic, "/")
-		if len(dstUnits) != 7 && len(dstUnits) != 8 {
-			return "", "", "", "", errors.New("invalid topic format")
-		}
-		if dstUnits[0] != "" || (dstUnits[1] != "edge" && dstUnits[1] != "sys") {
-			return "", "", "", "", errors.New("invalid topic format: " + topic)
-		}
-		//parse topic
-		topicType := ""
-		identifier := ""
-		if dstUnits[1] == "edge" {
-			if dstUnits[4] == "property" {
-				if dstUnits[6] == "post" {
-					topicType = TopicType_SubProperty
-				} else if dstUnits[6] == "control" {
-					topicType = TopicType_PubProperty
-				}
-			} else if dstUnits[4] == "event" {
-				if dstUnits[6] == "post" {
-					topicType = TopicType_SubEvent
-				} else if dstUnits[6] == "control" {
-					topicType = TopicType_PubEvent
-				}
-				identifier = dstUnits[5]
-			} else if dstUnits[4] == "service" {
-				if dstUnits[6] == "call" {
-					topicType = TopicType_PubService
-				}
-				identifier = dstUnits[5]
-			}
-		} else {
-			if dstUnits[5] == "service" {
-				if dstUnits[7] == "call" {
-					topicType = TopicType_SubService
-				} else if dstUnits[7] == "call_reply" {
-					topicType = TopicType_PubServiceReply
-				}
-				identifier = dstUnits[6]
-			}
-		}
-		if topicType == "" {
-			return "", "", "", "", errors.New("invalid topic format: " + topic)
-		}
-		return topicType, c.ThingId, c.DeviceId, identifier, nil
-	} else {
-		//普通模式
-		dstUnits := strings.Split(topic, "/")
-		if len(dstUnits) != 8 {
-			return "", "", "", "", errors.New("invalid topic format")
-		}
-		if dstUnits[0] != "" || dstUnits[1] != "sys" {
-			return "", "", "", "", errors.New("invalid topic format: " + topic)
-		}
-		//parse topic
-		topicType := ""
-		thingId := dstUnits[2]
-		deviceId := dstUnits[3]
-		identifier := ""
-		if dstUnits[5] == "property" {
-			if dstUnits[7] == "post" {
-				topicType = TopicType_SubProperty
-			}
-		} else if dstUnits[5] == "event" {
-			if dstUnits[7] == "post" {
-				topicType = TopicType_SubEvent
-			}
-			identifier = dstUnits[6]
-		} else if dstUnits[5] == "service" {
-			if dstUnits[7] == "call" {
-				topicType = TopicType_SubService
-			} else if dstUnits[7] == "call_reply" {
-				topicType = TopicType_SubServiceReply
-			}
-			identifier = dstUnits[6]
-		}
-		if topicType == "" {
-			return "", "", "", "", errors.New("invalid topic format: " + topic)
-		}
-		return topicType, thingId, deviceId, identifier, nil
+	return c.scheme().DecodeTopic(topic)
+}
+
+//未设置topic方案时根据是否为代理模式选择
+func (c *Codec) scheme() TopicScheme {
+	if c.Scheme != nil {
+		return c.Scheme
 	}
+	return newDefaultTopicScheme(c.AppId, c.DeviceId, c.ThingId, c.ProxyMode)
 }
 
-func (c *Codec) encodePropertyMsg(thingId string, deviceId string, payload []byte) ([]byte, error) {
+//batch为true时使用批量格式保留同一属性的全部采样值，否则同一属性只保留最后一个值
+func (c *Codec) encodePropertyMsg(thingId string, deviceId string, payload []byte, source []string, batch bool) ([]byte, error) {
 	props := make([]*common.AppSdkMsgProperty, 0)
 	err := json.Unmarshal(payload, &props)
 	if err != nil {
@@ -272,31 +232,55 @@ func (c *Codec) encodePropertyMsg(thingId string, deviceId string, payload []byt
 		return nil, errors.New("properties is empty")
 	}
 	now := time.Now().UnixNano() / 1e6
-	msg := &MdmpPropertyMsg{}
-	msg.ID = uuid.NewV1().String()
-	msg.Version = DefaultMessageVersion
-	msg.Type = MessageTypeTemplate_Property
-	msg.Metadata = &ModelMetadata{
-		ModelId: thingId,
-		EntityId: deviceId,
-		Source: make([]string, 0),
-		EpochTime: now,
+	header := MdmpMsgHeader{
+		ID: uuid.NewV1().String(),
+		Version: DefaultMessageVersion,
+		Type: MessageTypeTemplate_Property,
+		Metadata: &ModelMetadata{
+			ModelId: thingId,
+			EntityId: deviceId,
+			Source: sourceOrEmpty(source),
+			EpochTime: now,
+		},
 	}
-	msg.Params = make(map[string]*ModelPropertyData)
+	samples := make(map[string][]*ModelPropertyData)
 	for _, prop := range props {
 		tempData := &ModelPropertyData{}
 		tempData.Value = prop.Value
 		tempData.Time = prop.Timestamp
-		msg.Params[prop.Identifier] = tempData
+		samples[prop.Identifier] = append(samples[prop.Identifier], tempData)
 	}
-	result, err := json.Marshal(msg)
+	var msg interface{}
+	if batch {
+		//批量格式保留同一属性的多个采样值，采样值按时间排序
+		header.Type = MessageTypeTemplate_PropertyBatch
+		for _, values := range samples {
+			sort.SliceStable(values, func(i, j int) bool {
+				return values[i].Time < values[j].Time
+			})
+		}
+		msg = &MdmpPropertyBatchMsg{
+			MdmpMsgHeader: header,
+			Params: samples,
+		}
+	} else {
+		params := make(map[string]*ModelPropertyData)
+		for k, values := range samples {
+			params[k] = values[len(values)-1]
+		}
+		msg = &MdmpPropertyMsg{
+			MdmpMsgHeader: header,
+			Params: params,
+		}
+	}
+	result, err := c.marshalPayload(msg)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (c *Codec) encodeEventMsg(thingId string, deviceId string, payload []byte) (string, []byte, error) {
+func (c *Codec) encodeEventMsg(thingId string, deviceId string, payload []byte, source []string) (string, []byte, error) {
 	evt := &common.AppSdkMsgEvent{}
 	err := json.Unmarshal(payload, evt)
 	if err != nil {
@@ -310,20 +294,30 @@ func (c *Codec) encodeEventMsg(thingId string, deviceId string, payload []byte)
 	msg.Metadata = &ModelMetadata{
 		ModelId: thingId,
 		EntityId: deviceId,
-		Source: make([]string, 0),
+		Source: sourceOrEmpty(source),
 		EpochTime: now,
 	}
 	msg.Params = &ModelEventData{
 		Time: evt.Timestamp,
 		Value: evt.Params,
+		Message: evt.Message,
+		Level: string(evt.Level),
 	}
-	result, err := json.Marshal(msg)
+	result, err := c.marshalPayload(msg)
 	if err != nil {
 		return "", nil, err
 	}
 	return evt.Identifier, result, nil
 }
 
+//平台要求source字段不为null
+func sourceOrEmpty(source []string) []string {
+	if source == nil {
+		return make([]string, 0)
+	}
+	return source
+}
+
 func (c *Codec) encodeServiceMsg(thingId string, deviceId string,payload []byte) (string, []byte, error) {
 	srv := &common.AppSdkMsgServiceCall{}
 	err := json.Unmarshal(payload, srv)
@@ -339,7 +333,7 @@ func (c *Codec) encodeServiceMsg(thingId string, deviceId string,payload []byte)
 		EntityId: deviceId,
 	}
 	msg.Params = srv.Params
-	result, err := json.Marshal(msg)
+	result, err := c.marshalPayload(msg)
 	if err != nil {
 		return "", nil, err
 	}
@@ -357,28 +351,115 @@ func (c *Codec) encodeServiceReplyMsg(payload []byte) (string, []byte, error) {
 	msg.Version = DefaultMessageVersion
 	msg.Code = reply.Code
 	msg.Data = reply.Params
-	result, err := json.Marshal(msg)
+	result, err := c.marshalPayload(msg)
 	if err != nil {
 		return "", nil, err
 	}
 	return reply.Identifier, result, nil
 }
 
+//解码属性消息，兼容单个采样值和批量采样值两种格式，结果按照时间戳和标识id排序
 func (c *Codec) decodePropertyMsg(payload []byte) ([]byte, error) {
-	msg := &MdmpPropertyMsg{}
-	err := json.Unmarshal(payload, msg)
+	msg := &MdmpRawPropertyMsg{}
+	err := c.unmarshalPayload(payload, msg)
 	if err != nil {
 		return nil, err
 	}
 	props := make([]*common.AppSdkMsgProperty, 0)
+	for k, v := range msg.Params {
+		values := make([]*ModelPropertyData, 0)
+		if trimmed := bytes.TrimSpace(v); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(v, &values)
+		} else {
+			tempData := &ModelPropertyData{}
+			err = json.Unmarshal(v, tempData)
+			values = append(values, tempData)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if value == nil {
+				continue
+			}
+			tempProp := &common.AppSdkMsgProperty{}
+			tempProp.Identifier = k
+			tempProp.Value = value.Value
+			tempProp.Timestamp = value.Time
+			props = append(props, tempProp)
+		}
+	}
+	sort.SliceStable(props, func(i, j int) bool {
+		if props[i].Timestamp != props[j].Timestamp {
+			return props[i].Timestamp < props[j].Timestamp
+		}
+		return props[i].Identifier < props[j].Identifier
+	})
+	result, err := json.Marshal(props)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Codec) decodePropertySetMsg(payload []byte) ([]byte, error) {
+	msg := &MdmpRawPropertyMsg{}
+	err := c.unmarshalPayload(payload, msg)
+	if err != nil {
+		return nil, err
+	}
+	//消息代理模式下属性上报和属性设置共用同一个topic，只接受属性设置消息，自身上报的单个和批量属性直接忽略
+	switch msg.Type {
+	case MessageTypeTemplate_PropertySet:
+	case MessageTypeTemplate_Property, MessageTypeTemplate_PropertyBatch:
+		return nil, ErrSelfMessage
+	default:
+		return nil, errors.New("unexpected property set message type: " + msg.Type)
+	}
+	set := &common.AppSdkMsgPropertySet{
+		MessageId: msg.ID,
+		Properties: make([]*common.AppSdkMsgProperty, 0),
+	}
 	for k, v := range msg.Params {
 		tempProp := &common.AppSdkMsgProperty{}
 		tempProp.Identifier = k
-		tempProp.Value = v.Value
-		tempProp.Timestamp = v.Time
-		props = append(props, tempProp)
+		tempData := &ModelPropertyData{}
+		if json.Unmarshal(v, tempData) == nil && tempData.Value != nil {
+			tempProp.Value = tempData.Value
+			tempProp.Timestamp = tempData.Time
+		} else {
+			err = json.Unmarshal(v, &tempProp.Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		set.Properties = append(set.Properties, tempProp)
 	}
-	result, err := json.Marshal(props)
+	sort.Slice(set.Properties, func(i, j int) bool {
+		return set.Properties[i].Identifier < set.Properties[j].Identifier
+	})
+	result, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Codec) encodePropertySetReplyMsg(payload []byte) ([]byte, error) {
+	reply := &common.AppSdkMsgPropertySetReply{}
+	err := json.Unmarshal(payload, reply)
+	if err != nil {
+		return nil, err
+	}
+	msg := &MdmpServiceReplyMsg{}
+	msg.ID = reply.MessageId
+	msg.Version = DefaultMessageVersion
+	msg.Code = reply.Code
+	msg.Data = make(map[string]interface{})
+	if reply.Message != "" {
+		msg.Data["message"] = reply.Message
+	}
+	result, err := c.marshalPayload(msg)
 	if err != nil {
 		return nil, err
 	}
@@ -387,14 +468,19 @@ func (c *Codec) decodePropertyMsg(payload []byte) ([]byte, error) {
 
 func (c *Codec) decodeEventMsg(identifier string, payload []byte) ([]byte, error) {
 	msg := &MdmpEventMsg{}
-	err := json.Unmarshal(payload, msg)
+	err := c.unmarshalPayload(payload, msg)
 	if err != nil {
 		return nil, err
 	}
+	if msg.Params == nil {
+		return nil, errors.New("event params is empty")
+	}
 	evt := &common.AppSdkMsgEvent{}
 	evt.Identifier = identifier
 	evt.Timestamp = msg.Params.Time
 	evt.Params = msg.Params.Value
+	evt.Message = msg.Params.Message
+	evt.Level = common.EventLevel(msg.Params.Level)
 	result, err := json.Marshal(evt)
 	if err != nil {
 		return nil, err
@@ -404,7 +490,7 @@ func (c *Codec) decodeEventMsg(identifier string, payload []byte) ([]byte, error
 
 func (c *Codec) decodeServiceMsg(identifier string, payload []byte) ([]byte, error) {
 	msg := &MdmpServiceCallMsg{}
-	err := json.Unmarshal(payload, msg)
+	err := c.unmarshalPayload(payload, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -421,7 +507,7 @@ func (c *Codec) decodeServiceMsg(identifier string, payload []byte) ([]byte, err
 
 func (c *Codec) decodeServiceReplyMsg(identifier string, payload []byte) ([]byte, error) {
 	msg := &MdmpServiceReplyMsg{}
-	err := json.Unmarshal(payload, msg)
+	err := c.unmarshalPayload(payload, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -1 +1,312 @@
 package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCodec_PropertyBatch(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	src := `[{"identifier":"temp","timestamp":1593274999808,"value":3},` +
+		`{"identifier":"temp","timestamp":1593274999806,"value":1},` +
+		`{"identifier":"humi","timestamp":1593274999806,"value":50},` +
+		`{"identifier":"temp","timestamp":1593274999807,"value":2}]`
+	batch := &common.AppSdkMessageMeta{Batch: true}
+	topic, data, err := c.EncodeMessageWithMeta(TopicType_PubProperty, "iott-001", "iotd-001", []byte(src), batch)
+	if !assert.Nil(err) {
+		return
+	}
+	msg := &MdmpPropertyBatchMsg{}
+	if !assert.Nil(json.Unmarshal(data, msg)) {
+		return
+	}
+	assert.Equal(MessageTypeTemplate_PropertyBatch, msg.Type)
+	assert.Len(msg.Params["temp"], 3)
+	topicType, _, _, decoded, err := c.DecodeMessage(topic, data)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(TopicType_SubProperty, topicType)
+	expected := `[{"identifier":"humi","timestamp":1593274999806,"value":50},` +
+		`{"identifier":"temp","timestamp":1593274999806,"value":1},` +
+		`{"identifier":"temp","timestamp":1593274999807,"value":2},` +
+		`{"identifier":"temp","timestamp":1593274999808,"value":3}]`
+	assert.Equal(expected, string(decoded))
+
+	//未指定批量格式时保持thing.property.post格式，同一属性只保留最后一个值
+	for _, meta := range []*common.AppSdkMessageMeta{nil, {Source: []string{"iotd-002"}}} {
+		_, data, err = c.EncodeMessageWithMeta(TopicType_PubProperty, "iott-001", "iotd-001", []byte(src), meta)
+		if !assert.Nil(err) {
+			return
+		}
+		single := &MdmpPropertyMsg{}
+		if assert.Nil(json.Unmarshal(data, single)) {
+			assert.Equal(MessageTypeTemplate_Property, single.Type)
+			assert.Len(single.Params, 2)
+			assert.EqualValues(2, single.Params["temp"].Value)
+			assert.EqualValues(1593274999807, single.Params["temp"].Time)
+		}
+	}
+}
+
+//消息代理模式下自身上报的批量属性与属性设置共用topic，不能解码为属性设置
+func TestCodec_PropertyBatchProxy(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", true)
+	src := `[{"identifier":"temp","timestamp":1593274999806,"value":1},` +
+		`{"identifier":"temp","timestamp":1593274999807,"value":2}]`
+	topic, data, err := c.EncodeMessageWithMeta(TopicType_PubProperty, "iott-001", "iotd-001", []byte(src), &common.AppSdkMessageMeta{Batch: true})
+	if !assert.Nil(err) {
+		return
+	}
+	_, _, _, _, err = c.DecodeMessage(topic, data)
+	assert.Equal(ErrSelfMessage, err)
+	_, data, err = c.EncodeMessage(TopicType_PubProperty, "iott-001", "iotd-001", []byte(`[{"identifier":"temp","timestamp":1593274999806,"value":1}]`))
+	if !assert.Nil(err) {
+		return
+	}
+	_, _, _, _, err = c.DecodeMessage(topic, data)
+	assert.Equal(ErrSelfMessage, err)
+
+	set := `{"id":"msg-001","version":"1.0","type":"thing.property.set","params":{"switch":{"value":true}}}`
+	topicType, _, _, decoded, err := c.DecodeMessage(topic, []byte(set))
+	if assert.Nil(err) {
+		assert.Equal(TopicType_SubPropertySet, topicType)
+		assert.JSONEq(`{"messageId":"msg-001","properties":[{"identifier":"switch","timestamp":0,"value":true}]}`, string(decoded))
+	}
+	_, _, _, _, err = c.DecodeMessage(topic, []byte(`{"id":"msg-002","version":"1.0","type":"thing.event.alarm.post","params":{}}`))
+	assert.NotNil(err)
+}
+
+func TestCodec_PropertySingle(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	src := `[{"identifier":"temp","timestamp":1593274999806,"value":1}]`
+	_, data, err := c.EncodeMessage(TopicType_PubProperty, "iott-001", "iotd-001", []byte(src))
+	if !assert.Nil(err) {
+		return
+	}
+	msg := &MdmpPropertyMsg{}
+	if !assert.Nil(json.Unmarshal(data, msg)) {
+		return
+	}
+	assert.Equal(MessageTypeTemplate_Property, msg.Type)
+	props := make([]*common.AppSdkMsgProperty, 0)
+	decoded, err := c.decodePropertyMsg(data)
+	if assert.Nil(err) && assert.Nil(json.Unmarshal(decoded, &props)) {
+		assert.Len(props, 1)
+	}
+}
+
+func TestCodec_EventLevel(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	src := `{"identifier":"overheat","timestamp":1593274999806,"params":{"value":90},"level":"critical","message":"too hot"}`
+	topic, data, err := c.EncodeMessage(TopicType_PubEvent, "iott-001", "iotd-001", []byte(src))
+	if !assert.Nil(err) {
+		return
+	}
+	_, _, _, decoded, err := c.DecodeMessage(topic, data)
+	if !assert.Nil(err) {
+		return
+	}
+	evt := &common.AppSdkMsgEvent{}
+	if assert.Nil(json.Unmarshal(decoded, evt)) {
+		assert.Equal(common.EventLevel_Critical, evt.Level)
+		assert.Equal("too hot", evt.Message)
+	}
+}
+
+func TestCodec_PayloadFormat(t *testing.T) {
+	assert := assert.New(t)
+	src := `{"identifier":"overheat","timestamp":1593274999806,"params":{"temp":81.5,"tags":["a","b"],"ok":false},"level":"warn"}`
+	expected := `{"identifier":"overheat","timestamp":1593274999806,"params":{"ok":false,"tags":["a","b"],"temp":81.5},"level":"warn"}`
+	for _, format := range []string{PayloadFormat_JSON, PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if !assert.Nil(err) {
+			return
+		}
+		c := NewCodec("app-001", "iotd-001", "iott-001", false)
+		c.Payload = payload
+		topic, data, err := c.EncodeMessage(TopicType_PubEvent, "iott-001", "iotd-001", []byte(src))
+		if !assert.Nil(err, format) {
+			return
+		}
+		switch format {
+		case PayloadFormat_CBOR:
+			assert.Equal(cborSelfDescribe, data[:3], format)
+		case PayloadFormat_Protobuf:
+			assert.Equal(byte(0x0a), data[0], format)
+		}
+		//解码端按照配置的格式解码
+		decoder := NewCodec("app-001", "iotd-001", "iott-001", false)
+		decoder.Payload = payload
+		_, _, _, decoded, err := decoder.DecodeMessage(topic, data)
+		if !assert.Nil(err, format) {
+			return
+		}
+		assert.Equal(expected, string(decoded), format)
+		//配置的格式总是可以解码JSON消息
+		jsonTopic, jsonData, err := NewCodec("app-001", "iotd-001", "iott-001", false).EncodeMessage(TopicType_PubEvent, "iott-001", "iotd-001", []byte(src))
+		if !assert.Nil(err, format) {
+			return
+		}
+		_, _, _, decoded, err = decoder.DecodeMessage(jsonTopic, jsonData)
+		if assert.Nil(err, format) {
+			assert.Equal(expected, string(decoded), format)
+		}
+		//不根据负载内容猜测格式，与配置的格式不符时解码失败
+		if format != PayloadFormat_JSON {
+			_, _, _, _, err = NewCodec("app-001", "iotd-001", "iott-001", false).DecodeMessage(topic, data)
+			assert.NotNil(err, format)
+		}
+	}
+	//以合法的protobuf tag开头的其他数据不会按照protobuf解码
+	_, _, _, _, err := NewCodec("app-001", "iotd-001", "iott-001", false).DecodeMessage("/sys/iott-001/iotd-001/thing/event/overheat/post", []byte("\x0a\x03abc"))
+	assert.NotNil(err)
+	_, err = NewPayloadCodec("xml")
+	assert.NotNil(err)
+}
+
+func TestCodec_TemplateTopicScheme(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewTemplateTopicScheme("app-001", "iott-001", "iotd-001", map[string]string{"SubProperty": "/things/{thingId}x/props"})
+	assert.NotNil(err)
+	_, err = NewTemplateTopicScheme("app-001", "iott-001", "iotd-001", map[string]string{"Unknown": "/things"})
+	assert.NotNil(err)
+	scheme, err := NewTemplateTopicScheme("app-001", "iott-001", "iotd-001", map[string]string{
+		"SubProperty": "ns/{thingId}/{deviceId}/props",
+		"PubProperty": "ns/{thingId}/{deviceId}/props",
+		"SubService": "ns/{thingId}/{deviceId}/call/{identifier}",
+		"TopicType_PubEvent": "apps/{appId}/events/{identifier}",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	c.Scheme = scheme
+	topic, err := c.EncodeTopic(TopicType_SubProperty, "+", "iott-002", "+")
+	assert.Nil(err)
+	assert.Equal("ns/iott-002/+/props", topic)
+	_, err = c.EncodeTopic(TopicType_SubEvent, "alarm", "iott-001", "iotd-001")
+	assert.NotNil(err)
+	topicType, thingId, deviceId, identifier, err := c.DecodeTopic("ns/iott-002/iotd-002/props")
+	assert.Nil(err)
+	assert.Equal([]string{TopicType_SubProperty, "iott-002", "iotd-002", ""}, []string{topicType, thingId, deviceId, identifier})
+	topicType, thingId, deviceId, identifier, err = c.DecodeTopic("apps/app-001/events/alarm")
+	assert.Nil(err)
+	assert.Equal([]string{TopicType_PubEvent, "iott-001", "iotd-001", "alarm"}, []string{topicType, thingId, deviceId, identifier})
+	_, _, _, _, err = c.DecodeTopic("apps/app-002/events/alarm")
+	assert.NotNil(err)
+	src := `{"identifier":"reboot","messageId":"msg-001","params":{"delay":5}}`
+	topic, data, err := c.EncodeMessage(TopicType_SubService, "iott-001", "iotd-001", []byte(src))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal("ns/iott-001/iotd-001/call/reboot", topic)
+	topicType, _, _, decoded, err := c.DecodeMessage(topic, data)
+	assert.Nil(err)
+	assert.Equal(TopicType_SubService, topicType)
+	assert.JSONEq(src, string(decoded))
+}
+
+func TestCodec_Version(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	topic := "/sys/iott-001/iotd-001/thing/service/reboot/call"
+	msg, err := c.Decode(topic, []byte(`{"id":"msg-001","version":"1.3","type":"thing.service.reboot.call","params":{"delay":5}}`))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal("1.3", msg.Version)
+	_, err = c.Decode(topic, []byte(`{"id":"msg-001","version":"9.0","params":{}}`))
+	assert.True(errors.Is(err, ErrUnsupportedVersion))
+	//2.0版本的参数放在args字段中
+	RegisterVersion("2.0", func(msg map[string]interface{}) (map[string]interface{}, error) {
+		msg["params"] = msg["args"]
+		delete(msg, "args")
+		return msg, nil
+	})
+	defer UnregisterVersion("2.0")
+	msg, err = c.Decode(topic, []byte(`{"id":"msg-001","version":"2.0","args":{"delay":9007199254740993}}`))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal("2.0", msg.Version)
+	assert.JSONEq(`{"messageId":"msg-001","identifier":"reboot","params":{"delay":9007199254740993}}`, string(msg.Payload))
+}
+
+//同一主版本内按照数字选择最新的次版本
+func TestCodec_VersionOrder(t *testing.T) {
+	assert := assert.New(t)
+	rename := func(from string) VersionTransform {
+		return func(msg map[string]interface{}) (map[string]interface{}, error) {
+			msg["params"] = msg[from]
+			delete(msg, from)
+			return msg, nil
+		}
+	}
+	RegisterVersion("3.9", rename("old"))
+	defer UnregisterVersion("3.9")
+	RegisterVersion("3.10", rename("new"))
+	defer UnregisterVersion("3.10")
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	topic := "/sys/iott-001/iotd-001/thing/service/reboot/call"
+	msg, err := c.Decode(topic, []byte(`{"id":"msg-001","version":"3.11","new":{"delay":5}}`))
+	if assert.Nil(err) {
+		assert.JSONEq(`{"messageId":"msg-001","identifier":"reboot","params":{"delay":5}}`, string(msg.Payload))
+	}
+	assert.Equal([]string{DefaultMessageVersion, "3.9", "3.10"}, SupportedVersions())
+	assert.True(compareVersion("1.10", "1.9") > 0)
+	assert.True(compareVersion("1.9", "1.10") < 0)
+	assert.True(compareVersion("2", "1.10") > 0)
+	assert.Equal(0, compareVersion("1.0", "1.0"))
+	//当前版本不能删除
+	UnregisterVersion(DefaultMessageVersion)
+	_, ok := lookupVersion(DefaultMessageVersion)
+	assert.True(ok)
+}
+
+func TestCodec_Metadata(t *testing.T) {
+	assert := assert.New(t)
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	src := `{"identifier":"alarm","timestamp":1593274999806,"params":{"temp":81}}`
+	topic, data, err := c.EncodeMessageWithSource(TopicType_PubEvent, "iott-001", "iotd-001", []byte(src), []string{"iotd-002", "app-002"})
+	if !assert.Nil(err) {
+		return
+	}
+	msg, err := c.Decode(topic, data)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.NotEmpty(msg.MessageId)
+	assert.Equal("thing.event.alarm.post", msg.RawType)
+	assert.Equal([]string{"iotd-002", "app-002"}, msg.Source)
+	assert.True(msg.EpochTime > 0)
+	assert.Equal(DefaultMessageVersion, msg.Version)
+}
+
+func TestCodec_MalformedInput(t *testing.T) {
+	assert := assert.New(t)
+	proxy := NewCodec("app-001", "iotd-001", "iott-001", true)
+	//代理模式下7级的sys topic
+	_, _, _, _, err := proxy.DecodeTopic("/sys/iott-001/iotd-001/thing/service/reboot")
+	assert.NotNil(err)
+	_, _, _, _, err = proxy.DecodeTopic("/edge/app-001/thing/event/alarm/post/x")
+	assert.NotNil(err)
+	topicType, _, _, identifier, err := proxy.DecodeTopic("/sys/iott-001/iotd-001/thing/service/reboot/call")
+	assert.Nil(err)
+	assert.Equal(TopicType_SubService, topicType)
+	assert.Equal("reboot", identifier)
+
+	//事件参数为空
+	c := NewCodec("app-001", "iotd-001", "iott-001", false)
+	for _, payload := range []string{`{"params":null}`, `{}`} {
+		_, err = c.Decode("/sys/iott-001/iotd-001/thing/event/alarm/post", []byte(payload))
+		assert.NotNil(err, payload)
+	}
+}
@@ -0,0 +1,115 @@
+//go:build go1.18
+// +build go1.18
+
+package codec
+
+import (
+	"testing"
+)
+
+//模糊测试使用的topic方案，包括普通模式、代理模式和模版方案
+func fuzzCodecs(t testing.TB) []*Codec {
+	scheme, err := NewTemplateTopicScheme("app-001", "iott-001", "iotd-001", map[string]string{
+		"SubProperty": "ns/{thingId}/{deviceId}/props",
+		"SubEvent": "ns/{thingId}/{deviceId}/events/{identifier}",
+		"SubService": "ns/{thingId}/{deviceId}/call/{identifier}",
+		"PubEvent": "apps/{appId}/events/{identifier}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := NewCodec("app-001", "iotd-001", "iott-001", false)
+	template.Scheme = scheme
+	return []*Codec{
+		NewCodec("app-001", "iotd-001", "iott-001", false),
+		NewCodec("app-001", "iotd-001", "iott-001", true),
+		template,
+	}
+}
+
+var fuzzTopics = []string{
+	"/sys/iott-001/iotd-001/thing/property/base/post",
+	"/sys/iott-001/iotd-001/thing/property/base/set",
+	"/sys/iott-001/iotd-001/thing/event/alarm/post",
+	"/sys/iott-001/iotd-001/thing/service/reboot/call",
+	"/sys/iott-001/iotd-001/thing/service/reboot/call_reply",
+	"/sys/iott-001/iotd-001/thing/service/reboot",
+	"/edge/app-001/thing/property/base/post",
+	"/edge/app-001/thing/property/base/control",
+	"/edge/app-001/thing/event/alarm/control",
+	"/edge/app-001/thing/service/reboot/call",
+	"/edge/app-001/thing/event/alarm/post/x",
+	"ns/iott-001/iotd-001/events/alarm",
+	"apps/app-001/events/alarm",
+	"",
+	"/",
+	"///////",
+}
+
+//解码topic不能panic，解码成功时按照相同的topic类型编码后可以再次解码为相同结果
+func FuzzDecodeTopic(f *testing.F) {
+	for _, topic := range fuzzTopics {
+		f.Add(topic)
+	}
+	codecs := fuzzCodecs(f)
+	f.Fuzz(func(t *testing.T, topic string) {
+		for _, c := range codecs {
+			topicType, thingId, deviceId, identifier, err := c.DecodeTopic(topic)
+			if err != nil {
+				continue
+			}
+			encoded, err := c.EncodeTopic(topicType, identifier, thingId, deviceId)
+			if err != nil {
+				continue
+			}
+			topicType2, thingId2, deviceId2, identifier2, err := c.DecodeTopic(encoded)
+			if err != nil {
+				t.Fatalf("decode encoded topic %q of %q failed: %v", encoded, topic, err)
+			}
+			if topicType2 != topicType || thingId2 != thingId || deviceId2 != deviceId || identifier2 != identifier {
+				t.Fatalf("topic %q decoded as %s/%s/%s/%s, encoded topic %q decoded as %s/%s/%s/%s", topic,
+					topicType, thingId, deviceId, identifier, encoded, topicType2, thingId2, deviceId2, identifier2)
+			}
+		}
+	})
+}
+
+//解码任意topic和消息负载不能panic
+func FuzzDecodeMessage(f *testing.F) {
+	payloads := []string{
+		`{"id":"msg-001","version":"1.0","type":"thing.property.post","params":{"temp":{"value":25,"time":1593274999806}}}`,
+		`{"id":"msg-001","version":"1.0","type":"thing.property.batch.post","params":{"temp":[{"value":25,"time":1},null]}}`,
+		`{"id":"msg-001","version":"1.0","type":"thing.property.set","params":{"temp":25,"mode":{"value":"auto"}}}`,
+		`{"id":"msg-001","version":"1.0","type":"thing.event.alarm.post","params":{"value":{"code":1},"level":"warn","time":1}}`,
+		`{"id":"msg-001","version":"1.0","type":"thing.service.reboot.call","params":{"delay":5}}`,
+		`{"id":"msg-001","version":"1.0","code":200,"data":{"result":"ok"}}`,
+		`{"params":null}`,
+		`{"version":"1.3","metadata":{"source":["a"],"epochTime":1}}`,
+		`{"version":null}`,
+		`null`,
+		``,
+		"\xd9\xd9\xf7\xa1\x66params\xf6",
+		"\x0a\x00",
+	}
+	for _, topic := range fuzzTopics {
+		for _, payload := range payloads {
+			f.Add(topic, []byte(payload))
+		}
+	}
+	codecs := fuzzCodecs(f)
+	//二进制格式的负载只有在配置了对应格式时才会解码
+	for _, format := range []string{PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if err != nil {
+			f.Fatal(err)
+		}
+		c := NewCodec("app-001", "iotd-001", "iott-001", false)
+		c.Payload = payload
+		codecs = append(codecs, c)
+	}
+	f.Fuzz(func(t *testing.T, topic string, payload []byte) {
+		for _, c := range codecs {
+			c.Decode(topic, payload)
+		}
+	})
+}
@@ -0,0 +1,395 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	二进制格式编解码使用的反射工具：编码时直接遍历MDMP消息结构体，解码时先解码为通用数据结构，
+	再按照json标签赋值到目标结构体，不经过JSON文本的转换；
+	通用数据结构中整数为int64或者uint64，浮点数为float64，对象为map[string]interface{}，数组为[]interface{}
+*/
+
+var (
+	jsonNumberType 	= reflect.TypeOf(json.Number(""))
+	rawMessageType 	= reflect.TypeOf(json.RawMessage(nil))
+	marshalerType 	= reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+//按照json标签解析的结构体字段
+type structField struct {
+	name 		string
+	index 		[]int
+	omitEmpty 	bool
+}
+
+//结构体类型与字段列表的对应关系
+var fieldCache sync.Map
+
+//结构体的json字段，匿名嵌入的结构体字段展开到外层，与encoding/json相同外层字段优先，按照字段定义的顺序排列
+func cachedFields(rt reflect.Type) []*structField {
+	if fields, ok := fieldCache.Load(rt); ok {
+		return fields.([]*structField)
+	}
+	fields := make([]*structField, 0, rt.NumField())
+	names := make(map[string]bool)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			for _, inner := range cachedFields(field.Type) {
+				temp := *inner
+				temp.index = append([]int{i}, inner.index...)
+				fields = append(fields, &temp)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		names[name] = true
+		fields = append(fields, &structField{name: name, index: []int{i}, omitEmpty: omitEmpty})
+	}
+	result := make([]*structField, 0, len(fields))
+	for _, field := range fields {
+		if len(field.index) > 1 {
+			if names[field.name] {
+				continue
+			}
+			names[field.name] = true
+		}
+		result = append(result, field)
+	}
+	fieldCache.Store(rt, result)
+	return result
+}
+
+//按照名称查找字段，与encoding/json相同优先精确匹配，其次忽略大小写匹配
+func findField(fields []*structField, name string) *structField {
+	for _, field := range fields {
+		if field.name == name {
+			return field
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.name, name) {
+			return field
+		}
+	}
+	return nil
+}
+
+//实现了json.Marshaler的自定义类型，如time.Time和json.RawMessage，按照JSON的结果转换为通用数据结构
+func marshalerValue(rv reflect.Value) (interface{}, bool, error) {
+	if rv.Kind() == reflect.Ptr && rv.IsNil() || !rv.Type().Implements(marshalerType) {
+		return nil, false, nil
+	}
+	data, err := json.Marshal(rv.Interface())
+	if err != nil {
+		return nil, true, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, true, err
+	}
+	return value, true, nil
+}
+
+//map的key转换为字符串并排序，保证编码结果确定
+func sortedMapKeys(rv reflect.Value) ([]string, map[string]reflect.Value, error) {
+	keys := make([]string, 0, rv.Len())
+	values := make(map[string]reflect.Value, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		var key string
+		k := iter.Key()
+		switch k.Kind() {
+		case reflect.String:
+			key = k.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return nil, nil, fmt.Errorf("unsupported map key type %s", k.Type())
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+	return keys, values, nil
+}
+
+//json.Number按照整数或者浮点数编码
+func parseNumber(n json.Number) (interface{}, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	return checkFloat(f)
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+//将通用数据结构赋值到目标，类型规则与encoding/json相同，未知的字段忽略
+func assignGeneric(value interface{}, rv reflect.Value) error {
+	if rv.Type() == rawMessageType {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		rv.SetBytes(data)
+		return nil
+	}
+	if value == nil {
+		switch rv.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			rv.Set(reflect.Zero(rv.Type()))
+		}
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return assignGeneric(value, rv.Elem())
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return mismatchError(value, rv)
+		}
+		rv.Set(reflect.ValueOf(value))
+		return nil
+	case reflect.Struct:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatchError(value, rv)
+		}
+		targets := cachedFields(rv.Type())
+		for k, v := range fields {
+			field := findField(targets, k)
+			if field == nil {
+				continue
+			}
+			err := assignGeneric(v, rv.FieldByIndex(field.index))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		fields, ok := value.(map[string]interface{})
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return mismatchError(value, rv)
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMapWithSize(rv.Type(), len(fields)))
+		}
+		for k, v := range fields {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			err := assignGeneric(v, elem)
+			if err != nil {
+				return err
+			}
+			rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			switch v := value.(type) {
+			case []byte:
+				rv.SetBytes(append([]byte{}, v...))
+				return nil
+			case string:
+				data, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return err
+				}
+				rv.SetBytes(data)
+				return nil
+			}
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatchError(value, rv)
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(items), len(items))
+		for i, item := range items {
+			err := assignGeneric(item, slice.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+	case reflect.String:
+		if rv.Type() == jsonNumberType {
+			switch v := value.(type) {
+			case int64:
+				rv.SetString(strconv.FormatInt(v, 10))
+				return nil
+			case uint64:
+				rv.SetString(strconv.FormatUint(v, 10))
+				return nil
+			case float64:
+				rv.SetString(strconv.FormatFloat(v, 'g', -1, 64))
+				return nil
+			}
+		}
+		str, ok := value.(string)
+		if !ok {
+			return mismatchError(value, rv)
+		}
+		rv.SetString(str)
+		return nil
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return mismatchError(value, rv)
+		}
+		rv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch v := value.(type) {
+		case int64:
+			i = v
+		case uint64:
+			if v > math.MaxInt64 {
+				return mismatchError(value, rv)
+			}
+			i = int64(v)
+		case float64:
+			if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+				return mismatchError(value, rv)
+			}
+			i = int64(v)
+		default:
+			return mismatchError(value, rv)
+		}
+		if rv.OverflowInt(i) {
+			return mismatchError(value, rv)
+		}
+		rv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch v := value.(type) {
+		case int64:
+			if v < 0 {
+				return mismatchError(value, rv)
+			}
+			u = uint64(v)
+		case uint64:
+			u = v
+		case float64:
+			if v != math.Trunc(v) || v < 0 || v >= math.MaxUint64 {
+				return mismatchError(value, rv)
+			}
+			u = uint64(v)
+		default:
+			return mismatchError(value, rv)
+		}
+		if rv.OverflowUint(u) {
+			return mismatchError(value, rv)
+		}
+		rv.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		switch v := value.(type) {
+		case int64:
+			rv.SetFloat(float64(v))
+		case uint64:
+			rv.SetFloat(float64(v))
+		case float64:
+			rv.SetFloat(v)
+		default:
+			return mismatchError(value, rv)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported target type %s", rv.Type())
+}
+
+func mismatchError(value interface{}, rv reflect.Value) error {
+	return fmt.Errorf("cannot unmarshal %T into Go value of type %s", value, rv.Type())
+}
+
+//解码结果赋值到v，v必须是非nil指针
+func assignTo(value interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("unmarshal target should be a non-nil pointer")
+	}
+	return assignGeneric(value, rv.Elem())
+}
+
+//通用数据结构中的整数和浮点数转换为json.Number，用于消息版本转换函数
+func toJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toJSONNumbers(item)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = toJSONNumbers(item)
+		}
+	}
+	return value
+}
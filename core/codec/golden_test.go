@@ -0,0 +1,235 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+/*
+	CBOR测试向量，来自RFC 8949附录A；编码总是使用64位浮点数，
+	RFC中使用16位和32位浮点数的示例只用于解码
+*/
+var cborVectors = []struct {
+	hex 	string
+	value 	interface{}
+	//是否检查编码结果
+	encode 	bool
+}{
+	{"00", int64(0), true},
+	{"01", int64(1), true},
+	{"0a", int64(10), true},
+	{"17", int64(23), true},
+	{"1818", int64(24), true},
+	{"1819", int64(25), true},
+	{"1864", int64(100), true},
+	{"1903e8", int64(1000), true},
+	{"1a000f4240", int64(1000000), true},
+	{"1b000000e8d4a51000", int64(1000000000000), true},
+	{"1bffffffffffffffff", uint64(math.MaxUint64), true},
+	{"3bffffffffffffffff", -18446744073709551616.0, false},
+	{"20", int64(-1), true},
+	{"29", int64(-10), true},
+	{"3863", int64(-100), true},
+	{"3903e7", int64(-1000), true},
+	{"f90000", 0.0, false},
+	{"f93c00", 1.0, false},
+	{"fb3ff199999999999a", 1.1, true},
+	{"f93e00", 1.5, false},
+	{"f97bff", 65504.0, false},
+	{"fa47c35000", 100000.0, false},
+	{"fa7f7fffff", 3.4028234663852886e+38, false},
+	{"fb7e37e43c8800759c", 1.0e+300, true},
+	{"f90001", 5.960464477539063e-8, false},
+	{"f90400", 0.00006103515625, false},
+	{"f9c400", -4.0, false},
+	{"fbc010666666666666", -4.1, true},
+	{"f4", false, true},
+	{"f5", true, true},
+	{"f6", nil, true},
+	{"c11a514b67b0", int64(1363896240), false},
+	{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z", false},
+	{"40", []byte{}, true},
+	{"4401020304", []byte{1, 2, 3, 4}, true},
+	{"60", "", true},
+	{"6161", "a", true},
+	{"6449455446", "IETF", true},
+	{"62225c", "\"\\", true},
+	{"62c3bc", "ü", true},
+	{"63e6b0b4", "水", true},
+	{"64f0908591", "\U00010151", true},
+	{"80", []interface{}{}, true},
+	{"83010203", []interface{}{int64(1), int64(2), int64(3)}, true},
+	{"8301820203820405", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, true},
+	{"a0", map[string]interface{}{}, true},
+	{"a201020304", map[string]interface{}{"1": int64(2), "3": int64(4)}, false},
+	{"a26161016162820203", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, true},
+	{"826161a161626163", []interface{}{"a", map[string]interface{}{"b": "c"}}, true},
+	{"a56161614161626142616361436164614461656145", map[string]interface{}{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}, true},
+	{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}, false},
+	{"7f657374726561646d696e67ff", "streaming", false},
+	{"9fff", []interface{}{}, false},
+	{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, false},
+	{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, false},
+	{"bf6346756ef563416d7421ff", map[string]interface{}{"Fun": true, "Amt": int64(-2)}, false},
+}
+
+func TestCBOR_RFC8949Vectors(t *testing.T) {
+	assert := assert.New(t)
+	for _, vector := range cborVectors {
+		data, err := hex.DecodeString(vector.hex)
+		if !assert.Nil(err, vector.hex) {
+			continue
+		}
+		d := &cborDecoder{data: data}
+		value, err := d.decode(0)
+		if assert.Nil(err, vector.hex) {
+			assert.Equal(vector.value, value, vector.hex)
+			assert.Equal(len(data), d.pos, vector.hex)
+		}
+		if vector.encode {
+			buf := &bytes.Buffer{}
+			err = cborEncode(buf, reflect.ValueOf(vector.value), 0)
+			if assert.Nil(err, vector.hex) {
+				assert.Equal(vector.hex, hex.EncodeToString(buf.Bytes()), vector.hex)
+			}
+		}
+	}
+}
+
+/*
+	Protobuf测试向量：testdata/protobuf/*.txtpb为mdmp.proto的文本格式消息，
+	*.bin为参考实现编码的结果，生成方法见testdata/protobuf/gen.go
+*/
+func TestProtobuf_GoldenVectors(t *testing.T) {
+	assert := assert.New(t)
+	header := func(id string, msgType string, metadata *ModelMetadata) MdmpMsgHeader {
+		return MdmpMsgHeader{ID: id, Version: DefaultMessageVersion, Type: msgType, Metadata: metadata}
+	}
+	cases := []struct {
+		name 	string
+		msg 	interface{}
+		//解码的目标
+		decoded interface{}
+	}{
+		{
+			name: "property",
+			msg: &MdmpPropertyMsg{
+				MdmpMsgHeader: header("msg-001", MessageTypeTemplate_Property, &ModelMetadata{
+					ModelId: "iott-001",
+					EntityId: "iotd-001",
+					Source: []string{"iotd-002", "app-002"},
+					EpochTime: 1593274999806,
+				}),
+				Params: map[string]*ModelPropertyData{
+					"count": {Value: int64(9007199254740993), Time: 1593274999806},
+					"flags": {Value: []interface{}{true, false}, Time: 1593274999806},
+					"mode": {Value: "auto", Time: 1593274999806},
+					"offset": {Value: int64(-42), Time: 1593274999806},
+					"temp": {Value: 25.5, Time: 1593274999806},
+					"unset": {Value: nil},
+				},
+			},
+			decoded: &MdmpPropertyMsg{},
+		},
+		{
+			name: "batch",
+			msg: &MdmpPropertyBatchMsg{
+				MdmpMsgHeader: header("msg-002", MessageTypeTemplate_PropertyBatch, &ModelMetadata{
+					ModelId: "iott-001",
+					EntityId: "iotd-001",
+					EpochTime: 3,
+				}),
+				Params: map[string][]*ModelPropertyData{
+					"temp": {{Value: int64(20), Time: 1}, {Value: 20.5, Time: 2}},
+				},
+			},
+			decoded: &MdmpPropertyBatchMsg{},
+		},
+		{
+			name: "event",
+			msg: &MdmpEventMsg{
+				MdmpMsgHeader: header("msg-003", "thing.event.overheat.post", &ModelMetadata{
+					ModelId: "iott-001",
+					EntityId: "iotd-001",
+					EpochTime: 1593274999806,
+				}),
+				Params: &ModelEventData{
+					Value: map[string]interface{}{
+						"detail": map[string]interface{}{"sensor": "s1"},
+						"temp": 81.5,
+					},
+					Message: "too hot",
+					Level: "warn",
+					Time: 1593274999806,
+				},
+			},
+			decoded: &MdmpEventMsg{},
+		},
+		{
+			name: "service",
+			msg: &MdmpServiceCallMsg{
+				MdmpMsgHeader: MdmpMsgHeader{
+					ID: "msg-004",
+					Version: DefaultMessageVersion,
+					Type: "thing.service.reboot.call",
+					Metadata: &ServiceMetadata{ModelId: "iott-001", EntityId: "iotd-001"},
+				},
+				Params: map[string]interface{}{
+					"big": uint64(math.MaxUint64),
+					"delay": int64(5),
+					"items": []interface{}{int64(1), "a", nil},
+					"min": int64(math.MinInt64),
+					"raw": []byte{1, 2, 0xff},
+				},
+			},
+			decoded: &MdmpServiceCallMsg{},
+		},
+		{
+			name: "reply",
+			msg: &MdmpServiceReplyMsg{
+				MdmpMsgReplyHeader: MdmpMsgReplyHeader{ID: "msg-004", Version: DefaultMessageVersion, Code: -1},
+				Data: map[string]interface{}{"message": "失败"},
+			},
+			decoded: &MdmpServiceReplyMsg{},
+		},
+	}
+	codec := &ProtobufPayloadCodec{}
+	for _, tc := range cases {
+		golden, err := ioutil.ReadFile(filepath.Join("testdata", "protobuf", tc.name+".bin"))
+		if !assert.Nil(err, tc.name) {
+			continue
+		}
+		data, err := codec.Marshal(tc.msg)
+		if !assert.Nil(err, tc.name) {
+			continue
+		}
+		assert.Equal(hex.EncodeToString(golden), hex.EncodeToString(data), tc.name)
+		//解码参考实现的编码结果，元信息解码为通用数据结构，只比较消息内容
+		err = codec.Unmarshal(golden, tc.decoded)
+		if !assert.Nil(err, tc.name) {
+			continue
+		}
+		expected := reflect.ValueOf(tc.msg).Elem()
+		actual := reflect.ValueOf(tc.decoded).Elem()
+		for i := 0; i < expected.NumField(); i++ {
+			if expected.Type().Field(i).Anonymous {
+				continue
+			}
+			assert.Equal(expected.Field(i).Interface(), actual.Field(i).Interface(), tc.name)
+		}
+		//元信息解码为map，重新编码前换回原始的元信息类型，解码后再编码应与参考实现的结果一致
+		if metadata := actual.FieldByName("Metadata"); metadata.IsValid() {
+			metadata.Set(expected.FieldByName("Metadata"))
+		}
+		reencoded, err := codec.Marshal(tc.decoded)
+		if assert.Nil(err, tc.name) {
+			assert.Equal(hex.EncodeToString(golden), hex.EncodeToString(reencoded), tc.name)
+		}
+	}
+}
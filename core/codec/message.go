@@ -1,5 +1,7 @@
 package codec
 
+import "encoding/json"
+
 //默认消息格式版本
 const DefaultMessageVersion	= "1.0"
 
@@ -13,6 +15,10 @@ const (
 	MessageTypeTemplate_Event 		= "thing.event.%s.post"
 	//服务调用类型模版
 	MessageTypeTemplate_Service 	= "thing.service.%s.call"
+	//属性设置类型模版
+	MessageTypeTemplate_PropertySet = "thing.property.set"
+	//批量属性类型模版，同一个属性包含多个采样值
+	MessageTypeTemplate_PropertyBatch = "thing.property.batch.post"
 )
 
 /*
@@ -96,6 +102,13 @@ type MdmpPropertyMsg struct {
 	Params 		map[string]*ModelPropertyData 	`json:"params"`
 }
 
+//批量属性消息，每个属性标识id对应多个按时间排序的采样值
+type MdmpPropertyBatchMsg struct {
+	MdmpMsgHeader
+	//模型属性数据
+	Params 		map[string][]*ModelPropertyData 	`json:"params"`
+}
+
 /*
 	模型事件消息结构定义
 */
@@ -114,4 +127,14 @@ type MdmpEventMsg struct {
 	MdmpMsgHeader
 	//模型时间数据
 	Params 		*ModelEventData			`json:"params"`
-}
\ No newline at end of file
+}
+
+/*
+	未解析属性值的属性消息结构定义，用于解码属性设置和批量属性消息，
+	属性值可以是ModelPropertyData格式、ModelPropertyData数组或者直接是属性值
+*/
+type MdmpRawPropertyMsg struct {
+	MdmpMsgHeader
+	//待设置的属性数据
+	Params 		map[string]json.RawMessage 	`json:"params"`
+}
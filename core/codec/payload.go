@@ -0,0 +1,158 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+/*
+	消息负载格式定义
+*/
+const (
+	//JSON格式，默认格式
+	PayloadFormat_JSON 		= "json"
+	//CBOR格式
+	PayloadFormat_CBOR 		= "cbor"
+	//Protobuf格式，消息定义见mdmp.proto
+	PayloadFormat_Protobuf 	= "protobuf"
+)
+
+//解码为通用数据结构，用于消息版本转换
+type genericDecoder interface {
+	decodeGeneric(data []byte) (interface{}, error)
+}
+
+/*
+	消息负载编解码接口，用于MDMP消息与二进制数据之间的转换
+*/
+type PayloadCodec interface {
+	//编码消息，v为MDMP消息结构体
+	Marshal(v interface{}) ([]byte, error)
+	//解码消息到v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//根据格式名称创建消息负载编解码器，为空时使用JSON格式
+func NewPayloadCodec(format string) (PayloadCodec, error) {
+	switch strings.ToLower(format) {
+	case "", PayloadFormat_JSON:
+		return &JSONPayloadCodec{}, nil
+	case PayloadFormat_CBOR:
+		return &CBORPayloadCodec{}, nil
+	case PayloadFormat_Protobuf:
+		return &ProtobufPayloadCodec{}, nil
+	}
+	return nil, errors.New("unsupported payload format: " + format)
+}
+
+//使用配置的编解码器编码MDMP消息
+func (c *Codec) marshalPayload(v interface{}) ([]byte, error) {
+	if c.Payload == nil {
+		return json.Marshal(v)
+	}
+	return c.Payload.Marshal(v)
+}
+
+/*
+	选择解码收到的消息的编解码器：以'{'开头的负载为JSON对象，平台下发的消息和JSON格式的应用总是可以解码；
+	其他负载按照配置的格式(EDGE_PAYLOAD_FORMAT)解码，不根据负载内容猜测格式，格式不符时解码失败。
+	CBOR负载以标准的自描述标签(RFC 8949 3.4.6，0xd9d9f7)开头，Protobuf负载为mdmp.proto中定义的Message，
+	两者的第一个字节都不会是'{'
+*/
+func (c *Codec) inboundCodec(data []byte) PayloadCodec {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if c.Payload == nil || len(trimmed) > 0 && trimmed[0] == '{' {
+		return &JSONPayloadCodec{}
+	}
+	return c.Payload
+}
+
+//按照配置的格式解码MDMP消息
+func (c *Codec) unmarshalPayload(data []byte, v interface{}) error {
+	return c.inboundCodec(data).Unmarshal(data, v)
+}
+
+//按照配置的格式解码数据，用于直接解析MDMP消息
+func (c *Codec) UnmarshalPayload(data []byte, v interface{}) error {
+	return c.unmarshalPayload(data, v)
+}
+
+/*
+	JSON格式编解码器
+*/
+type JSONPayloadCodec struct{}
+
+func (p *JSONPayloadCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (p *JSONPayloadCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+/*
+	CBOR格式编解码器(RFC 8949)
+*/
+type CBORPayloadCodec struct{}
+
+func (p *CBORPayloadCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.Write(cborSelfDescribe)
+	err := cborEncode(buf, reflect.ValueOf(v), 0)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *CBORPayloadCodec) Unmarshal(data []byte, v interface{}) error {
+	value, err := p.decodeGeneric(data)
+	if err != nil {
+		return err
+	}
+	return assignTo(value, v)
+}
+
+func (p *CBORPayloadCodec) decodeGeneric(data []byte) (interface{}, error) {
+	if !bytes.HasPrefix(data, cborSelfDescribe) {
+		return nil, errors.New("invalid cbor payload")
+	}
+	d := &cborDecoder{data: data[len(cborSelfDescribe):]}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, errors.New("invalid cbor payload: trailing data")
+	}
+	return value, nil
+}
+
+/*
+	Protobuf格式编解码器，消息定义见mdmp.proto，对端可以使用protoc生成的代码解析
+*/
+type ProtobufPayloadCodec struct{}
+
+func (p *ProtobufPayloadCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := pbEncodeMessage(buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *ProtobufPayloadCodec) Unmarshal(data []byte, v interface{}) error {
+	value, err := p.decodeGeneric(data)
+	if err != nil {
+		return err
+	}
+	return assignTo(value, v)
+}
+
+func (p *ProtobufPayloadCodec) decodeGeneric(data []byte) (interface{}, error) {
+	return pbDecodeMessage(data)
+}
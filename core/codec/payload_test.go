@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+//用于比较负载格式的属性消息，包含多个整数、浮点数和字符串属性
+func testPayloadMsg() *MdmpPropertyMsg {
+	msg := &MdmpPropertyMsg{
+		MdmpMsgHeader: MdmpMsgHeader{
+			ID: "3f3ad5f2-b9a1-11ea-9f4b-0242ac110002",
+			Version: DefaultMessageVersion,
+			Type: MessageTypeTemplate_Property,
+			Metadata: &ModelMetadata{
+				ModelId: "iott-001",
+				EntityId: "iotd-001",
+				Source: []string{},
+				EpochTime: 1593274999806,
+			},
+		},
+		Params: make(map[string]*ModelPropertyData),
+	}
+	for i := 0; i < 8; i++ {
+		msg.Params[fmt.Sprintf("counter%d", i)] = &ModelPropertyData{Value: int64(1000000 + i), Time: 1593274999806}
+		msg.Params[fmt.Sprintf("temp%d", i)] = &ModelPropertyData{Value: 25.5 + float64(i), Time: 1593274999806}
+		msg.Params[fmt.Sprintf("mode%d", i)] = &ModelPropertyData{Value: "auto", Time: 1593274999806}
+	}
+	return msg
+}
+
+func TestPayloadCodec_Size(t *testing.T) {
+	assert := assert.New(t)
+	sizes := make(map[string]int)
+	for _, format := range []string{PayloadFormat_JSON, PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if !assert.Nil(err) {
+			return
+		}
+		data, err := payload.Marshal(testPayloadMsg())
+		if !assert.Nil(err, format) {
+			return
+		}
+		sizes[format] = len(data)
+	}
+	assert.Less(sizes[PayloadFormat_CBOR], sizes[PayloadFormat_JSON])
+	assert.Less(sizes[PayloadFormat_Protobuf], sizes[PayloadFormat_JSON])
+}
+
+//整数不经过浮点数转换，超过2^53的值不会丢失精度
+func TestPayloadCodec_IntegerPrecision(t *testing.T) {
+	assert := assert.New(t)
+	values := []interface{}{int64(1<<53 + 1), int64(math.MaxInt64), int64(math.MinInt64), uint64(math.MaxUint64), int64(-1)}
+	for _, format := range []string{PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if !assert.Nil(err) {
+			return
+		}
+		for _, value := range values {
+			src := &MdmpServiceCallMsg{Params: map[string]interface{}{"value": value}}
+			src.ID = "msg-001"
+			data, err := payload.Marshal(src)
+			if !assert.Nil(err, format) {
+				return
+			}
+			dst := &MdmpServiceCallMsg{}
+			err = payload.Unmarshal(data, dst)
+			if !assert.Nil(err, format) {
+				return
+			}
+			assert.Equal(fmt.Sprint(value), fmt.Sprint(dst.Params["value"]), format)
+		}
+	}
+}
+
+//CBOR负载为标准格式，自描述标签之后是普通的CBOR map
+func TestPayloadCodec_CBORStandard(t *testing.T) {
+	assert := assert.New(t)
+	data, err := (&CBORPayloadCodec{}).Marshal(&MdmpServiceReplyMsg{MdmpMsgReplyHeader: MdmpMsgReplyHeader{ID: "1", Code: 200}})
+	if !assert.Nil(err) {
+		return
+	}
+	//d9d9f7 a4 62"id" 61"1" 67"version" 60 64"code" 18c8 64"data" f6
+	expected := []byte{0xd9, 0xd9, 0xf7, 0xa4, 0x62, 'i', 'd', 0x61, '1', 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x60,
+		0x64, 'c', 'o', 'd', 'e', 0x18, 0xc8, 0x64, 'd', 'a', 't', 'a', 0xf6}
+	assert.Equal(expected, data)
+}
+
+/*
+	负载格式的编解码性能和大小比较：
+	go test ./core/codec -run XXX -bench PayloadCodec -benchmem
+*/
+func BenchmarkPayloadCodec(b *testing.B) {
+	for _, format := range []string{PayloadFormat_JSON, PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if err != nil {
+			b.Fatal(err)
+		}
+		msg := testPayloadMsg()
+		data, err := payload.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(format+"/Marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := payload.Marshal(msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+		})
+		b.Run(format+"/Unmarshal", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := payload.Unmarshal(data, &MdmpPropertyMsg{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+		})
+	}
+}
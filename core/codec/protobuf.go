@@ -0,0 +1,707 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+/*
+	Protobuf格式的MDMP消息编解码，消息定义见mdmp.proto：
+	编码时按照消息结构体的类型直接写入对应的字段，整数使用varint编码；
+	解码时转换为与JSON格式相同结构的通用数据结构，再赋值到目标结构体
+*/
+
+/*
+	protobuf wire类型定义
+*/
+const (
+	pbWireVarint 	= 0
+	pbWireFixed64 	= 1
+	pbWireBytes 	= 2
+	pbWireFixed32 	= 5
+)
+
+/*
+	mdmp.Message字段编号
+*/
+const (
+	pbMessageId 		= 1
+	pbMessageVersion 	= 2
+	pbMessageType 		= 3
+	pbMessageMetadata 	= 4
+	pbMessageCode 		= 5
+	pbMessageProperties = 6
+	pbMessageSamples 	= 7
+	pbMessageEvent 		= 8
+	pbMessageParams 	= 9
+	pbMessageData 		= 10
+)
+
+/*
+	mdmp.Value字段编号
+*/
+const (
+	pbValueNull 	= 1
+	pbValueNumber 	= 2
+	pbValueString 	= 3
+	pbValueBool 	= 4
+	pbValueStruct 	= 5
+	pbValueList 	= 6
+	pbValueInt 		= 7
+	pbValueUint 	= 8
+	pbValueBytes 	= 9
+)
+
+var errPBTruncated = errors.New("invalid protobuf payload: unexpected end of data")
+
+//编码MDMP消息结构体为mdmp.Message
+func pbEncodeMessage(buf *bytes.Buffer, v interface{}) error {
+	switch msg := v.(type) {
+	case *MdmpPropertyMsg:
+		err := pbEncodeHeader(buf, &msg.MdmpMsgHeader)
+		if err != nil {
+			return err
+		}
+		for _, k := range sortedKeys(len(msg.Params), func(fn func(string)) {
+			for k := range msg.Params {
+				fn(k)
+			}
+		}) {
+			prop := msg.Params[k]
+			err = pbWriteEntry(buf, pbMessageProperties, k, func(entry *bytes.Buffer) error {
+				return pbEncodeProperty(entry, prop)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case *MdmpPropertyBatchMsg:
+		err := pbEncodeHeader(buf, &msg.MdmpMsgHeader)
+		if err != nil {
+			return err
+		}
+		for _, k := range sortedKeys(len(msg.Params), func(fn func(string)) {
+			for k := range msg.Params {
+				fn(k)
+			}
+		}) {
+			values := msg.Params[k]
+			err = pbWriteEntry(buf, pbMessageSamples, k, func(entry *bytes.Buffer) error {
+				for _, value := range values {
+					err := pbWriteMessage(entry, 1, func(sample *bytes.Buffer) error {
+						return pbEncodeProperty(sample, value)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case *MdmpEventMsg:
+		err := pbEncodeHeader(buf, &msg.MdmpMsgHeader)
+		if err != nil {
+			return err
+		}
+		if msg.Params != nil {
+			return pbWriteMessage(buf, pbMessageEvent, func(evt *bytes.Buffer) error {
+				if msg.Params.Value != nil {
+					err := pbWriteMessage(evt, 1, func(st *bytes.Buffer) error {
+						return pbEncodeStruct(st, reflect.ValueOf(msg.Params.Value), 0)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				pbWriteString(evt, 2, msg.Params.Message)
+				pbWriteString(evt, 3, msg.Params.Level)
+				pbWriteInt(evt, 4, msg.Params.Time)
+				return nil
+			})
+		}
+	case *MdmpServiceCallMsg:
+		err := pbEncodeHeader(buf, &msg.MdmpMsgHeader)
+		if err != nil {
+			return err
+		}
+		if msg.Params != nil {
+			return pbWriteMessage(buf, pbMessageParams, func(st *bytes.Buffer) error {
+				return pbEncodeStruct(st, reflect.ValueOf(msg.Params), 0)
+			})
+		}
+	case *MdmpServiceReplyMsg:
+		pbWriteString(buf, pbMessageId, msg.ID)
+		pbWriteString(buf, pbMessageVersion, msg.Version)
+		pbWriteInt(buf, pbMessageCode, int64(msg.Code))
+		if msg.Data != nil {
+			return pbWriteMessage(buf, pbMessageData, func(st *bytes.Buffer) error {
+				return pbEncodeStruct(st, reflect.ValueOf(msg.Data), 0)
+			})
+		}
+	default:
+		return fmt.Errorf("protobuf: unsupported message type %T", v)
+	}
+	return nil
+}
+
+func pbEncodeHeader(buf *bytes.Buffer, header *MdmpMsgHeader) error {
+	pbWriteString(buf, pbMessageId, header.ID)
+	pbWriteString(buf, pbMessageVersion, header.Version)
+	pbWriteString(buf, pbMessageType, header.Type)
+	var metadata *ModelMetadata
+	switch m := header.Metadata.(type) {
+	case nil:
+		return nil
+	case *ModelMetadata:
+		metadata = m
+	case *ServiceMetadata:
+		metadata = &ModelMetadata{ModelId: m.ModelId, EntityId: m.EntityId}
+	default:
+		return fmt.Errorf("protobuf: unsupported metadata type %T", header.Metadata)
+	}
+	if metadata == nil {
+		return nil
+	}
+	return pbWriteMessage(buf, pbMessageMetadata, func(m *bytes.Buffer) error {
+		pbWriteString(m, 1, metadata.ModelId)
+		pbWriteString(m, 2, metadata.EntityId)
+		for _, source := range metadata.Source {
+			pbWriteBytes(m, 3, []byte(source))
+		}
+		pbWriteInt(m, 4, metadata.EpochTime)
+		return nil
+	})
+}
+
+//编码mdmp.Property，属性值总是写入，null也需要保留
+func pbEncodeProperty(buf *bytes.Buffer, prop *ModelPropertyData) error {
+	if prop == nil {
+		return nil
+	}
+	err := pbWriteMessage(buf, 1, func(value *bytes.Buffer) error {
+		return pbEncodeValue(value, reflect.ValueOf(prop.Value), 0)
+	})
+	if err != nil {
+		return err
+	}
+	pbWriteInt(buf, 2, prop.Time)
+	return nil
+}
+
+//编码mdmp.Struct，rv为map或者结构体，key按照字典序排列保证编码结果确定
+func pbEncodeStruct(buf *bytes.Buffer, rv reflect.Value, depth int) error {
+	if depth > maxPayloadDepth {
+		return errors.New("protobuf: nesting too deep")
+	}
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		keys, values, err := sortedMapKeys(rv)
+		if err != nil {
+			return fmt.Errorf("protobuf: %s", err.Error())
+		}
+		for _, k := range keys {
+			err := pbWriteEntry(buf, 1, k, func(value *bytes.Buffer) error {
+				return pbEncodeValue(value, values[k], depth+1)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for _, field := range cachedFields(rv.Type()) {
+			fv := rv.FieldByIndex(field.index)
+			if field.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			err := pbWriteEntry(buf, 1, field.name, func(value *bytes.Buffer) error {
+				return pbEncodeValue(value, fv, depth+1)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("protobuf: %s is not an object", rv.Type())
+	}
+	return nil
+}
+
+//编码mdmp.Value，规则与encoding/json相同，整数按照int_value编码
+func pbEncodeValue(buf *bytes.Buffer, rv reflect.Value, depth int) error {
+	if depth > maxPayloadDepth {
+		return errors.New("protobuf: nesting too deep")
+	}
+	if !rv.IsValid() {
+		pbWriteTag(buf, pbValueNull, pbWireVarint)
+		pbWriteVarint(buf, 0)
+		return nil
+	}
+	if rv.Type() == jsonNumberType {
+		value, err := parseNumber(json.Number(rv.String()))
+		if err != nil {
+			return err
+		}
+		return pbEncodeValue(buf, reflect.ValueOf(value), depth)
+	}
+	if value, ok, err := marshalerValue(rv); ok {
+		if err != nil {
+			return err
+		}
+		return pbEncodeValue(buf, reflect.ValueOf(value), depth+1)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return pbEncodeValue(buf, reflect.Value{}, depth)
+		}
+		return pbEncodeValue(buf, rv.Elem(), depth+1)
+	case reflect.Bool:
+		pbWriteTag(buf, pbValueBool, pbWireVarint)
+		if rv.Bool() {
+			pbWriteVarint(buf, 1)
+		} else {
+			pbWriteVarint(buf, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		pbWriteTag(buf, pbValueInt, pbWireVarint)
+		pbWriteVarint(buf, pbZigzag(rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() <= math.MaxInt64 {
+			pbWriteTag(buf, pbValueInt, pbWireVarint)
+			pbWriteVarint(buf, pbZigzag(int64(rv.Uint())))
+		} else {
+			pbWriteTag(buf, pbValueUint, pbWireVarint)
+			pbWriteVarint(buf, rv.Uint())
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, err := checkFloat(rv.Float()); err != nil {
+			return err
+		}
+		pbWriteTag(buf, pbValueNumber, pbWireFixed64)
+		temp := make([]byte, 8)
+		binary.LittleEndian.PutUint64(temp, math.Float64bits(rv.Float()))
+		buf.Write(temp)
+	case reflect.String:
+		pbWriteBytes(buf, pbValueString, []byte(rv.String()))
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return pbEncodeValue(buf, reflect.Value{}, depth)
+		}
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			pbWriteBytes(buf, pbValueBytes, rv.Bytes())
+			return nil
+		}
+		return pbWriteMessage(buf, pbValueList, func(list *bytes.Buffer) error {
+			for i := 0; i < rv.Len(); i++ {
+				err := pbWriteMessage(list, 1, func(value *bytes.Buffer) error {
+					return pbEncodeValue(value, rv.Index(i), depth+1)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case reflect.Map, reflect.Struct:
+		if rv.Kind() == reflect.Map && rv.IsNil() {
+			return pbEncodeValue(buf, reflect.Value{}, depth)
+		}
+		return pbWriteMessage(buf, pbValueStruct, func(st *bytes.Buffer) error {
+			return pbEncodeStruct(st, rv, depth+1)
+		})
+	default:
+		return fmt.Errorf("protobuf: unsupported type %s", rv.Type())
+	}
+	return nil
+}
+
+func pbZigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func pbUnzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func sortedKeys(n int, rangeFn func(fn func(string))) []string {
+	keys := make([]string, 0, n)
+	rangeFn(func(k string) {
+		keys = append(keys, k)
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+func pbWriteTag(buf *bytes.Buffer, field int, wire int) {
+	pbWriteVarint(buf, uint64(field<<3|wire))
+}
+
+func pbWriteVarint(buf *bytes.Buffer, v uint64) {
+	temp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(temp, v)
+	buf.Write(temp[:n])
+}
+
+func pbWriteBytes(buf *bytes.Buffer, field int, data []byte) {
+	pbWriteTag(buf, field, pbWireBytes)
+	pbWriteVarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+//proto3默认值不写入
+func pbWriteString(buf *bytes.Buffer, field int, s string) {
+	if s != "" {
+		pbWriteBytes(buf, field, []byte(s))
+	}
+}
+
+func pbWriteInt(buf *bytes.Buffer, field int, v int64) {
+	if v != 0 {
+		pbWriteTag(buf, field, pbWireVarint)
+		pbWriteVarint(buf, uint64(v))
+	}
+}
+
+//写入嵌套消息，fn写入消息内容
+func pbWriteMessage(buf *bytes.Buffer, field int, fn func(*bytes.Buffer) error) error {
+	temp := &bytes.Buffer{}
+	err := fn(temp)
+	if err != nil {
+		return err
+	}
+	pbWriteBytes(buf, field, temp.Bytes())
+	return nil
+}
+
+//写入map字段的一项，key为字段1，fn写入的value消息为字段2
+func pbWriteEntry(buf *bytes.Buffer, field int, key string, fn func(*bytes.Buffer) error) error {
+	return pbWriteMessage(buf, field, func(entry *bytes.Buffer) error {
+		pbWriteBytes(entry, 1, []byte(key))
+		return pbWriteMessage(entry, 2, fn)
+	})
+}
+
+//protobuf字段
+type pbField struct {
+	num 	int
+	wire 	int
+	varint 	uint64
+	data 	[]byte
+}
+
+//逐个读取字段，fn返回错误时停止
+func pbRangeFields(data []byte, fn func(f *pbField) error) error {
+	pos := 0
+	for pos < len(data) {
+		tag, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return errPBTruncated
+		}
+		pos += n
+		f := &pbField{num: int(tag >> 3), wire: int(tag & 0x7)}
+		switch f.wire {
+		case pbWireVarint:
+			v, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return errPBTruncated
+			}
+			pos += n
+			f.varint = v
+		case pbWireFixed64:
+			if len(data)-pos < 8 {
+				return errPBTruncated
+			}
+			f.data = data[pos : pos+8]
+			pos += 8
+		case pbWireBytes:
+			l, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return errPBTruncated
+			}
+			pos += n
+			if l > uint64(len(data)-pos) {
+				return errPBTruncated
+			}
+			f.data = data[pos : pos+int(l)]
+			pos += int(l)
+		case pbWireFixed32:
+			if len(data)-pos < 4 {
+				return errPBTruncated
+			}
+			f.data = data[pos : pos+4]
+			pos += 4
+		default:
+			return fmt.Errorf("invalid protobuf payload: unsupported wire type %d", f.wire)
+		}
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pbString(data []byte) (string, error) {
+	if !utf8.Valid(data) {
+		return "", errors.New("invalid protobuf payload: invalid utf-8 string")
+	}
+	return string(data), nil
+}
+
+//解码map字段的一项，value不存在时为nil
+func pbDecodeEntry(data []byte) (string, []byte, error) {
+	var key string
+	var value []byte
+	err := pbRangeFields(data, func(f *pbField) error {
+		if f.wire != pbWireBytes {
+			return nil
+		}
+		var err error
+		switch f.num {
+		case 1:
+			key, err = pbString(f.data)
+		case 2:
+			value = f.data
+		}
+		return err
+	})
+	return key, value, err
+}
+
+//解码mdmp.Message为与JSON格式相同结构的通用数据结构，未知字段忽略
+func pbDecodeMessage(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	var properties map[string]interface{}
+	var samples map[string]interface{}
+	err := pbRangeFields(data, func(f *pbField) error {
+		var err error
+		if f.num == pbMessageCode {
+			if f.wire == pbWireVarint {
+				result["code"] = int64(int32(f.varint))
+			}
+			return nil
+		}
+		if f.wire != pbWireBytes {
+			return nil
+		}
+		switch f.num {
+		case pbMessageId:
+			result["id"], err = pbString(f.data)
+		case pbMessageVersion:
+			result["version"], err = pbString(f.data)
+		case pbMessageType:
+			result["type"], err = pbString(f.data)
+		case pbMessageMetadata:
+			result["metadata"], err = pbDecodeMetadata(f.data)
+		case pbMessageProperties:
+			if properties == nil {
+				properties = make(map[string]interface{})
+			}
+			key, value, err := pbDecodeEntry(f.data)
+			if err != nil {
+				return err
+			}
+			properties[key], err = pbDecodeProperty(value)
+			result["params"] = properties
+			return err
+		case pbMessageSamples:
+			if samples == nil {
+				samples = make(map[string]interface{})
+			}
+			key, value, err := pbDecodeEntry(f.data)
+			if err != nil {
+				return err
+			}
+			items := make([]interface{}, 0)
+			err = pbRangeFields(value, func(sample *pbField) error {
+				if sample.num != 1 || sample.wire != pbWireBytes {
+					return nil
+				}
+				prop, err := pbDecodeProperty(sample.data)
+				items = append(items, prop)
+				return err
+			})
+			samples[key] = items
+			result["params"] = samples
+			return err
+		case pbMessageEvent:
+			result["params"], err = pbDecodeEvent(f.data)
+		case pbMessageParams:
+			result["params"], err = pbDecodeStruct(f.data, 1)
+		case pbMessageData:
+			result["data"], err = pbDecodeStruct(f.data, 1)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func pbDecodeMetadata(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	var source []interface{}
+	err := pbRangeFields(data, func(f *pbField) error {
+		var err error
+		switch {
+		case f.num == 1 && f.wire == pbWireBytes:
+			result["modelId"], err = pbString(f.data)
+		case f.num == 2 && f.wire == pbWireBytes:
+			result["entityId"], err = pbString(f.data)
+		case f.num == 3 && f.wire == pbWireBytes:
+			var s string
+			s, err = pbString(f.data)
+			source = append(source, s)
+			result["source"] = source
+		case f.num == 4 && f.wire == pbWireVarint:
+			result["epochTime"] = int64(f.varint)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//解码mdmp.Property为{"value": ..., "time": ...}
+func pbDecodeProperty(data []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{"value": nil, "time": int64(0)}
+	err := pbRangeFields(data, func(f *pbField) error {
+		var err error
+		switch {
+		case f.num == 1 && f.wire == pbWireBytes:
+			result["value"], err = pbDecodeValue(f.data, 1)
+		case f.num == 2 && f.wire == pbWireVarint:
+			result["time"] = int64(f.varint)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//解码mdmp.Event为{"value": ..., "message": ..., "level": ..., "time": ...}
+func pbDecodeEvent(data []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{"value": nil, "message": "", "level": "", "time": int64(0)}
+	err := pbRangeFields(data, func(f *pbField) error {
+		var err error
+		switch {
+		case f.num == 1 && f.wire == pbWireBytes:
+			result["value"], err = pbDecodeStruct(f.data, 1)
+		case f.num == 2 && f.wire == pbWireBytes:
+			result["message"], err = pbString(f.data)
+		case f.num == 3 && f.wire == pbWireBytes:
+			result["level"], err = pbString(f.data)
+		case f.num == 4 && f.wire == pbWireVarint:
+			result["time"] = int64(f.varint)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//解码mdmp.Struct，未知字段忽略
+func pbDecodeStruct(data []byte, depth int) (map[string]interface{}, error) {
+	if depth > maxPayloadDepth {
+		return nil, errors.New("invalid protobuf payload: nesting too deep")
+	}
+	result := make(map[string]interface{})
+	err := pbRangeFields(data, func(f *pbField) error {
+		if f.num != 1 || f.wire != pbWireBytes {
+			return nil
+		}
+		key, value, err := pbDecodeEntry(f.data)
+		if err != nil {
+			return err
+		}
+		result[key], err = pbDecodeValue(value, depth+1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//解码mdmp.Value，没有设置任何字段时为null
+func pbDecodeValue(data []byte, depth int) (interface{}, error) {
+	if depth > maxPayloadDepth {
+		return nil, errors.New("invalid protobuf payload: nesting too deep")
+	}
+	var result interface{}
+	err := pbRangeFields(data, func(f *pbField) error {
+		var err error
+		switch {
+		case f.num == pbValueNull && f.wire == pbWireVarint:
+			result = nil
+		case f.num == pbValueNumber && f.wire == pbWireFixed64:
+			result, err = checkFloat(math.Float64frombits(binary.LittleEndian.Uint64(f.data)))
+		case f.num == pbValueString && f.wire == pbWireBytes:
+			result, err = pbString(f.data)
+		case f.num == pbValueBool && f.wire == pbWireVarint:
+			result = f.varint != 0
+		case f.num == pbValueStruct && f.wire == pbWireBytes:
+			result, err = pbDecodeStruct(f.data, depth+1)
+		case f.num == pbValueList && f.wire == pbWireBytes:
+			result, err = pbDecodeList(f.data, depth+1)
+		case f.num == pbValueInt && f.wire == pbWireVarint:
+			result = pbUnzigzag(f.varint)
+		case f.num == pbValueUint && f.wire == pbWireVarint:
+			if f.varint <= math.MaxInt64 {
+				result = int64(f.varint)
+			} else {
+				result = f.varint
+			}
+		case f.num == pbValueBytes && f.wire == pbWireBytes:
+			result = append([]byte{}, f.data...)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//解码mdmp.ListValue
+func pbDecodeList(data []byte, depth int) ([]interface{}, error) {
+	if depth > maxPayloadDepth {
+		return nil, errors.New("invalid protobuf payload: nesting too deep")
+	}
+	result := make([]interface{}, 0)
+	err := pbRangeFields(data, func(f *pbField) error {
+		if f.num != 1 || f.wire != pbWireBytes {
+			return nil
+		}
+		v, err := pbDecodeValue(f.data, depth+1)
+		if err != nil {
+			return err
+		}
+		result = append(result, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
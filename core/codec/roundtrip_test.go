@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+//每种消息随机生成的次数
+const roundTripIterations = 100
+
+/*
+	随机生成SDK接口的消息，编码后再解码，结果应与原始消息相同，
+	覆盖普通模式和代理模式以及全部消息负载格式
+*/
+func TestCodec_RoundTrip(t *testing.T) {
+	cases := []struct {
+		proxyMode 	bool
+		//编码使用的topic类型
+		encodeType 	string
+		//解码得到的topic类型
+		decodeType 	string
+	}{
+		{false, TopicType_PubProperty, TopicType_SubProperty},
+		{false, TopicType_PubEvent, TopicType_SubEvent},
+		{false, TopicType_PubService, TopicType_SubService},
+		{false, TopicType_PubServiceReply, TopicType_SubServiceReply},
+		{true, TopicType_SubProperty, TopicType_SubProperty},
+		{true, TopicType_SubEvent, TopicType_SubEvent},
+		{true, TopicType_PubEvent, TopicType_PubEvent},
+		{true, TopicType_PubService, TopicType_PubService},
+		{true, TopicType_SubService, TopicType_SubService},
+		{true, TopicType_PubServiceReply, TopicType_PubServiceReply},
+	}
+	for _, format := range []string{PayloadFormat_JSON, PayloadFormat_CBOR, PayloadFormat_Protobuf} {
+		payload, err := NewPayloadCodec(format)
+		if !assert.Nil(t, err) {
+			return
+		}
+		for _, tc := range cases {
+			c := NewCodec("app-001", "iotd-001", "iott-001", tc.proxyMode)
+			c.Payload = payload
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < roundTripIterations; i++ {
+				name := fmt.Sprintf("%s/proxy=%v/%s/%d", format, tc.proxyMode, tc.encodeType, i)
+				thingId, deviceId := "iott-001", "iotd-001"
+				if !tc.proxyMode {
+					//代理模式下解码结果总是边设备自身的模型id和设备id
+					thingId, deviceId = "iott-"+randIdentifier(rnd), "iotd-"+randIdentifier(rnd)
+				}
+				src, expected := randMessage(rnd, tc.encodeType)
+				topic, data, err := c.EncodeMessage(tc.encodeType, thingId, deviceId, src)
+				if !assert.Nil(t, err, name) {
+					return
+				}
+				msg, err := c.Decode(topic, data)
+				if !assert.Nil(t, err, name) {
+					return
+				}
+				assert.Equal(t, tc.decodeType, msg.TopicType, name)
+				assert.Equal(t, thingId, msg.ThingId, name)
+				assert.Equal(t, deviceId, msg.DeviceId, name)
+				assert.Equal(t, DefaultMessageVersion, msg.Version, name)
+				if !assert.JSONEq(t, string(expected), string(msg.Payload), name) {
+					return
+				}
+			}
+		}
+	}
+}
+
+//生成随机消息，返回编码的输入和期望的解码结果
+func randMessage(rnd *rand.Rand, topicType string) ([]byte, []byte) {
+	var src, expected interface{}
+	switch topicType {
+	case TopicType_PubProperty, TopicType_SubProperty:
+		props := make([]*common.AppSdkMsgProperty, 1+rnd.Intn(5))
+		for i := range props {
+			props[i] = &common.AppSdkMsgProperty{
+				Identifier: randIdentifier(rnd),
+				//时间戳范围较小，产生同一属性的多个采样值和相同的时间戳
+				Timestamp: 1593274999806 + rnd.Int63n(3),
+				Value: randValue(rnd, 0),
+			}
+		}
+		src = props
+		sorted := append([]*common.AppSdkMsgProperty{}, props...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if sorted[i].Timestamp != sorted[j].Timestamp {
+				return sorted[i].Timestamp < sorted[j].Timestamp
+			}
+			return sorted[i].Identifier < sorted[j].Identifier
+		})
+		expected = sorted
+	case TopicType_PubEvent, TopicType_SubEvent:
+		levels := []common.EventLevel{"", common.EventLevel_Info, common.EventLevel_Warn, common.EventLevel_Critical}
+		src = &common.AppSdkMsgEvent{
+			Identifier: randIdentifier(rnd),
+			Timestamp: rnd.Int63n(1 << 42),
+			Params: randMap(rnd, 0),
+			Level: levels[rnd.Intn(len(levels))],
+			Message: randString(rnd),
+		}
+		expected = src
+	case TopicType_PubService, TopicType_SubService:
+		src = &common.AppSdkMsgServiceCall{
+			MessageId: randIdentifier(rnd),
+			Identifier: randIdentifier(rnd),
+			Params: randMap(rnd, 0),
+		}
+		expected = src
+	case TopicType_PubServiceReply:
+		src = &common.AppSdkMsgServiceReply{
+			MessageId: randIdentifier(rnd),
+			Identifier: randIdentifier(rnd),
+			Code: int32(rnd.Intn(600)),
+			Params: randMap(rnd, 0),
+		}
+		expected = src
+	}
+	srcData, _ := json.Marshal(src)
+	expectedData, _ := json.Marshal(expected)
+	return srcData, expectedData
+}
+
+//标识id只包含topic中合法的字符
+func randIdentifier(rnd *rand.Rand) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789_-"
+	buf := make([]byte, 1+rnd.Intn(8))
+	for i := range buf {
+		buf[i] = letters[rnd.Intn(len(letters))]
+	}
+	return string(buf)
+}
+
+func randString(rnd *rand.Rand) string {
+	runes := []rune("ab \"\\/\n\t中文€\u0000\U0001F600")
+	buf := make([]rune, rnd.Intn(6))
+	for i := range buf {
+		buf[i] = runes[rnd.Intn(len(runes))]
+	}
+	return string(buf)
+}
+
+//随机的JSON值，数字在float64可以精确表示的范围内
+func randValue(rnd *rand.Rand, depth int) interface{} {
+	kind := rnd.Intn(7)
+	if depth >= 3 && kind >= 5 {
+		kind = rnd.Intn(5)
+	}
+	switch kind {
+	case 0:
+		return nil
+	case 1:
+		return rnd.Intn(2) == 0
+	case 2:
+		return rnd.Int63n(1<<53) - 1<<52
+	case 3:
+		return rnd.NormFloat64() * 1e6
+	case 4:
+		return randString(rnd)
+	case 5:
+		items := make([]interface{}, rnd.Intn(4))
+		for i := range items {
+			items[i] = randValue(rnd, depth+1)
+		}
+		return items
+	default:
+		return randMap(rnd, depth+1)
+	}
+}
+
+func randMap(rnd *rand.Rand, depth int) map[string]interface{} {
+	result := make(map[string]interface{})
+	for i := rnd.Intn(4); i > 0; i-- {
+		result[randString(rnd)] = randValue(rnd, depth+1)
+	}
+	return result
+}
@@ -0,0 +1,386 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+	topic方案接口，定义topic类型与实际topic之间的转换规则，用于对接不同命名空间的消息服务
+*/
+type TopicScheme interface {
+	//根据topic类型生成topic，identifier、thingId和deviceId可以为通配符"+"
+	EncodeTopic(topicType string, identifier string, thingId string, deviceId string) (string, error)
+	//解析topic，返回topic类型、模型id、设备id和标识id
+	DecodeTopic(topic string) (string, string, string, string, error)
+}
+
+func newDefaultTopicScheme(appId string, deviceId string, thingId string, proxyMode bool) TopicScheme {
+	if proxyMode {
+		return NewProxyTopicScheme(appId, thingId, deviceId)
+	}
+	return NewDirectTopicScheme()
+}
+
+/*
+	消息代理模式的topic方案(V1)，应用消息通过AppControl服务代理，topic中不包含模型id和设备id
+*/
+type ProxyTopicScheme struct {
+	AppId 		string
+	ThingId 	string
+	DeviceId 	string
+}
+
+func NewProxyTopicScheme(appId string, thingId string, deviceId string) *ProxyTopicScheme {
+	return &ProxyTopicScheme{
+		AppId: appId,
+		ThingId: thingId,
+		DeviceId: deviceId,
+	}
+}
+
+func (s *ProxyTopicScheme) EncodeTopic(topicType string, identifier string, thingId string, deviceId string) (string, error) {
+	if topicType == ""  {
+		return "", errors.New("invalid arguments")
+	}
+	topic := ""
+	switch topicType {
+	case TopicType_SubProperty:
+		topic = fmt.Sprintf(topicTemplateV1_SubProperty, s.AppId)
+	case TopicType_PubProperty:
+		topic = fmt.Sprintf(topicTemplateV1_PubProperty, s.AppId)
+	case TopicType_SubEvent:
+		topic = fmt.Sprintf(topicTemplateV1_SubEvent, s.AppId, identifier)
+	case TopicType_PubEvent:
+		topic = fmt.Sprintf(topicTemplateV1_PubEvent, s.AppId, identifier)
+	case TopicType_PubService:
+		topic = fmt.Sprintf(topicTemplateV1_PubService, s.AppId, identifier)
+	case TopicType_SubService:
+		topic = fmt.Sprintf(topicTemplateV1_SubService, thingId, deviceId, identifier)
+	case TopicType_PubServiceReply:
+		topic = fmt.Sprintf(topicTemplateV1_PubServiceReply, thingId, deviceId, identifier)
+	case TopicType_SubServiceReply:
+		topic = fmt.Sprintf(topicTemplateV1_SubServiceReply, thingId, deviceId, identifier)
+	case TopicType_SubPropertySet:
+		topic = fmt.Sprintf(topicTemplateV1_SubPropertySet, s.AppId)
+	case TopicType_PubPropertySetReply:
+		topic = fmt.Sprintf(topicTemplateV1_PubPropertySetReply, s.AppId)
+	default:
+		return "", errors.New("unsupported topicType: " + topicType)
+	}
+	return topic, nil
+}
+
+func (s *ProxyTopicScheme) DecodeTopic(topic string) (string, string, string, string, error) {
+	if topic == "" {
+		return "", "", "", "", errors.New("invalid arguments")
+	}
+	dstUnits := strings.Split(topic, "/")
+	if len(dstUnits) != 7 && len(dstUnits) != 8 {
+		return "", "", "", "", errors.New("invalid topic format")
+	}
+	//应用topic为7级，边设备服务调用topic为8级
+	if dstUnits[0] != "" || !(dstUnits[1] == "edge" && len(dstUnits) == 7 || dstUnits[1] == "sys" && len(dstUnits) == 8) {
+		return "", "", "", "", errors.New("invalid topic format: " + topic)
+	}
+	//parse topic
+	topicType := ""
+	identifier := ""
+	if dstUnits[1] == "edge" {
+		if dstUnits[4] == "property" {
+			if dstUnits[6] == "post" {
+				topicType = TopicType_SubProperty
+			} else if dstUnits[6] == "control" {
+				//属性设置和代理模式下的属性上报共用control topic，通过消息类型区分
+				topicType = TopicType_SubPropertySet
+			} else if dstUnits[6] == "control_reply" {
+				topicType = TopicType_PubPropertySetReply
+			}
+		} else if dstUnits[4] == "event" {
+			if dstUnits[6] == "post" {
+				topicType = TopicType_SubEvent
+			} else if dstUnits[6] == "control" {
+				topicType = TopicType_PubEvent
+			}
+			identifier = dstUnits[5]
+		} else if dstUnits[4] == "service" {
+			if dstUnits[6] == "call" {
+				topicType = TopicType_PubService
+			}
+			identifier = dstUnits[5]
+		}
+	} else {
+		if dstUnits[5] == "service" {
+			if dstUnits[7] == "call" {
+				topicType = TopicType_SubService
+			} else if dstUnits[7] == "call_reply" {
+				topicType = TopicType_PubServiceReply
+			}
+			identifier = dstUnits[6]
+		}
+	}
+	if topicType == "" {
+		return "", "", "", "", errors.New("invalid topic format: " + topic)
+	}
+	return topicType, s.ThingId, s.DeviceId, identifier, nil
+}
+
+/*
+	普通模式的topic方案(V2)，直接使用平台消息格式通信
+*/
+type DirectTopicScheme struct{}
+
+func NewDirectTopicScheme() *DirectTopicScheme {
+	return &DirectTopicScheme{}
+}
+
+func (s *DirectTopicScheme) EncodeTopic(topicType string, identifier string, thingId string, deviceId string) (string, error) {
+	if topicType == ""  {
+		return "", errors.New("invalid arguments")
+	}
+	topic := ""
+	switch topicType {
+	case TopicType_SubProperty:
+		topic = fmt.Sprintf(topicTemplateV2_SubProperty, thingId, deviceId)
+	case TopicType_PubProperty:
+		topic = fmt.Sprintf(topicTemplateV2_PubProperty, thingId, deviceId)
+	case TopicType_SubEvent:
+		topic = fmt.Sprintf(topicTemplateV2_SubEvent, thingId, deviceId, identifier)
+	case TopicType_PubEvent:
+		topic = fmt.Sprintf(topicTemplateV2_PubEvent, thingId, deviceId, identifier)
+	case TopicType_PubService:
+		topic = fmt.Sprintf(topicTemplateV2_PubService, thingId, deviceId, identifier)
+	case TopicType_SubService:
+		topic = fmt.Sprintf(topicTemplateV2_SubService, thingId, deviceId, identifier)
+	case TopicType_PubServiceReply:
+		topic = fmt.Sprintf(topicTemplateV2_PubServiceReply, thingId, deviceId, identifier)
+	case TopicType_SubServiceReply:
+		topic = fmt.Sprintf(topicTemplateV2_SubServiceReply, thingId, deviceId, identifier)
+	case TopicType_SubPropertySet:
+		topic = fmt.Sprintf(topicTemplateV2_SubPropertySet, thingId, deviceId)
+	case TopicType_PubPropertySetReply:
+		topic = fmt.Sprintf(topicTemplateV2_PubPropertySetReply, thingId, deviceId)
+	default:
+		return "", errors.New("unsupported topicType: " + topicType)
+	}
+	return topic, nil
+}
+
+func (s *DirectTopicScheme) DecodeTopic(topic string) (string, string, string, string, error) {
+	if topic == "" {
+		return "", "", "", "", errors.New("invalid arguments")
+	}
+	dstUnits := strings.Split(topic, "/")
+	if len(dstUnits) != 8 {
+		return "", "", "", "", errors.New("invalid topic format")
+	}
+	if dstUnits[0] != "" || dstUnits[1] != "sys" {
+		return "", "", "", "", errors.New("invalid topic format: " + topic)
+	}
+	//parse topic
+	topicType := ""
+	thingId := dstUnits[2]
+	deviceId := dstUnits[3]
+	identifier := ""
+	if dstUnits[5] == "property" {
+		if dstUnits[7] == "post" {
+			topicType = TopicType_SubProperty
+		} else if dstUnits[7] == "set" {
+			topicType = TopicType_SubPropertySet
+		} else if dstUnits[7] == "set_reply" {
+			topicType = TopicType_PubPropertySetReply
+		}
+	} else if dstUnits[5] == "event" {
+		if dstUnits[7] == "post" {
+			topicType = TopicType_SubEvent
+		}
+		identifier = dstUnits[6]
+	} else if dstUnits[5] == "service" {
+		if dstUnits[7] == "call" {
+			topicType = TopicType_SubService
+		} else if dstUnits[7] == "call_reply" {
+			topicType = TopicType_SubServiceReply
+		}
+		identifier = dstUnits[6]
+	}
+	if topicType == "" {
+		return "", "", "", "", errors.New("invalid topic format: " + topic)
+	}
+	return topicType, thingId, deviceId, identifier, nil
+}
+
+/*
+	模版topic方案中支持的占位符，占位符必须占据topic中完整的一级
+*/
+const (
+	TopicPlaceholder_AppId 		= "{appId}"
+	TopicPlaceholder_ThingId 	= "{thingId}"
+	TopicPlaceholder_DeviceId 	= "{deviceId}"
+	TopicPlaceholder_Identifier = "{identifier}"
+)
+
+//多个topic类型使用相同模版时，解码优先匹配订阅类型，与普通模式的解码结果保持一致
+var templateDecodeOrder = []string{
+	TopicType_SubProperty,
+	TopicType_SubPropertySet,
+	TopicType_SubEvent,
+	TopicType_SubService,
+	TopicType_SubServiceReply,
+	TopicType_PubPropertySetReply,
+	TopicType_PubProperty,
+	TopicType_PubEvent,
+	TopicType_PubService,
+	TopicType_PubServiceReply,
+}
+
+/*
+	模版topic方案，通过配置的topic模版对接其他命名空间的消息服务，
+	模版中没有{thingId}或{deviceId}时，解码结果使用边设备自身的模型id和设备id
+*/
+type TemplateTopicScheme struct {
+	AppId 		string
+	ThingId 	string
+	DeviceId 	string
+	//topic类型与模版的对应关系
+	templates 	map[string][]string
+}
+
+/*
+	根据模版创建topic方案，templates的key为topic类型，可以省略"TopicType_"前缀，
+	例如"SubProperty": "/things/{thingId}/{deviceId}/props"
+*/
+func NewTemplateTopicScheme(appId string, thingId string, deviceId string, templates map[string]string) (*TemplateTopicScheme, error) {
+	s := &TemplateTopicScheme{
+		AppId: appId,
+		ThingId: thingId,
+		DeviceId: deviceId,
+		templates: make(map[string][]string),
+	}
+	known := make(map[string]bool)
+	for _, topicType := range templateDecodeOrder {
+		known[topicType] = true
+	}
+	for key, template := range templates {
+		topicType := key
+		if !strings.HasPrefix(topicType, "TopicType_") {
+			topicType = "TopicType_" + topicType
+		}
+		if !known[topicType] {
+			return nil, errors.New("unsupported topic type in template: " + key)
+		}
+		units, err := parseTopicTemplate(template)
+		if err != nil {
+			return nil, err
+		}
+		s.templates[topicType] = units
+	}
+	return s, nil
+}
+
+//检查模版格式，占位符必须占据完整的一级，并且不能包含mqtt通配符
+func parseTopicTemplate(template string) ([]string, error) {
+	if template == "" {
+		return nil, errors.New("topic template should not be empty")
+	}
+	units := strings.Split(template, "/")
+	seen := make(map[string]bool)
+	for _, unit := range units {
+		if strings.ContainsAny(unit, "+#") {
+			return nil, errors.New("topic template should not contain wildcards: " + template)
+		}
+		if isTopicPlaceholder(unit) {
+			if seen[unit] {
+				return nil, errors.New("duplicate placeholder in topic template: " + template)
+			}
+			seen[unit] = true
+		} else if strings.ContainsAny(unit, "{}") {
+			return nil, errors.New("invalid placeholder in topic template: " + template)
+		}
+	}
+	return units, nil
+}
+
+func isTopicPlaceholder(unit string) bool {
+	switch unit {
+	case TopicPlaceholder_AppId, TopicPlaceholder_ThingId, TopicPlaceholder_DeviceId, TopicPlaceholder_Identifier:
+		return true
+	}
+	return false
+}
+
+func (s *TemplateTopicScheme) EncodeTopic(topicType string, identifier string, thingId string, deviceId string) (string, error) {
+	if topicType == ""  {
+		return "", errors.New("invalid arguments")
+	}
+	units, ok := s.templates[topicType]
+	if !ok {
+		return "", errors.New("unsupported topicType: " + topicType)
+	}
+	result := make([]string, len(units))
+	for i, unit := range units {
+		switch unit {
+		case TopicPlaceholder_AppId:
+			result[i] = s.AppId
+		case TopicPlaceholder_ThingId:
+			result[i] = thingId
+		case TopicPlaceholder_DeviceId:
+			result[i] = deviceId
+		case TopicPlaceholder_Identifier:
+			result[i] = identifier
+		default:
+			result[i] = unit
+		}
+		if isTopicPlaceholder(unit) && result[i] == "" {
+			return "", fmt.Errorf("empty value for %s in topic template of %s", unit, topicType)
+		}
+	}
+	return strings.Join(result, "/"), nil
+}
+
+func (s *TemplateTopicScheme) DecodeTopic(topic string) (string, string, string, string, error) {
+	if topic == "" {
+		return "", "", "", "", errors.New("invalid arguments")
+	}
+	dstUnits := strings.Split(topic, "/")
+	for _, topicType := range templateDecodeOrder {
+		units, ok := s.templates[topicType]
+		if !ok || len(units) != len(dstUnits) {
+			continue
+		}
+		thingId, deviceId, identifier, ok := s.match(units, dstUnits)
+		if ok {
+			return topicType, thingId, deviceId, identifier, nil
+		}
+	}
+	return "", "", "", "", errors.New("invalid topic format: " + topic)
+}
+
+func (s *TemplateTopicScheme) match(units []string, dstUnits []string) (string, string, string, bool) {
+	thingId := s.ThingId
+	deviceId := s.DeviceId
+	identifier := ""
+	for i, unit := range units {
+		switch unit {
+		case TopicPlaceholder_AppId:
+			if dstUnits[i] != s.AppId {
+				return "", "", "", false
+			}
+		case TopicPlaceholder_ThingId:
+			thingId = dstUnits[i]
+		case TopicPlaceholder_DeviceId:
+			deviceId = dstUnits[i]
+		case TopicPlaceholder_Identifier:
+			identifier = dstUnits[i]
+		default:
+			if dstUnits[i] != unit {
+				return "", "", "", false
+			}
+			continue
+		}
+		if dstUnits[i] == "" {
+			return "", "", "", false
+		}
+	}
+	return thingId, deviceId, identifier, true
+}
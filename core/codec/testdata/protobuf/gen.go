@@ -0,0 +1,56 @@
+//go:build ignore
+// +build ignore
+
+/*
+	根据mdmp.proto生成protobuf格式的测试向量：按照protobuf文本格式解析*.txtpb，
+	使用google.golang.org/protobuf的参考实现编码为*.bin(map按照key排序)，
+	结果与protoc --encode=mdmp.Message mdmp.proto相同。
+	依赖不在本项目的go.mod中，需要在单独的module中运行：
+		go mod init gen && go get github.com/bufbuild/protocompile@v0.14.1 google.golang.org/protobuf
+		go run gen.go ../.. .
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func main() {
+	protoDir, dataDir := os.Args[1], os.Args[2]
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{ImportPaths: []string{protoDir}}}
+	files, err := compiler.Compile(context.Background(), "mdmp.proto")
+	if err != nil {
+		panic(err)
+	}
+	desc := files[0].Messages().ByName("Message")
+	inputs, _ := filepath.Glob(filepath.Join(dataDir, "*.txtpb"))
+	for _, input := range inputs {
+		text, err := ioutil.ReadFile(input)
+		if err != nil {
+			panic(err)
+		}
+		msg := dynamicpb.NewMessage(desc)
+		err = prototext.Unmarshal(text, msg)
+		if err != nil {
+			panic(fmt.Sprint(input, ": ", err))
+		}
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			panic(err)
+		}
+		err = ioutil.WriteFile(strings.TrimSuffix(input, ".txtpb")+".bin", data, 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -20,6 +20,10 @@ const (
 	TopicType_PubServiceReply 	= "TopicType_PubServiceReply"
 	//订阅服务调用回应类型
 	TopicType_SubServiceReply 	= "TopicType_SubServiceReply"
+	//订阅属性设置类型
+	TopicType_SubPropertySet 	= "TopicType_SubPropertySet"
+	//发布属性设置回应类型
+	TopicType_PubPropertySetReply = "TopicType_PubPropertySetReply"
 )
 
 /*
@@ -82,6 +86,18 @@ const (
 	{Identifier}：服务标识id
 */
 	topicTemplateV1_SubServiceReply = "/sys/%s/%s/thing/service/%s/call_reply"
+
+	/*
+		订阅属性设置Topic模版 /edge/{appId}/thing/property/base/control
+		{appId}：应用id
+	*/
+	topicTemplateV1_SubPropertySet 	= "/edge/%s/thing/property/base/control"
+
+	/*
+		发布属性设置回应Topic模版 /edge/{appId}/thing/property/base/control_reply
+		{appId}：应用id
+	*/
+	topicTemplateV1_PubPropertySetReply = "/edge/%s/thing/property/base/control_reply"
 )
 
 /*
@@ -149,4 +165,18 @@ const (
 		{Identifier}：服务标识id
 	*/
 	topicTemplateV2_SubServiceReply = "/sys/%s/%s/thing/service/%s/call_reply"
+
+	/*
+		订阅属性设置Topic模版 /sys/{thingId}/{deviceId}/thing/property/base/set
+		{thingId}：模型id
+		{deviceId}：设备id
+	*/
+	topicTemplateV2_SubPropertySet 	= "/sys/%s/%s/thing/property/base/set"
+
+	/*
+		发布属性设置回应Topic模版 /sys/{thingId}/{deviceId}/thing/property/base/set_reply
+		{thingId}：模型id
+		{deviceId}：设备id
+	*/
+	topicTemplateV2_PubPropertySetReply = "/sys/%s/%s/thing/property/base/set_reply"
 )
\ No newline at end of file
@@ -0,0 +1,177 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//不支持的消息格式版本
+var ErrUnsupportedVersion = errors.New("unsupported message version")
+
+/*
+	消息版本转换函数，将指定版本的消息转换为当前版本(DefaultMessageVersion)的格式，
+	msg为解码后的通用数据结构，数字类型为json.Number
+*/
+type VersionTransform func(msg map[string]interface{}) (map[string]interface{}, error)
+
+var (
+	versionLock 	sync.RWMutex
+	//消息版本与转换函数的对应关系，转换函数为nil表示与当前版本格式相同
+	versionRegistry = map[string]VersionTransform{
+		DefaultMessageVersion: nil,
+	}
+)
+
+//注册消息版本的转换函数，transform为nil表示该版本与当前版本格式相同，不需要转换
+func RegisterVersion(version string, transform VersionTransform) {
+	versionLock.Lock()
+	defer versionLock.Unlock()
+	versionRegistry[version] = transform
+}
+
+//删除已注册的消息版本，当前版本(DefaultMessageVersion)不能删除，用于替换转换函数或者测试后恢复
+func UnregisterVersion(version string) {
+	if version == DefaultMessageVersion {
+		return
+	}
+	versionLock.Lock()
+	defer versionLock.Unlock()
+	delete(versionRegistry, version)
+}
+
+//返回已注册的消息版本
+func SupportedVersions() []string {
+	versionLock.RLock()
+	defer versionLock.RUnlock()
+	result := make([]string, 0, len(versionRegistry))
+	for version := range versionRegistry {
+		result = append(result, version)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return compareVersion(result[i], result[j]) < 0
+	})
+	return result
+}
+
+/*
+	查找消息版本的转换函数，没有注册的版本使用主版本号相同的已注册版本，
+	同一主版本内的次版本只增加字段，可以按照已注册版本解码
+*/
+func lookupVersion(version string) (VersionTransform, bool) {
+	versionLock.RLock()
+	defer versionLock.RUnlock()
+	if transform, ok := versionRegistry[version]; ok {
+		return transform, true
+	}
+	major := majorVersion(version)
+	latest := ""
+	for registered := range versionRegistry {
+		if majorVersion(registered) == major && (latest == "" || compareVersion(registered, latest) > 0) {
+			latest = registered
+		}
+	}
+	if latest == "" {
+		return nil, false
+	}
+	return versionRegistry[latest], true
+}
+
+func majorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
+
+//按照数字比较版本号的各级，如1.10大于1.9，不是数字的部分按照字符串比较
+func compareVersion(a string, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case partsA[i] != partsB[i]:
+			return strings.Compare(partsA[i], partsB[i])
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+/*
+	检查消息版本并转换为当前版本的格式，返回转换后的消息和原始版本号，
+	消息中没有版本号时按照DefaultMessageVersion处理
+*/
+func (c *Codec) negotiateVersion(payload []byte) ([]byte, string, error) {
+	header := &struct {
+		Version 	string 		`json:"version"`
+	}{}
+	err := c.unmarshalPayload(payload, header)
+	if err != nil {
+		return nil, "", err
+	}
+	version := header.Version
+	if version == "" {
+		version = DefaultMessageVersion
+	}
+	transform, ok := lookupVersion(version)
+	if !ok {
+		return nil, version, fmt.Errorf("%w: %q, supported versions: %s",
+			ErrUnsupportedVersion, version, strings.Join(SupportedVersions(), ", "))
+	}
+	if transform == nil {
+		return payload, version, nil
+	}
+	msg, err := c.unmarshalGeneric(payload)
+	if err != nil {
+		return nil, version, err
+	}
+	msg, err = transform(msg)
+	if err != nil {
+		return nil, version, fmt.Errorf("transform message version %s failed: %w", version, err)
+	}
+	if msg == nil {
+		return nil, version, errors.New("transform message version " + version + " failed: empty message")
+	}
+	msg["version"] = DefaultMessageVersion
+	result, err := json.Marshal(msg)
+	if err != nil {
+		return nil, version, err
+	}
+	return result, version, nil
+}
+
+//解码为通用数据结构，数字保留为json.Number
+func (c *Codec) unmarshalGeneric(payload []byte) (map[string]interface{}, error) {
+	if decoder, ok := c.inboundCodec(payload).(genericDecoder); ok {
+		value, err := decoder.decodeGeneric(payload)
+		if err != nil {
+			return nil, err
+		}
+		msg, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid message: message should be an object")
+		}
+		return toJSONNumbers(msg).(map[string]interface{}), nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	msg := make(map[string]interface{})
+	err := decoder.Decode(&msg)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, errors.New("invalid message: message is null")
+	}
+	return msg, nil
+}
@@ -29,8 +29,17 @@ const (
 	ENV_EDGE_THING_ID  		= "EDGE_THING_ID"
 	//消息代理模式，为TRUE表示代理模式，为FALSE表示普通模式，为空默认为代理模式
 	ENV_EDGE_PROXY_MODE 	= "EDGE_PROXY_MODE"
+	//消息负载格式，支持json、cbor、protobuf，为空默认为json
+	ENV_EDGE_PAYLOAD_FORMAT = "EDGE_PAYLOAD_FORMAT"
+	//自定义topic模版，JSON对象格式，key为topic类型，value为包含{appId}、{thingId}、{deviceId}、{identifier}占位符的模版
+	ENV_EDGE_TOPIC_TEMPLATES = "EDGE_TOPIC_TEMPLATES"
+	//metadata服务端口，为空默认为9611
+	ENV_EDGE_META_PORT 		= "EDGE_META_PORT"
 )
 
+//metadata服务默认端口
+const DefaultMetaPort = 9611
+
 //二进制应用初始化配置文件结构
 type EdgeConfig struct {
 	//EdgeHub协议类型
@@ -47,6 +56,12 @@ type EdgeConfig struct {
 	ThingId  	string 		`json:"thingId"`
 	//是否为消息代理模式
 	ProxyMode	bool		`json:"proxyMode"`
+	//消息负载格式，支持json、cbor、protobuf，为空默认为json
+	PayloadFormat string 	`json:"payloadFormat"`
+	//自定义topic模版，为空时根据ProxyMode使用代理模式或者普通模式的topic
+	TopicTemplates map[string]string `json:"topicTemplates"`
+	//metadata服务端口，为0时使用DefaultMetaPort，metadata服务地址与EdgeHub地址相同
+	MetaPort 	int 		`json:"metaPort"`
 }
 
 func (c *EdgeConfig) Load(appType common.AppSdkRuntimeType) error {
@@ -89,9 +104,27 @@ func (c *EdgeConfig) Load(appType common.AppSdkRuntimeType) error {
 		} else {
 			c.ProxyMode = true
 		}
+		c.PayloadFormat = os.Getenv(ENV_EDGE_PAYLOAD_FORMAT)
+		metaPortStr := os.Getenv(ENV_EDGE_META_PORT)
+		if metaPortStr != "" {
+			port, err := strconv.Atoi(metaPortStr)
+			if err == nil {
+				c.MetaPort = port
+			}
+		}
+		templates := os.Getenv(ENV_EDGE_TOPIC_TEMPLATES)
+		if templates != "" {
+			err := json.Unmarshal([]byte(templates), &c.TopicTemplates)
+			if err != nil {
+				return errors.New("Load config failed, invalid topic templates: " + err.Error())
+			}
+		}
 	} else {
 		return errors.New("Application type is not supported, appType: " + strconv.Itoa(int(appType)))
 	}
+	if c.MetaPort == 0 {
+		c.MetaPort = DefaultMetaPort
+	}
 	if c.HubAddr == "" || c.AppId == "" || c.DeviceId == "" {
 		return errors.New("Load config failed, config param should not be empty")
 	}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,7 +10,13 @@ import (
 	"github.com/qingcloud-iot/edge-app-go/core/config"
 	"github.com/qingcloud-iot/edge-app-go/core/meta"
 	"github.com/qingcloud-iot/edge-app-go/core/mqtt"
+	"github.com/qingcloud-iot/edge-app-go/core/router"
+	"github.com/qingcloud-iot/edge-app-go/core/shadow"
+	"github.com/qingcloud-iot/edge-app-go/core/thingmodel"
+	"github.com/qingcloud-iot/edge-app-go/record"
 	"github.com/satori/go.uuid"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,8 +28,10 @@ func NewAppCoreClient(appType common.AppSdkRuntimeType, msgCB common.AppSdkMessa
 		messageParam: 	msgParam,
 		eventCB: 		evtCB,
 		eventParam:  	evtParam,
-		serviceIds: 	srvIds,
-		epThingIds: 	thingIds,
+		subs: 			newSubscriptionState(srvIds, thingIds),
+		shadow: 		shadow.NewShadow("", nil),
+		stats: 			&messageStats{},
+		router: 		router.NewRouter(),
 	}
 }
 
@@ -37,10 +46,8 @@ type AppCoreClient struct {
 	eventCB			common.AppSdkEventCB
 	//事件回调处理函数的用户自定义参数
 	eventParam    	interface{}
-	//服务调用的id数组
-	serviceIds 		[]string
-	//子设备模型id数组
-	epThingIds 		[]string
+	//订阅状态，包括服务调用id和子设备模型id
+	subs 			*subscriptionState
 	//mqtt协议处理器
 	mqttHandler 	*mqtt.MqttClient
 	//编解码处理器
@@ -49,6 +56,50 @@ type AppCoreClient struct {
 	cfg 			*config.EdgeConfig
 	//metadata访问客户端
 	metaHandler 	*meta.MetaClient
+	//保护运行时注册的回调处理函数和运行context
+	lock 			sync.RWMutex
+	//属性设置处理函数
+	propertySetCB 	common.AppSdkPropertySetHandlerContext
+	//Start时创建、Stop和Cleanup时取消的context，收到的每条消息从该context派生
+	runCtx 			context.Context
+	//取消runCtx
+	runCancel 		context.CancelFunc
+	//本地设备影子
+	shadow 			*shadow.Shadow
+	//物模型文件路径
+	modelFile 		string
+	//物模型校验模式
+	validateMode 	common.ValidateMode
+	//边设备物模型，未启用校验时为nil
+	model 			*thingmodel.Model
+	//消息接收统计
+	stats 			*messageStats
+	//消息录制文件路径
+	recordFile 		string
+	//消息录制，未设置录制文件时为nil
+	recorder 		*record.Recorder
+	//消息拦截器，按照顺序执行
+	interceptors 	[]common.AppSdkInterceptor
+	//按照模型id、设备id和标识id注册的消息处理函数
+	router 			*router.Router
+}
+
+//设置设备影子持久化文件和差异回调，需要在Init之前调用，path为空时只保存在内存中
+func (c *AppCoreClient) SetShadow(path string, cb common.AppSdkShadowDeltaCB) {
+	c.shadow = shadow.NewShadow(path, c.wrapShadowDeltaCB(cb))
+}
+
+//设置设备影子上报值持久化的间隔，需要在SetShadow之后调用，为0时使用默认间隔，小于0时每次上报都写入文件
+func (c *AppCoreClient) SetShadowSaveInterval(interval time.Duration) {
+	c.shadow.SetSaveInterval(interval)
+}
+
+//写入设备影子未持久化的上报值
+func (c *AppCoreClient) flushShadow() {
+	err := c.shadow.Flush()
+	if err != nil {
+		fmt.Println("APP SDK save shadow failed, err: " + err.Error())
+	}
 }
 
 func (c *AppCoreClient) Init() error {
@@ -57,11 +108,30 @@ func (c *AppCoreClient) Init() error {
 	if err != nil {
 		return errors.New("APP SDK init failed, err: " + err.Error())
 	}
+	err = c.shadow.Load()
+	if err != nil {
+		c.cfg = nil
+		return errors.New("APP SDK init failed, load shadow err: " + err.Error())
+	}
+	payloadCodec, err := codec.NewPayloadCodec(c.cfg.PayloadFormat)
+	if err != nil {
+		c.cfg = nil
+		return errors.New("APP SDK init failed, err: " + err.Error())
+	}
 	c.codecHandler = codec.NewCodec(c.cfg.AppId, c.cfg.DeviceId, c.cfg.ThingId, c.cfg.ProxyMode)
+	c.codecHandler.Payload = payloadCodec
+	if len(c.cfg.TopicTemplates) > 0 {
+		c.codecHandler.Scheme, err = codec.NewTemplateTopicScheme(c.cfg.AppId, c.cfg.ThingId, c.cfg.DeviceId, c.cfg.TopicTemplates)
+		if err != nil {
+			c.cfg = nil
+			c.codecHandler = nil
+			return errors.New("APP SDK init failed, err: " + err.Error())
+		}
+	}
 	clientId := fmt.Sprintf("%s/%s", c.cfg.DeviceId, c.cfg.AppId)
 	url := fmt.Sprintf("%s://%s:%d", c.cfg.Protocol, c.cfg.HubAddr, c.cfg.HubPort)
 	c.mqttHandler, err = mqtt.NewMqttClient(clientId, url, c.onConnectStatus)
-	c.metaHandler = meta.NewMetaClient(c.cfg.HubAddr, 9611)
+	c.metaHandler = meta.NewMetaClient(c.cfg.HubAddr, c.cfg.MetaPort)
 	if err != nil {
 		fmt.Println()
 		//回滚已经初始化过的内容
@@ -69,10 +139,27 @@ func (c *AppCoreClient) Init() error {
 		c.codecHandler = nil
 		return errors.New("APP SDK init failed, err: " + err.Error())
 	}
+	err = c.loadThingModel()
+	if err != nil {
+		c.cfg = nil
+		c.codecHandler = nil
+		c.mqttHandler = nil
+		return errors.New("APP SDK init failed, err: " + err.Error())
+	}
+	err = c.openRecorder()
+	if err != nil {
+		c.cfg = nil
+		c.codecHandler = nil
+		c.mqttHandler = nil
+		return errors.New("APP SDK init failed, open record file err: " + err.Error())
+	}
 	return nil
 }
 
 func (c *AppCoreClient) Cleanup() {
+	c.cancelRunContext()
+	c.flushShadow()
+	c.subs.setConnected(false)
 	if c.mqttHandler != nil {
 		c.mqttHandler.Stop()
 		c.mqttHandler = nil
@@ -83,29 +170,124 @@ func (c *AppCoreClient) Cleanup() {
 	if c.cfg != nil {
 		c.cfg = nil
 	}
+	c.closeRecorder()
 }
 
 func (c *AppCoreClient) Start() error {
 	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
 		return errors.New("APP SDK start failed, err: not init")
 	}
+	c.resetRunContext()
 	return c.mqttHandler.Start()
 }
 
+//启动SDK并等待第一次连接成功，返回时已经完成消息订阅，ctx取消或者超时时停止连接
+func (c *AppCoreClient) StartContext(ctx context.Context) error {
+	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
+		return errors.New("APP SDK start failed, err: not init")
+	}
+	if err := ctx.Err(); err != nil {
+		return contextError("Start", ctx, err)
+	}
+	c.resetRunContext()
+	err := c.mqttHandler.StartContext(ctx)
+	if err != nil {
+		return contextError("Start", ctx, err)
+	}
+	return nil
+}
+
 func (c *AppCoreClient) Stop() {
 	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
 		return
 	}
+	c.cancelRunContext()
+	c.subs.setConnected(false)
 	c.mqttHandler.Stop()
+	c.flushShadow()
+}
+
+//重新创建运行context，之前的context取消
+func (c *AppCoreClient) resetRunContext() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.runCancel != nil {
+		c.runCancel()
+	}
+	c.runCtx, c.runCancel = context.WithCancel(context.Background())
+}
+
+//取消运行context，正在处理的消息的context随之取消
+func (c *AppCoreClient) cancelRunContext() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.runCancel != nil {
+		c.runCancel()
+	}
+}
+
+//为收到的消息创建context，在消息处理完成或者SDK停止时取消
+func (c *AppCoreClient) messageContext() (context.Context, context.CancelFunc) {
+	c.lock.RLock()
+	parent := c.runCtx
+	c.lock.RUnlock()
+	if parent == nil {
+		parent = context.Background()
+	}
+	return context.WithCancel(parent)
 }
 
 func (c *AppCoreClient) SendMessage(msgType common.AppSdkMessageType, payload []byte) error {
+	return c.SendMessageWithMeta(msgType, payload, nil)
+}
+
+//发送消息并设置元信息，meta为nil时与SendMessage相同
+func (c *AppCoreClient) SendMessageWithMeta(msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error {
+	return c.sendMessage(context.Background(), msgType, payload, meta, true)
+}
+
+//发送消息并设置元信息，ctx传递给消息拦截器，ctx取消或者超时时停止等待发送结果
+func (c *AppCoreClient) SendMessageWithMetaContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error {
+	return c.sendMessage(ctx, msgType, payload, meta, true)
+}
+
+//发送消息，ctx传递给消息拦截器，ctx取消或者超时时停止等待发送结果
+func (c *AppCoreClient) SendMessageContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte) error {
+	return c.sendMessage(ctx, msgType, payload, nil, true)
+}
+
+//发送消息，拦截器丢弃消息时返回包含ErrMessageDropped的错误；validate为false时不经过物模型校验，用于SDK自动生成的回应
+func (c *AppCoreClient) sendMessage(ctx context.Context, msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta, validate bool) error {
 	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
 		return errors.New("APP SDK send message failed, err: not init")
 	}
 	if payload == nil {
 		return errors.New("APP SDK send message failed, err: invalid arguments")
 	}
+	if err := ctx.Err(); err != nil {
+		return contextError("SendMessage", ctx, err)
+	}
+	if len(c.interceptors) > 0 {
+		msg := &common.AppSdkMessageData{
+			Type: msgType,
+			ThingId: c.cfg.ThingId,
+			DeviceId: c.cfg.DeviceId,
+			Payload: payload,
+		}
+		if meta != nil {
+			msg.Source = meta.Source
+		}
+		err := c.intercept(ctx, common.MessageDirection_Outbound, "", msg)
+		if err != nil {
+			return fmt.Errorf("APP SDK send message failed, err: %w", err)
+		}
+		//边设备消息总是使用边设备自身的模型id和设备id发送
+		msgType, payload = msg.Type, msg.Payload
+		meta = &common.AppSdkMessageMeta{Source: msg.Source, Batch: meta != nil && meta.Batch}
+		if payload == nil {
+			return errors.New("APP SDK send message failed, err: empty payload after interceptors")
+		}
+	}
 	var topicType string
 	switch msgType {
 	case common.AppSdkMessageType_Property:
@@ -116,22 +298,47 @@ func (c *AppCoreClient) SendMessage(msgType common.AppSdkMessageType, payload []
 		topicType = codec.TopicType_PubService
 	case common.AppSdkMessageType_ServiceReply:
 		topicType = codec.TopicType_PubServiceReply
+	case common.AppSdkMessageType_PropertySetReply:
+		topicType = codec.TopicType_PubPropertySetReply
 	default:
 		return errors.New("APP SDK send message failed, err: unsupported message type")
 	}
+	var err error
+	if validate {
+		err = c.validateOutgoing(msgType, payload)
+		if err != nil {
+			return errors.New("APP SDK send message failed, err: " + err.Error())
+		}
+	}
 	var pubTopic string
 	var pubData []byte
 	if msgType == common.AppSdkMessageType_Property || msgType == common.AppSdkMessageType_Event ||
 		msgType == common.AppSdkMessageType_ServiceCall ||
-		msgType == common.AppSdkMessageType_ServiceReply {
-		tempTopic, tempData, err := c.codecHandler.EncodeMessage(topicType, c.cfg.ThingId, c.cfg.DeviceId, payload)
+		msgType == common.AppSdkMessageType_ServiceReply ||
+		msgType == common.AppSdkMessageType_PropertySetReply {
+		tempTopic, tempData, err := c.codecHandler.EncodeMessageWithMeta(topicType, c.cfg.ThingId, c.cfg.DeviceId, payload, meta)
 		if err != nil {
 			return err
 		}
 		pubTopic = tempTopic
 		pubData = tempData
 	}
-	return c.mqttHandler.Publish(pubTopic, 0, pubData)
+	err = c.mqttHandler.PublishContext(ctx, pubTopic, 0, pubData)
+	if err != nil {
+		return contextError("SendMessage", ctx, err)
+	}
+	c.recordOutgoing(msgType, pubTopic, pubData, payload, meta)
+	if msgType == common.AppSdkMessageType_Property {
+		//记录上报的属性值到设备影子
+		props := make([]*common.AppSdkMsgProperty, 0)
+		if json.Unmarshal(payload, &props) == nil {
+			err = c.shadow.Report(props)
+			if err != nil {
+				fmt.Println("APP SDK save shadow failed, err: " + err.Error())
+			}
+		}
+	}
+	return nil
 }
 
 func (c *AppCoreClient) GetEdgeDeviceInfo() (*common.EdgeLocalInfo, error) {
@@ -149,15 +356,63 @@ func (c *AppCoreClient) GetEndpointInfos() ([]*common.EndpointInfo, error) {
 	return c.metaHandler.GetSubDevices()
 }
 
+//获取子设备信息列表，ctx取消或者超时时中断请求
+func (c *AppCoreClient) GetEndpointInfosContext(ctx context.Context) ([]*common.EndpointInfo, error) {
+	if c.metaHandler == nil {
+		return nil, errors.New("APP SDK get endpoint infos failed, err: not init")
+	}
+	infos, err := c.metaHandler.GetSubDevicesContext(ctx)
+	if err != nil {
+		return nil, contextError("GetEndpointInfos", ctx, err)
+	}
+	return infos, nil
+}
+
 func (c *AppCoreClient) CallEndpoint(thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error) {
+	return c.CallEndpointContext(context.Background(), thingId, deviceId, req)
+}
+
+/*
+	调用子设备服务并等待回应，ctx设置了截止时间时按照ctx等待，否则最多等待5秒；
+	ctx取消或者超时时返回AppSdkContextError
+*/
+func (c *AppCoreClient) CallEndpointContext(ctx context.Context, thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error) {
 	if thingId == "" || deviceId == "" || req == nil || req.Identifier == "" {
 		return nil, errors.New("APP SDK CallEndpoint failed, err: invalid arguments")
 	}
+	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
+		return nil, errors.New("APP SDK CallEndpoint failed, err: not init")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, contextError("CallEndpoint", ctx, err)
+	}
 	if req.MessageId == "" {
 		req.MessageId = uuid.NewV1().String()
 	}
 	//encode message
 	tempData, _ := json.Marshal(req)
+	if len(c.interceptors) > 0 {
+		msg := &common.AppSdkMessageData{
+			Type: common.AppSdkMessageType_ServiceCall,
+			ThingId: thingId,
+			DeviceId: deviceId,
+			Payload: tempData,
+		}
+		err := c.intercept(ctx, common.MessageDirection_Outbound, "", msg)
+		if err != nil {
+			return nil, fmt.Errorf("APP SDK CallEndpoint failed, err: %w", err)
+		}
+		//拦截器可以修改调用的设备和服务调用内容，回应按照修改后的消息id匹配
+		thingId, deviceId, tempData = msg.ThingId, msg.DeviceId, msg.Payload
+		req = &common.AppSdkMsgServiceCall{}
+		err = json.Unmarshal(tempData, req)
+		if err != nil {
+			return nil, errors.New("APP SDK CallEndpoint failed, err: " + err.Error())
+		}
+		if thingId == "" || deviceId == "" || req.Identifier == "" || req.MessageId == "" {
+			return nil, errors.New("APP SDK CallEndpoint failed, err: invalid message after interceptors")
+		}
+	}
 	callTopic, callPayload, err := c.codecHandler.EncodeMessage(codec.TopicType_PubService, thingId, deviceId, tempData)
 	if err != nil {
 		return nil, errors.New("APP SDK CallEndpoint failed, err: " + err.Error())
@@ -167,50 +422,104 @@ func (c *AppCoreClient) CallEndpoint(thingId string, deviceId string, req *commo
 	if err != nil {
 		return nil, errors.New("APP SDK CallEndpoint failed, err: " + err.Error())
 	}
-	exitCh := make(chan error)
-	replyCh := make(chan *common.AppSdkMsgServiceReply)
+	//调用返回之后收到的回应直接丢弃，避免阻塞mqtt客户端的回调
+	exitCh := make(chan error, 1)
+	replyCh := make(chan *common.AppSdkMsgServiceReply, 1)
+	exit := func(err error) {
+		select {
+		case exitCh <- err:
+		default:
+		}
+	}
 	err = c.mqttHandler.Subscribe(replyTopic, 0, func(topic string, payload []byte) {
 		if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
-			exitCh <- errors.New("APP SDK CallEndpoint callback failed, err: not init")
+			exit(errors.New("APP SDK CallEndpoint callback failed, err: not init"))
 			return
 		}
 		topicType, _, _, data, err := c.codecHandler.DecodeMessage(topic, payload)
 		if err != nil {
-			exitCh <- errors.New("APP SDK CallEndpoint callback failed, err: " + err.Error())
+			exit(errors.New("APP SDK CallEndpoint callback failed, err: " + err.Error()))
 			return
 		}
 		if topicType != codec.TopicType_SubServiceReply {
-			exitCh <- errors.New("APP SDK CallEndpoint callback failed, err: not service reply")
+			exit(errors.New("APP SDK CallEndpoint callback failed, err: not service reply"))
 			return
 		}
 		replyMsg := &common.AppSdkMsgServiceReply{}
 		err = json.Unmarshal(data, replyMsg)
 		if err != nil {
-			exitCh <- errors.New("APP SDK CallEndpoint callback failed, err: " + err.Error())
+			exit(errors.New("APP SDK CallEndpoint callback failed, err: " + err.Error()))
 			return
 		}
 		if replyMsg.MessageId != req.MessageId {
 			//Match reply message id failed
 			return
 		}
-		replyCh <- replyMsg
+		select {
+		case replyCh <- replyMsg:
+		default:
+		}
 	})
 	if err != nil {
 		return nil, errors.New("APP SDK CallEndpoint failed, err: " + err.Error())
 	}
 	defer c.mqttHandler.Unsubscribe([]string{replyTopic})
-	err = c.mqttHandler.Publish(callTopic, 0, callPayload)
+	err = c.mqttHandler.PublishContext(ctx, callTopic, 0, callPayload)
 	if err != nil {
+		if err = contextError("CallEndpoint", ctx, err); errors.As(err, new(*common.AppSdkContextError)) {
+			return nil, err
+		}
 		return nil, errors.New("APP SDK CallEndpoint failed, err: " + err.Error())
 	}
+	var timeout <-chan time.Time
+	if _, ok := ctx.Deadline(); !ok {
+		timer := time.NewTimer(time.Second * 5)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 	select {
 	case value := <-replyCh:
 		return value, nil
 	case err := <- exitCh:
 		return nil, err
-	case <- time.After(time.Second * 5):
+	case <- timeout:
 		return nil, errors.New("APP SDK CallEndpoint failed, err: call timeout")
+	case <- ctx.Done():
+		return nil, contextError("CallEndpoint", ctx, ctx.Err())
+	}
+}
+
+//注册属性设置处理函数，注册后属性设置消息不再回调MessageCB，由SDK根据处理结果自动回应
+func (c *AppCoreClient) OnPropertySet(handler common.AppSdkPropertySetHandler) {
+	var temp common.AppSdkPropertySetHandlerContext
+	if handler != nil {
+		temp = func(ctx context.Context, props []*common.AppSdkMsgProperty) error {
+			return handler(props)
+		}
 	}
+	c.OnPropertySetContext(temp)
+}
+
+//注册带context的属性设置处理函数，与OnPropertySet相同
+func (c *AppCoreClient) OnPropertySetContext(handler common.AppSdkPropertySetHandlerContext) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.propertySetCB = handler
+}
+
+//获取设备影子中最后上报的属性值
+func (c *AppCoreClient) GetReported() []*common.AppSdkMsgProperty {
+	return c.shadow.GetReported()
+}
+
+//获取设备影子中平台期望设置的属性值
+func (c *AppCoreClient) GetDesired() []*common.AppSdkMsgProperty {
+	return c.shadow.GetDesired()
+}
+
+//获取设备影子中期望值与上报值不一致的属性
+func (c *AppCoreClient) GetDelta() []*common.AppSdkMsgProperty {
+	return c.shadow.GetDelta()
 }
 
 func (c *AppCoreClient) onConnectStatus(status bool, errMsg string) {
@@ -222,71 +531,26 @@ func (c *AppCoreClient) onConnectStatus(status bool, errMsg string) {
 			return
 		}
 		//Callback connected event
-		if c.eventCB != nil {
-			evt := &common.AppSdkEventData{
-				Type: common.EventType_Connected,
-			}
-			c.eventCB(evt, c.eventParam)
-		}
-		//Subscribe topics of edge device
-		topics := make([]string, 0)
-		tempTopic, err := c.codecHandler.EncodeTopic(codec.TopicType_SubProperty, "+", c.cfg.ThingId, c.cfg.DeviceId)
-		if err != nil {
-			fmt.Printf("APP SDK onConnected EncodeTopic failed, topicType: %s, err: %s\n",
-				codec.TopicType_SubProperty, err.Error())
-		} else {
-			topics = append(topics, tempTopic)
-		}
-		tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubEvent, "+", c.cfg.ThingId, c.cfg.DeviceId)
-		if err != nil {
-			fmt.Printf("APP SDK onConnected EncodeTopic failed, topicType: %s, err: %s\n",
-				codec.TopicType_SubEvent, err.Error())
-		} else {
-			topics = append(topics, tempTopic)
-		}
-		for _, srvId := range c.serviceIds {
-			tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubService, srvId, c.cfg.ThingId, c.cfg.DeviceId)
-			if err != nil {
-				fmt.Printf("APP SDK onConnected EncodeTopic failed, topicType: %s, err: %s\n",
-					codec.TopicType_SubService, err.Error())
-			} else {
-				topics = append(topics, tempTopic)
-			}
-		}
-		//非代理模式下，可以直接订阅子设备的模型消息
-		if !c.cfg.ProxyMode {
-			//Subscribe topics of endpoints
-			for _, thingId := range c.epThingIds {
-				tempTopic, err := c.codecHandler.EncodeTopic(codec.TopicType_SubProperty, "+", thingId, "+")
-				if err != nil {
-					fmt.Printf("APP SDK onConnected EncodeTopic for endpoints failed, topicType: %s, err: %s\n",
-						codec.TopicType_SubProperty, err.Error())
-				} else {
-					topics = append(topics, tempTopic)
-				}
-				tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubEvent, "+", thingId, "+")
-				if err != nil {
-					fmt.Printf("APP SDK onConnected EncodeTopic for endpoints failed, topicType: %s, err: %s\n",
-						codec.TopicType_SubEvent, err.Error())
-				} else {
-					topics = append(topics, tempTopic)
-				}
-			}
-		}
-		err = c.mqttHandler.SubscribeMultiple(topics, c.onRecvData)
+		c.callEventCB(&common.AppSdkEventData{
+			Type: common.EventType_Connected,
+		})
+		//连接成功后，之前的订阅已经失效(clean session)，需要全部重新订阅
+		c.subs.setConnected(true)
+		err := c.syncSubscriptions()
 		if err != nil {
 			fmt.Println("APP SDK onConnected subscribe topics failed, err: " + err.Error())
+			return
 		}
 		fmt.Println("APP SDK onConnected subscribe topics success")
+		//断线期间可能错过了属性设置，重新通知期望值与上报值的差异
+		c.shadow.Reconcile()
 	} else {
 		//Disconnected
 		fmt.Println("APP SDK onConnectStatus called, status is disconnected, err: " + errMsg)
-		if c.eventCB != nil {
-			evt := &common.AppSdkEventData{
-				Type: common.EventType_Disconnected,
-			}
-			c.eventCB(evt, c.eventParam)
-		}
+		c.subs.setConnected(false)
+		c.callEventCB(&common.AppSdkEventData{
+			Type: common.EventType_Disconnected,
+		})
 	}
 
 }
@@ -296,11 +560,48 @@ func (c *AppCoreClient) onRecvData(topic string, payload []byte) {
 		fmt.Println("APP SDK onRecvData failed, err: not init")
 		return
 	}
-	topicType, thingId, deviceId, data, err := c.codecHandler.DecodeMessage(topic, payload)
+	atomic.AddUint64(&c.stats.received, 1)
+	ctx, cancel := c.messageContext()
+	defer cancel()
+	decoded, err := c.codecHandler.Decode(topic, payload)
+	if err == codec.ErrSelfMessage {
+		return
+	}
+	c.recordIncoming(topic, payload, decoded, err)
 	if err != nil {
-		fmt.Println("APP SDK onRecvData DecodeMessage failed, err: " + err.Error())
+		c.reportDecodeError(topic, payload, err, false)
 		return
 	}
+	topicType, thingId, deviceId, data := decoded.TopicType, decoded.ThingId, decoded.DeviceId, decoded.Payload
+	endpoint := thingId != c.cfg.ThingId || deviceId != c.cfg.DeviceId
+	//事件消息按照最低级别过滤
+	if topicType == codec.TopicType_SubEvent {
+		minLevel := c.subs.eventLevelFilter(thingId, endpoint)
+		if minLevel != "" {
+			dropped, err := filterEvent(data, minLevel)
+			if err != nil {
+				c.reportDecodeError(topic, payload, err, false)
+				return
+			}
+			if dropped {
+				return
+			}
+		}
+	}
+	//子设备属性消息按照订阅过滤条件过滤属性标识
+	if topicType == codec.TopicType_SubProperty && endpoint {
+		ids := c.subs.propertyFilter(thingId)
+		if ids != nil {
+			data, err = filterProperties(data, ids)
+			if err != nil {
+				c.reportDecodeError(topic, payload, err, false)
+				return
+			}
+			if data == nil {
+				return
+			}
+		}
+	}
 	var msgType common.AppSdkMessageType
 	switch topicType {
 	case codec.TopicType_SubProperty:
@@ -309,17 +610,93 @@ func (c *AppCoreClient) onRecvData(topic string, payload []byte) {
 		msgType = common.AppSdkMessageType_Event
 	case codec.TopicType_SubService:
 		msgType = common.AppSdkMessageType_ServiceCall
+		if c.validateServiceCall(ctx, data) != nil {
+			return
+		}
+	case codec.TopicType_SubPropertySet:
+		msgType = common.AppSdkMessageType_PropertySet
 	default:
+		//兼容之前的行为，未知类型的消息仍然回调MessageCB
 		msgType = common.AppSdkMessageType_Unknown
+		c.reportDecodeError(topic, payload, fmt.Errorf("%w: %s", errUnknownMessage, topicType), true)
 	}
 	msg := &common.AppSdkMessageData{
 		Type: msgType,
 		ThingId: thingId,
 		DeviceId: deviceId,
 		Payload: data,
+		Version: decoded.Version,
+		MessageId: decoded.MessageId,
+		Source: decoded.Source,
+		EpochTime: decoded.EpochTime,
+		RawType: decoded.RawType,
+	}
+	if len(c.interceptors) > 0 {
+		err = c.intercept(ctx, common.MessageDirection_Inbound, topic, msg)
+		if err != nil {
+			if !errors.Is(err, common.ErrMessageDropped) {
+				fmt.Println("APP SDK onRecvData interceptor failed, topic: " + topic + ", err: " + err.Error())
+			}
+			return
+		}
+	}
+	if msg.Type == common.AppSdkMessageType_PropertySet {
+		c.desireProperties(msg.Payload)
+		c.lock.RLock()
+		handler := c.propertySetCB
+		c.lock.RUnlock()
+		if handler != nil {
+			c.handlePropertySet(ctx, topic, handler, msg.Payload)
+			return
+		}
+	}
+	c.dispatchMessage(ctx, topic, msg)
+}
+
+//调用属性设置处理函数，并根据处理结果回应
+func (c *AppCoreClient) handlePropertySet(ctx context.Context, topic string, handler common.AppSdkPropertySetHandlerContext, data []byte) {
+	set := &common.AppSdkMsgPropertySet{}
+	err := json.Unmarshal(data, set)
+	if err != nil {
+		fmt.Println("APP SDK handlePropertySet Unmarshal failed, err: " + err.Error())
+		return
+	}
+	reply := &common.AppSdkMsgPropertySetReply{
+		MessageId: set.MessageId,
+		Code: 200,
+	}
+	err = c.callPropertySetHandler(ctx, topic, handler, set.Properties)
+	if err != nil {
+		reply.Code = 500
+		reply.Message = err.Error()
 	}
-	if c.messageCB == nil {
+	replyData, _ := json.Marshal(reply)
+	err = c.SendMessage(common.AppSdkMessageType_PropertySetReply, replyData)
+	//回应被拦截器丢弃时不是错误
+	if err != nil && !errors.Is(err, common.ErrMessageDropped) {
+		fmt.Println("APP SDK handlePropertySet reply failed, err: " + err.Error())
+	}
+}
+
+//记录属性设置的期望值到设备影子
+func (c *AppCoreClient) desireProperties(data []byte) {
+	set := &common.AppSdkMsgPropertySet{}
+	err := json.Unmarshal(data, set)
+	if err != nil {
+		fmt.Println("APP SDK desireProperties Unmarshal failed, err: " + err.Error())
 		return
 	}
-	c.messageCB(msg, c.messageParam)
-}
\ No newline at end of file
+	err = c.shadow.Desire(set.Properties)
+	if err != nil {
+		fmt.Println("APP SDK save shadow failed, err: " + err.Error())
+	}
+}
+
+//ctx取消或者超时导致的错误转换为AppSdkContextError，其他错误不变
+func contextError(op string, ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || !errors.Is(err, ctxErr) {
+		return err
+	}
+	return &common.AppSdkContextError{Op: op, Err: ctxErr}
+}
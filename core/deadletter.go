@@ -0,0 +1,49 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"sync/atomic"
+)
+
+//无法识别的消息类型
+var errUnknownMessage = errors.New("unknown message type")
+
+//消息接收计数，通过原子操作更新
+type messageStats struct {
+	received 		uint64
+	decodeErrors 	uint64
+	unknown 		uint64
+}
+
+//获取消息接收统计
+func (c *AppCoreClient) GetMessageStats() *common.AppSdkMessageStats {
+	return &common.AppSdkMessageStats{
+		Received: atomic.LoadUint64(&c.stats.received),
+		DecodeErrors: atomic.LoadUint64(&c.stats.decodeErrors),
+		Unknown: atomic.LoadUint64(&c.stats.unknown),
+	}
+}
+
+//上报无法处理的消息，通过EventType_DecodeError事件回调应用，避免消息被静默丢弃
+func (c *AppCoreClient) reportDecodeError(topic string, payload []byte, err error, unknown bool) {
+	if unknown {
+		atomic.AddUint64(&c.stats.unknown, 1)
+	} else {
+		atomic.AddUint64(&c.stats.decodeErrors, 1)
+		fmt.Println("APP SDK onRecvData decode message failed, topic: " + topic + ", err: " + err.Error())
+	}
+	if c.eventCB == nil {
+		return
+	}
+	c.callEventCB(&common.AppSdkEventData{
+		Type: common.EventType_DecodeError,
+		Payload: &common.AppSdkDecodeError{
+			Topic: topic,
+			Payload: append([]byte{}, payload...),
+			Err: err,
+			Unknown: unknown,
+		},
+	})
+}
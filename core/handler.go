@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"github.com/qingcloud-iot/edge-app-go/common"
+)
+
+/*
+	按照模型id、设备id和标识id注册消息处理函数，参数为空或者"*"时匹配任意值，
+	多个处理函数匹配时选择最具体的一个，没有匹配的消息回调MessageCB；
+	注册处理函数不会订阅消息，子设备消息和边设备服务调用仍然需要订阅
+*/
+
+//注册属性消息处理函数，消息中的属性分别匹配，handler为nil时删除
+func (c *AppCoreClient) OnProperty(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_Property, thingId, deviceId, identifier, handler)
+}
+
+//注册事件消息处理函数，handler为nil时删除
+func (c *AppCoreClient) OnEvent(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_Event, thingId, deviceId, identifier, handler)
+}
+
+//注册服务调用消息处理函数，handler为nil时删除
+func (c *AppCoreClient) OnServiceCall(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_ServiceCall, thingId, deviceId, identifier, handler)
+}
+
+//注册带context的属性消息处理函数，ctx在处理完成或者SDK停止时取消
+func (c *AppCoreClient) OnPropertyContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_Property, thingId, deviceId, identifier, handler)
+}
+
+//注册带context的事件消息处理函数，ctx在处理完成或者SDK停止时取消
+func (c *AppCoreClient) OnEventContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_Event, thingId, deviceId, identifier, handler)
+}
+
+//注册带context的服务调用消息处理函数，ctx在处理完成或者SDK停止时取消
+func (c *AppCoreClient) OnServiceCallContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_ServiceCall, thingId, deviceId, identifier, handler)
+}
+
+/*
+	按照注册的处理函数分发消息，没有匹配的消息回调MessageCB；
+	MessageCB在NewClient时设置，为保持兼容不传递ctx，需要ctx时使用带Context的处理函数
+*/
+func (c *AppCoreClient) dispatchMessage(ctx context.Context, topic string, msg *common.AppSdkMessageData) {
+	for _, target := range c.router.Route(msg) {
+		if target.Handler == nil {
+			c.callMessageCB(topic, target.Message)
+			continue
+		}
+		c.callMessageHandler(ctx, topic, target.Handler, target.Message)
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"context"
+	"github.com/qingcloud-iot/edge-app-go/common"
+)
+
+//设置消息拦截器，需要在Init之前调用，按照设置的顺序执行
+func (c *AppCoreClient) SetInterceptors(interceptors []common.AppSdkInterceptor) {
+	c.interceptors = make([]common.AppSdkInterceptor, 0, len(interceptors))
+	for _, interceptor := range interceptors {
+		if interceptor != nil {
+			c.interceptors = append(c.interceptors, interceptor)
+		}
+	}
+}
+
+/*
+	依次执行拦截器，拦截器直接修改msg，任一拦截器返回错误时停止执行并丢弃消息，
+	拦截器panic时按照返回错误处理
+*/
+func (c *AppCoreClient) intercept(ctx context.Context, direction common.MessageDirection, topic string, msg *common.AppSdkMessageData) error {
+	for _, interceptor := range c.interceptors {
+		err := c.callInterceptor(ctx, direction, topic, interceptor, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
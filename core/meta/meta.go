@@ -3,6 +3,7 @@ package meta
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/qingcloud-iot/edge-app-go/common"
 	"io/ioutil"
@@ -14,6 +15,7 @@ import (
 
 const (
 	Metadata_Url_ChildDevice = "http://%s:%d/internal/data/childDevice"
+	Metadata_Url_ThingModel = "http://%s:%d/internal/data/thingModel/%s"
 )
 
 func NewMetaClient(addr string, port int) *MetaClient {
@@ -23,7 +25,8 @@ func NewMetaClient(addr string, port int) *MetaClient {
 		client: &http.Client{
 			Transport: &http.Transport{
 				DialContext: func(ctx context.Context, netw string, addr string) (net.Conn, error) {
-					c, err := net.DialTimeout(netw, addr, 5 * time.Second)
+					dialer := &net.Dialer{Timeout: 5 * time.Second}
+					c, err := dialer.DialContext(ctx, netw, addr)
 					if err != nil {
 						return nil, err
 					}
@@ -43,8 +46,17 @@ type MetaClient struct {
 }
 
 func (m *MetaClient) GetSubDevices() ([]*common.EndpointInfo, error) {
+	return m.GetSubDevicesContext(context.Background())
+}
+
+//获取子设备列表，ctx取消或者超时时中断请求，返回的错误包含ctx.Err()
+func (m *MetaClient) GetSubDevicesContext(ctx context.Context) ([]*common.EndpointInfo, error) {
 	url := fmt.Sprintf(Metadata_Url_ChildDevice, m.addr, m.port)
-	resp, err := m.client.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -75,3 +87,21 @@ func (m *MetaClient) GetSubDevices() ([]*common.EndpointInfo, error) {
 	return results, nil
 }
 
+
+//获取物模型定义，返回JSON格式的物模型数据
+func (m *MetaClient) GetThingModel(thingId string) ([]byte, error) {
+	url := fmt.Sprintf(Metadata_Url_ThingModel, m.addr, m.port, thingId)
+	resp, err := m.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("get thing model failed, status: " + resp.Status)
+	}
+	return data, nil
+}
@@ -5,12 +5,17 @@ import (
 	"errors"
 	"fmt"
 	paho "github.com/eclipse/paho.mqtt.golang"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	DefaultKeepAlive 		= 5 * time.Second
 	DefaultWaitTimeout 		= 5 * time.Second
+	//原始消息订阅的最大qos
+	DefaultRawQos 			= 1
 )
 
 //第一次连接成功的回调（因为paho第一次连接上之后，内部有重连机制，所以只需要处理第一连接成功的重连，保证第一次能够连接成功）
@@ -20,7 +25,11 @@ type OnCollectedCallback func(bool, string)
 type MessageCallback func(string, []byte)
 
 func NewMqttClient(id string, url string, cb OnCollectedCallback) (*MqttClient, error) {
-	mc := &MqttClient{}
+	mc := &MqttClient{
+		modelTopics: make(map[string]struct{}),
+		routes: make(map[string]MessageCallback),
+		rawRoutes: make(map[string]MessageCallback),
+	}
 	if url == "" || id == "" {
 		return nil, errors.New("invalid arguments")
 	}
@@ -32,6 +41,8 @@ func NewMqttClient(id string, url string, cb OnCollectedCallback) (*MqttClient,
 	options.SetKeepAlive(DefaultKeepAlive)
 	options.SetOnConnectHandler(mc.onConnect)
 	options.SetConnectionLostHandler(mc.onDisconnect)
+	//订阅时不向paho注册路由，全部消息由dispatch统一分发，避免重叠的订阅互相覆盖回调
+	options.SetDefaultPublishHandler(mc.dispatch)
 	mc.client = paho.NewClient(options)
 	mc.connectedCB = cb
 	return mc, nil
@@ -43,14 +54,47 @@ type MqttClient struct {
 
 	cancelCtx 	context.Context
 	cancelFn 	context.CancelFunc
+	//连接成功后关闭，用于StartContext等待连接
+	connected 	chan struct{}
+	connOnce 	*sync.Once
+
+	//保护订阅路由
+	lock 		sync.RWMutex
+	//模型消息订阅的topic，共用modelCB回调
+	modelTopics map[string]struct{}
+	modelCB 	MessageCallback
+	//单独回调的订阅，如服务调用回应
+	routes 		map[string]MessageCallback
+	//原始消息订阅，断线重连后自动恢复
+	rawRoutes 	map[string]MessageCallback
 }
 
 func (m *MqttClient) Start() error {
 	m.cancelCtx, m.cancelFn = context.WithCancel(context.Background())
+	m.connected = make(chan struct{})
+	m.connOnce = &sync.Once{}
 	go m.tryConnect()
 	return nil
 }
 
+/*
+	启动并等待第一次连接成功，连接成功的回调执行完成之后返回；
+	ctx取消或者超时时停止连接并返回ctx.Err()
+*/
+func (m *MqttClient) StartContext(ctx context.Context) error {
+	err := m.Start()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-m.connected:
+		return nil
+	case <-ctx.Done():
+		m.cancelFn()
+		return ctx.Err()
+	}
+}
+
 func (m *MqttClient) Stop() {
 	if m.cancelFn != nil {
 		m.cancelFn()
@@ -62,45 +106,269 @@ func (m *MqttClient) Subscribe(topic string, qos int32, cb MessageCallback) erro
 	if topic == "" || qos < 0 || qos > 2 || cb == nil {
 		return errors.New("invalid arguments")
 	}
-	if token := m.client.Subscribe(topic, byte(qos), func(client paho.Client, message paho.Message) {
-		cb(message.Topic(), message.Payload())
-	}); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+	m.lock.Lock()
+	m.routes[topic] = cb
+	m.lock.Unlock()
+	if token := m.client.Subscribe(topic, byte(qos), nil); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+		m.lock.Lock()
+		delete(m.routes, topic)
+		m.lock.Unlock()
 		return token.Error()
 	}
 	return nil
 }
 
+//订阅模型消息，所有模型消息topic共用同一个回调
 func (m *MqttClient) SubscribeMultiple(topics []string, cb MessageCallback) error {
 	filters := make(map[string]byte)
+	added := make([]string, 0)
+	m.lock.Lock()
+	m.modelCB = cb
 	for _, topic := range topics {
 		if topic == "" {
 			continue
 		}
 		filters[topic] = 0
+		if _, ok := m.modelTopics[topic]; !ok {
+			m.modelTopics[topic] = struct{}{}
+			added = append(added, topic)
+		}
 	}
-	if token := m.client.SubscribeMultiple(filters, func(client paho.Client, message paho.Message) {
-		cb(message.Topic(), message.Payload())
-	}); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+	m.lock.Unlock()
+	if token := m.client.SubscribeMultiple(filters, nil); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+		m.lock.Lock()
+		for _, topic := range added {
+			delete(m.modelTopics, topic)
+		}
+		m.lock.Unlock()
 		return token.Error()
 	}
 	return nil
 }
 
+//取消模型消息和单独回调的订阅，原始消息仍在使用的topic不会向服务端取消订阅
 func (m *MqttClient) Unsubscribe(topics []string) error {
+	m.lock.Lock()
+	for _, topic := range topics {
+		delete(m.modelTopics, topic)
+		delete(m.routes, topic)
+	}
+	unused := m.unusedTopics(topics)
+	m.lock.Unlock()
+	return m.doUnsubscribe(unused)
+}
+
+//订阅原始mqtt消息，同一个filter重复订阅时替换回调，断线重连后自动恢复
+func (m *MqttClient) SubscribeRaw(filter string, cb MessageCallback) error {
+	if !validTopicFilter(filter) || cb == nil {
+		return errors.New("invalid arguments")
+	}
+	m.lock.Lock()
+	_, existed := m.rawRoutes[filter]
+	m.rawRoutes[filter] = cb
+	m.lock.Unlock()
+	if existed || !m.client.IsConnectionOpen() {
+		//未连接时只记录订阅，连接成功后再订阅
+		return nil
+	}
+	if token := m.client.Subscribe(filter, DefaultRawQos, nil); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+		m.lock.Lock()
+		delete(m.rawRoutes, filter)
+		m.lock.Unlock()
+		return token.Error()
+	}
+	return nil
+}
+
+//取消原始mqtt消息订阅
+func (m *MqttClient) UnsubscribeRaw(filter string) error {
+	m.lock.Lock()
+	if _, ok := m.rawRoutes[filter]; !ok {
+		m.lock.Unlock()
+		return nil
+	}
+	delete(m.rawRoutes, filter)
+	unused := m.unusedTopics([]string{filter})
+	m.lock.Unlock()
+	if !m.client.IsConnectionOpen() {
+		return nil
+	}
+	return m.doUnsubscribe(unused)
+}
+
+//发布原始mqtt消息，payload可以为空，用于清除保留消息
+func (m *MqttClient) PublishRaw(topic string, qos int32, retain bool, payload []byte) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") || qos < 0 || qos > 2 {
+		return errors.New("invalid arguments")
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+	if token := m.client.Publish(topic, byte(qos), retain, payload); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+//返回没有被任何订阅使用的topic，调用前需要持有m.lock
+func (m *MqttClient) unusedTopics(topics []string) []string {
+	result := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		_, model := m.modelTopics[topic]
+		_, route := m.routes[topic]
+		_, raw := m.rawRoutes[topic]
+		if !model && !route && !raw {
+			result = append(result, topic)
+		}
+	}
+	return result
+}
+
+func (m *MqttClient) doUnsubscribe(topics []string) error {
+	if len(topics) == 0 {
+		return nil
+	}
 	if token := m.client.Unsubscribe(topics...); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
 		return token.Error()
 	}
 	return nil
 }
 
+//分发收到的消息，模型消息回调最多调用一次，单独回调和原始消息回调按照filter排序依次调用
+func (m *MqttClient) dispatch(client paho.Client, message paho.Message) {
+	topic := message.Topic()
+	payload := message.Payload()
+	var modelCB MessageCallback
+	callbacks := make([]MessageCallback, 0)
+	m.lock.RLock()
+	for filter := range m.modelTopics {
+		if TopicMatch(filter, topic) {
+			modelCB = m.modelCB
+			break
+		}
+	}
+	for _, routes := range []map[string]MessageCallback{m.routes, m.rawRoutes} {
+		filters := make([]string, 0)
+		for filter := range routes {
+			if TopicMatch(filter, topic) {
+				filters = append(filters, filter)
+			}
+		}
+		sort.Strings(filters)
+		for _, filter := range filters {
+			callbacks = append(callbacks, routes[filter])
+		}
+	}
+	m.lock.RUnlock()
+	if modelCB != nil {
+		modelCB(topic, payload)
+	}
+	for _, cb := range callbacks {
+		cb(topic, payload)
+	}
+}
+
+//恢复原始消息订阅
+func (m *MqttClient) restoreRaw() {
+	m.lock.RLock()
+	filters := make(map[string]byte)
+	for filter := range m.rawRoutes {
+		filters[filter] = DefaultRawQos
+	}
+	m.lock.RUnlock()
+	if len(filters) == 0 {
+		return
+	}
+	if token := m.client.SubscribeMultiple(filters, nil); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
+		fmt.Println("APP SDK restore raw subscriptions failed, err: " + token.Error().Error())
+	}
+}
+
+//检查mqtt订阅filter格式，"#"只能作为最后一级，"+"必须占据完整的一级
+func validTopicFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	units := strings.Split(filter, "/")
+	for i, unit := range units {
+		if strings.Contains(unit, "#") && (unit != "#" || i != len(units)-1) {
+			return false
+		}
+		if strings.Contains(unit, "+") && unit != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+//判断topic是否匹配订阅filter，以"$"开头的topic不匹配首级通配符，SDK、mock和testhub共用
+func TopicMatch(filter string, topic string) bool {
+	if filter == topic {
+		return true
+	}
+	filterUnits := strings.Split(filter, "/")
+	topicUnits := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "$") && (filterUnits[0] == "+" || filterUnits[0] == "#") {
+		return false
+	}
+	for i, unit := range filterUnits {
+		if unit == "#" {
+			return true
+		}
+		if i >= len(topicUnits) {
+			return false
+		}
+		if unit != "+" && unit != topicUnits[i] {
+			return false
+		}
+	}
+	return len(filterUnits) == len(topicUnits)
+}
+
 func (m *MqttClient) Publish(topic string, qos int32, payload []byte) error {
+	return m.PublishContext(context.Background(), topic, qos, payload)
+}
+
+//发布消息，ctx取消或者超时时返回ctx.Err()
+func (m *MqttClient) PublishContext(ctx context.Context, topic string, qos int32, payload []byte) error {
 	if topic == "" || qos < 0 || qos > 2 || payload == nil {
 		return errors.New("invalid arguments")
 	}
-	if token := m.client.Publish(topic, byte(qos), false, payload); token.WaitTimeout(DefaultWaitTimeout) && token.Error() != nil {
-		return token.Error()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return waitToken(ctx, m.client.Publish(topic, byte(qos), false, payload))
+}
+
+/*
+	等待token完成，ctx取消或者超时时返回ctx.Err()；
+	ctx没有设置截止时间时最多等待DefaultWaitTimeout，与WaitTimeout相同，等待超时不返回错误。
+	paho的token不支持通过channel等待，在单独的goroutine中等待，goroutine最多等待到截止时间后退出
+*/
+func waitToken(ctx context.Context, token paho.Token) error {
+	deadline, hasDeadline := ctx.Deadline()
+	wait := DefaultWaitTimeout
+	if hasDeadline {
+		wait = time.Until(deadline)
+	}
+	done := make(chan bool, 1)
+	go func() {
+		done <- token.WaitTimeout(wait)
+	}()
+	select {
+	case completed := <-done:
+		if completed {
+			return token.Error()
+		}
+		if !hasDeadline {
+			return nil
+		}
+		//已经到达截止时间，等待ctx超时
+		<-ctx.Done()
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
 func (m *MqttClient) tryConnect() {
@@ -133,9 +401,15 @@ func (m *MqttClient) doConnect() error {
 }
 
 func (m *MqttClient) onConnect(client paho.Client) {
+	m.restoreRaw()
 	if m.connectedCB != nil {
 		m.connectedCB(true, "")
 	}
+	if m.connOnce != nil {
+		m.connOnce.Do(func() {
+			close(m.connected)
+		})
+	}
 }
 
 func (m *MqttClient) onDisconnect(client paho.Client, err error) {
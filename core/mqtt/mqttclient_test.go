@@ -0,0 +1,80 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTopicMatch(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(TopicMatch("#", "a/b/c"))
+	assert.True(TopicMatch("a/#", "a"))
+	assert.True(TopicMatch("a/+/c", "a/b/c"))
+	assert.True(TopicMatch("/sys/+/+/thing/event/+/post", "/sys/t1/d1/thing/event/e1/post"))
+	assert.False(TopicMatch("a/+", "a/b/c"))
+	assert.False(TopicMatch("a/b/c", "a/b"))
+	assert.False(TopicMatch("#", "$SYS/uptime"))
+	assert.True(TopicMatch("$SYS/#", "$SYS/uptime"))
+}
+
+func TestValidTopicFilter(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(validTopicFilter("#"))
+	assert.True(validTopicFilter("a/+/c/#"))
+	assert.False(validTopicFilter(""))
+	assert.False(validTopicFilter("a/#/c"))
+	assert.False(validTopicFilter("a/b+"))
+}
+
+//测试使用的token，关闭done之后完成
+type testToken struct {
+	done 	chan struct{}
+	err 	error
+}
+
+func (t *testToken) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *testToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (t *testToken) Error() error {
+	return t.err
+}
+
+func TestWaitToken(t *testing.T) {
+	assert := assert.New(t)
+	//token完成后返回token的错误
+	token := &testToken{done: make(chan struct{}), err: errors.New("failed")}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(token.done)
+	}()
+	assert.EqualError(waitToken(context.Background(), token), "failed")
+
+	//ctx取消时立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	begin := time.Now()
+	assert.Equal(context.Canceled, waitToken(ctx, &testToken{done: make(chan struct{})}))
+	assert.True(time.Since(begin) < time.Second)
+
+	//到达截止时间时返回超时
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, waitToken(ctx, &testToken{done: make(chan struct{})}))
+}
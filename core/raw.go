@@ -0,0 +1,45 @@
+package core
+
+import (
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go/common"
+)
+
+//发布原始mqtt消息，topic和payload不经过模型消息编码
+func (c *AppCoreClient) PublishRaw(topic string, qos int32, retain bool, payload []byte) error {
+	if c.mqttHandler == nil || c.cfg == nil {
+		return errors.New("APP SDK publish raw message failed, err: not init")
+	}
+	err := c.mqttHandler.PublishRaw(topic, qos, retain, payload)
+	if err != nil {
+		return errors.New("APP SDK publish raw message failed, err: " + err.Error())
+	}
+	return nil
+}
+
+//订阅原始mqtt消息，filter支持mqtt通配符，消息不经过模型消息解码，也不会回调MessageCB，断线重连后自动恢复
+func (c *AppCoreClient) SubscribeRaw(filter string, handler common.AppSdkRawMessageCB) error {
+	if c.mqttHandler == nil || c.cfg == nil {
+		return errors.New("APP SDK subscribe raw topic failed, err: not init")
+	}
+	if handler == nil {
+		return errors.New("APP SDK subscribe raw topic failed, err: invalid arguments")
+	}
+	err := c.mqttHandler.SubscribeRaw(filter, c.wrapRawMessageCB(handler))
+	if err != nil {
+		return errors.New("APP SDK subscribe raw topic failed, err: " + err.Error())
+	}
+	return nil
+}
+
+//取消订阅原始mqtt消息
+func (c *AppCoreClient) UnsubscribeRaw(filter string) error {
+	if c.mqttHandler == nil || c.cfg == nil {
+		return errors.New("APP SDK unsubscribe raw topic failed, err: not init")
+	}
+	err := c.mqttHandler.UnsubscribeRaw(filter)
+	if err != nil {
+		return errors.New("APP SDK unsubscribe raw topic failed, err: " + err.Error())
+	}
+	return nil
+}
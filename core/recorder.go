@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/record"
+	"time"
+)
+
+//收到的消息topic类型与消息类型的对应关系
+var recordMessageTypes = map[string]common.AppSdkMessageType{
+	codec.TopicType_SubProperty: 	common.AppSdkMessageType_Property,
+	codec.TopicType_SubEvent: 		common.AppSdkMessageType_Event,
+	codec.TopicType_SubService: 	common.AppSdkMessageType_ServiceCall,
+	codec.TopicType_SubPropertySet: common.AppSdkMessageType_PropertySet,
+}
+
+//设置消息录制文件，需要在Init之前调用，path为空时不录制
+func (c *AppCoreClient) SetRecordFile(path string) {
+	c.recordFile = path
+}
+
+func (c *AppCoreClient) openRecorder() error {
+	if c.recordFile == "" || c.recorder != nil {
+		return nil
+	}
+	recorder, err := record.CreateRecorder(c.recordFile)
+	if err != nil {
+		return err
+	}
+	c.recorder = recorder
+	return nil
+}
+
+func (c *AppCoreClient) closeRecorder() {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.Close()
+	c.recorder = nil
+}
+
+//录制收到的消息，decoded为nil时记录解码失败的原因
+func (c *AppCoreClient) recordIncoming(topic string, payload []byte, decoded *codec.DecodedMessage, err error) {
+	recorder := c.recorder
+	if recorder == nil {
+		return
+	}
+	rec := &record.Record{
+		Time: time.Now(),
+		Direction: record.Direction_In,
+		Topic: topic,
+		Raw: payload,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if decoded != nil {
+		rec.Type = recordMessageTypes[decoded.TopicType]
+		rec.ThingId = decoded.ThingId
+		rec.DeviceId = decoded.DeviceId
+		rec.Payload = decoded.Payload
+		rec.Version = decoded.Version
+		rec.MessageId = decoded.MessageId
+		rec.RawType = decoded.RawType
+		rec.Source = decoded.Source
+		rec.EpochTime = decoded.EpochTime
+	}
+	c.writeRecord(recorder, rec)
+}
+
+//录制发送的消息，payload为SendMessage的参数
+func (c *AppCoreClient) recordOutgoing(msgType common.AppSdkMessageType, topic string, data []byte, payload []byte, meta *common.AppSdkMessageMeta) {
+	recorder := c.recorder
+	if recorder == nil {
+		return
+	}
+	rec := &record.Record{
+		Time: time.Now(),
+		Direction: record.Direction_Out,
+		Topic: topic,
+		Raw: data,
+		Type: msgType,
+		ThingId: c.cfg.ThingId,
+		DeviceId: c.cfg.DeviceId,
+		Payload: payload,
+	}
+	if meta != nil {
+		rec.Source = meta.Source
+	}
+	c.writeRecord(recorder, rec)
+}
+
+func (c *AppCoreClient) writeRecord(recorder *record.Recorder, rec *record.Record) {
+	err := recorder.Record(rec)
+	if err != nil {
+		fmt.Println("APP SDK record message failed, err: " + err.Error())
+	}
+}
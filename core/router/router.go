@@ -0,0 +1,202 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"sync"
+)
+
+//匹配任意模型id、设备id或者标识id的通配符，空字符串同样匹配任意值
+const Wildcard = "*"
+
+/*
+	模型消息路由，按照消息类型、模型id、设备id和标识id匹配处理函数，
+	支持属性、事件和服务调用消息，多个处理函数匹配时选择最具体的一个：
+	非通配符的字段越多越具体，数量相同时依次比较设备id、模型id和标识id是否为通配符
+*/
+type Router struct {
+	lock 	sync.RWMutex
+	routes 	[]*route
+}
+
+type route struct {
+	msgType 	common.AppSdkMessageType
+	thingId 	string
+	deviceId 	string
+	identifier 	string
+	handler 	common.AppSdkMessageHandlerContext
+}
+
+//路由结果，Handler为nil表示没有匹配的处理函数，需要回调MessageCB
+type Target struct {
+	Handler 	common.AppSdkMessageHandlerContext
+	Message 	*common.AppSdkMessageData
+}
+
+func NewRouter() *Router {
+	return &Router{
+		routes: make([]*route, 0),
+	}
+}
+
+/*
+	注册处理函数，只支持属性、事件和服务调用消息；相同的条件重复注册时替换之前的处理函数，handler为nil时删除
+*/
+func (r *Router) Handle(msgType common.AppSdkMessageType, thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	var temp common.AppSdkMessageHandlerContext
+	if handler != nil {
+		temp = func(ctx context.Context, msg *common.AppSdkMessageData) {
+			handler(msg)
+		}
+	}
+	r.HandleContext(msgType, thingId, deviceId, identifier, temp)
+}
+
+//注册带context的处理函数，与Handle相同
+func (r *Router) HandleContext(msgType common.AppSdkMessageType, thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	rt := &route{
+		msgType: msgType,
+		thingId: normalize(thingId),
+		deviceId: normalize(deviceId),
+		identifier: normalize(identifier),
+		handler: handler,
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i, temp := range r.routes {
+		if temp.msgType == rt.msgType && temp.thingId == rt.thingId && temp.deviceId == rt.deviceId && temp.identifier == rt.identifier {
+			if handler == nil {
+				r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			} else {
+				r.routes[i] = rt
+			}
+			return
+		}
+	}
+	if handler != nil {
+		r.routes = append(r.routes, rt)
+	}
+}
+
+//是否注册了处理函数
+func (r *Router) Empty() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.routes) == 0
+}
+
+/*
+	路由消息，属性消息中的每个属性分别匹配，匹配相同处理函数的属性合并为一条消息，
+	结果按照属性在消息中首次出现的顺序排列；消息内容解析失败时整条消息回调MessageCB
+*/
+func (r *Router) Route(msg *common.AppSdkMessageData) []*Target {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	fallback := []*Target{{Message: msg}}
+	if len(r.routes) == 0 || msg == nil {
+		return fallback
+	}
+	switch msg.Type {
+	case common.AppSdkMessageType_Event, common.AppSdkMessageType_ServiceCall:
+		header := &struct {
+			Identifier 	string 	`json:"identifier"`
+		}{}
+		if json.Unmarshal(msg.Payload, header) != nil {
+			return fallback
+		}
+		rt := r.match(msg.Type, msg.ThingId, msg.DeviceId, header.Identifier)
+		if rt == nil {
+			return fallback
+		}
+		return []*Target{{Handler: rt.handler, Message: msg}}
+	case common.AppSdkMessageType_Property:
+		return r.routeProperties(msg)
+	}
+	return fallback
+}
+
+func (r *Router) routeProperties(msg *common.AppSdkMessageData) []*Target {
+	fallback := []*Target{{Message: msg}}
+	props := make([]*common.AppSdkMsgProperty, 0)
+	if json.Unmarshal(msg.Payload, &props) != nil {
+		return fallback
+	}
+	//按照匹配的路由分组，nil表示没有匹配
+	groups := make([]*route, 0)
+	grouped := make(map[*route][]*common.AppSdkMsgProperty)
+	for _, prop := range props {
+		if prop == nil {
+			continue
+		}
+		rt := r.match(msg.Type, msg.ThingId, msg.DeviceId, prop.Identifier)
+		if _, ok := grouped[rt]; !ok {
+			groups = append(groups, rt)
+		}
+		grouped[rt] = append(grouped[rt], prop)
+	}
+	if len(groups) == 0 || len(groups) == 1 && groups[0] == nil {
+		return fallback
+	}
+	targets := make([]*Target, 0, len(groups))
+	for _, rt := range groups {
+		temp := *msg
+		if len(groups) > 1 {
+			temp.Payload, _ = json.Marshal(grouped[rt])
+		}
+		target := &Target{Message: &temp}
+		if rt != nil {
+			target.Handler = rt.handler
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+//查找最具体的路由，没有匹配时返回nil
+func (r *Router) match(msgType common.AppSdkMessageType, thingId string, deviceId string, identifier string) *route {
+	var result *route
+	best := -1
+	for _, rt := range r.routes {
+		if rt.msgType != msgType || !matchField(rt.thingId, thingId) ||
+			!matchField(rt.deviceId, deviceId) || !matchField(rt.identifier, identifier) {
+			continue
+		}
+		score := rt.score()
+		if score > best {
+			result = rt
+			best = score
+		}
+	}
+	return result
+}
+
+//具体程度，非通配符字段的数量优先，其次为设备id、模型id和标识id
+func (rt *route) score() int {
+	count := 0
+	weight := 0
+	if rt.deviceId != Wildcard {
+		count++
+		weight += 4
+	}
+	if rt.thingId != Wildcard {
+		count++
+		weight += 2
+	}
+	if rt.identifier != Wildcard {
+		count++
+		weight += 1
+	}
+	return count*8 + weight
+}
+
+func matchField(pattern string, value string) bool {
+	return pattern == Wildcard || pattern == value
+}
+
+func normalize(pattern string) string {
+	if pattern == "" {
+		return Wildcard
+	}
+	return pattern
+}
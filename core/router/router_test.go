@@ -0,0 +1,131 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+//记录调用的处理函数名称
+func named(name string, called *[]string) common.AppSdkMessageHandler {
+	return func(msg *common.AppSdkMessageData) {
+		*called = append(*called, name)
+	}
+}
+
+func dispatch(r *Router, msg *common.AppSdkMessageData) []string {
+	called := make([]string, 0)
+	for _, target := range r.Route(msg) {
+		if target.Handler == nil {
+			called = append(called, "fallback")
+			continue
+		}
+		target.Handler(context.Background(), target.Message)
+	}
+	return called
+}
+
+func TestRouter_Specificity(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRouter()
+	called := make([]string, 0)
+	r.Handle(common.AppSdkMessageType_Event, "*", "*", "overheat", named("any-overheat", &called))
+	r.Handle(common.AppSdkMessageType_Event, "iott-001", "", "overheat", named("thing-overheat", &called))
+	r.Handle(common.AppSdkMessageType_Event, "", "iotd-002", "overheat", named("device-overheat", &called))
+	r.Handle(common.AppSdkMessageType_Event, "iott-001", "iotd-002", "*", named("device-any", &called))
+	r.Handle(common.AppSdkMessageType_ServiceCall, "iott-001", "iotd-001", "reboot", named("reboot", &called))
+	event := func(thingId string, deviceId string, identifier string) *common.AppSdkMessageData {
+		payload, _ := json.Marshal(&common.AppSdkMsgEvent{Identifier: identifier})
+		return &common.AppSdkMessageData{Type: common.AppSdkMessageType_Event, ThingId: thingId, DeviceId: deviceId, Payload: payload}
+	}
+
+	cases := []struct {
+		msg 		*common.AppSdkMessageData
+		expected 	string
+	}{
+		{event("iott-009", "iotd-009", "overheat"), "any-overheat"},
+		{event("iott-001", "iotd-001", "overheat"), "thing-overheat"},
+		//非通配符数量相同时设备id优先
+		{event("iott-009", "iotd-002", "overheat"), "device-overheat"},
+		{event("iott-001", "iotd-002", "overheat"), "device-any"},
+		{event("iott-001", "iotd-002", "alarm"), "device-any"},
+		{event("iott-001", "iotd-001", "alarm"), "fallback"},
+	}
+	for _, c := range cases {
+		called = called[:0]
+		assert.Equal([]string{c.expected}, append(dispatch(r, c.msg), called...), string(c.msg.Payload))
+	}
+
+	//服务调用
+	called = called[:0]
+	payload, _ := json.Marshal(&common.AppSdkMsgServiceCall{Identifier: "reboot"})
+	fallback := dispatch(r, &common.AppSdkMessageData{Type: common.AppSdkMessageType_ServiceCall, ThingId: "iott-001", DeviceId: "iotd-001", Payload: payload})
+	assert.Empty(fallback)
+	assert.Equal([]string{"reboot"}, called)
+
+	//替换和删除处理函数
+	called = called[:0]
+	r.Handle(common.AppSdkMessageType_Event, "", "", "overheat", named("replaced", &called))
+	dispatch(r, event("iott-009", "iotd-009", "overheat"))
+	assert.Equal([]string{"replaced"}, called)
+	r.Handle(common.AppSdkMessageType_Event, "*", "*", "overheat", nil)
+	assert.Equal([]string{"fallback"}, dispatch(r, event("iott-009", "iotd-009", "overheat")))
+
+	//不支持路由的消息类型和无法解析的消息
+	assert.Equal([]string{"fallback"}, dispatch(r, &common.AppSdkMessageData{Type: common.AppSdkMessageType_PropertySet, ThingId: "iott-001", DeviceId: "iotd-002"}))
+	assert.Equal([]string{"fallback"}, dispatch(r, &common.AppSdkMessageData{Type: common.AppSdkMessageType_Event, ThingId: "iott-001", DeviceId: "iotd-002", Payload: []byte("{")}))
+}
+
+func TestRouter_Properties(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRouter()
+	assert.True(r.Empty())
+	payloads := make(map[string][]byte)
+	record := func(name string) common.AppSdkMessageHandler {
+		return func(msg *common.AppSdkMessageData) {
+			payloads[name] = msg.Payload
+		}
+	}
+	r.Handle(common.AppSdkMessageType_Property, "iott-001", "*", "temp", record("temp"))
+	r.Handle(common.AppSdkMessageType_Property, "iott-001", "iotd-001", "*", record("device"))
+	assert.False(r.Empty())
+	props := []*common.AppSdkMsgProperty{
+		{Identifier: "temp", Timestamp: 1, Value: 20},
+		{Identifier: "humi", Timestamp: 1, Value: 50},
+		{Identifier: "temp", Timestamp: 2, Value: 21},
+	}
+	payload, _ := json.Marshal(props)
+	msg := &common.AppSdkMessageData{Type: common.AppSdkMessageType_Property, ThingId: "iott-001", DeviceId: "iotd-002", Payload: payload, MessageId: "msg-001"}
+
+	//temp匹配处理函数，humi回调MessageCB
+	targets := r.Route(msg)
+	if !assert.Len(targets, 2) {
+		return
+	}
+	assert.NotNil(targets[0].Handler)
+	assert.Equal("msg-001", targets[0].Message.MessageId)
+	assert.JSONEq(`[{"identifier":"temp","timestamp":1,"value":20},{"identifier":"temp","timestamp":2,"value":21}]`, string(targets[0].Message.Payload))
+	assert.Nil(targets[1].Handler)
+	assert.JSONEq(`[{"identifier":"humi","timestamp":1,"value":50}]`, string(targets[1].Message.Payload))
+	//原始消息不变
+	assert.Equal(payload, msg.Payload)
+
+	//所有属性匹配同一个处理函数时不拆分消息
+	msg.DeviceId = "iotd-001"
+	targets = r.Route(msg)
+	if assert.Len(targets, 1) {
+		targets[0].Handler(context.Background(), targets[0].Message)
+	}
+	assert.Equal(payload, payloads["device"])
+	assert.Nil(payloads["temp"])
+	r.Handle(common.AppSdkMessageType_Property, "iott-001", "iotd-001", "*", nil)
+	r.Handle(common.AppSdkMessageType_Property, "iott-001", "*", "temp", nil)
+	assert.True(r.Empty())
+	targets = r.Route(msg)
+	if assert.Len(targets, 1) {
+		assert.Nil(targets[0].Handler)
+		assert.Equal(msg, targets[0].Message)
+	}
+}
@@ -0,0 +1,270 @@
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//上报值持久化的默认间隔
+const DefaultSaveInterval = time.Second
+
+//持久化文件格式
+type shadowDocument struct {
+	//最后一次上报的属性值
+	Reported 	map[string]*common.AppSdkMsgProperty 	`json:"reported"`
+	//平台期望设置的属性值
+	Desired 	map[string]*common.AppSdkMsgProperty 	`json:"desired"`
+}
+
+/*
+	本地设备影子：记录边设备最后上报的属性值(reported)和平台下发的期望属性值(desired)，
+	两者不一致的属性即为差异(delta)，path不为空时持久化到文件：
+	期望值变化时立即写入，上报值变化时最多每interval写入一次，避免频繁上报时每次都重写整个文件
+*/
+type Shadow struct {
+	lock 		sync.Mutex
+	path 		string
+	doc 		*shadowDocument
+	deltaCB 	common.AppSdkShadowDeltaCB
+	//上报值持久化的间隔，小于0时每次上报都写入文件
+	interval 	time.Duration
+	//是否有未写入文件的变化
+	dirty 		bool
+	//等待写入文件的定时器
+	timer 		*time.Timer
+}
+
+func NewShadow(path string, cb common.AppSdkShadowDeltaCB) *Shadow {
+	return &Shadow{
+		path: path,
+		doc: &shadowDocument{
+			Reported: make(map[string]*common.AppSdkMsgProperty),
+			Desired: make(map[string]*common.AppSdkMsgProperty),
+		},
+		deltaCB: cb,
+		interval: DefaultSaveInterval,
+	}
+}
+
+//设置上报值持久化的间隔，为0时使用DefaultSaveInterval，小于0时每次上报都写入文件
+func (s *Shadow) SetSaveInterval(interval time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if interval == 0 {
+		interval = DefaultSaveInterval
+	}
+	s.interval = interval
+}
+
+//从文件加载影子数据，文件不存在时使用空的影子
+func (s *Shadow) Load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	doc := &shadowDocument{}
+	err = json.Unmarshal(data, doc)
+	if err != nil {
+		return err
+	}
+	if doc.Reported == nil {
+		doc.Reported = make(map[string]*common.AppSdkMsgProperty)
+	}
+	if doc.Desired == nil {
+		doc.Desired = make(map[string]*common.AppSdkMsgProperty)
+	}
+	s.lock.Lock()
+	s.doc = doc
+	s.lock.Unlock()
+	return nil
+}
+
+//记录上报的属性值，按照持久化间隔延迟写入文件，延迟写入失败时只打印错误
+func (s *Shadow) Report(props []*common.AppSdkMsgProperty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, prop := range props {
+		if prop == nil || prop.Identifier == "" {
+			continue
+		}
+		//乱序上报时只保留时间戳最新的属性值
+		if old, ok := s.doc.Reported[prop.Identifier]; ok && old.Timestamp > prop.Timestamp {
+			continue
+		}
+		temp := *prop
+		s.doc.Reported[prop.Identifier] = &temp
+	}
+	return s.saveLater()
+}
+
+//记录平台期望设置的属性值，存在差异时回调delta
+func (s *Shadow) Desire(props []*common.AppSdkMsgProperty) error {
+	s.lock.Lock()
+	for _, prop := range props {
+		if prop == nil || prop.Identifier == "" {
+			continue
+		}
+		temp := *prop
+		s.doc.Desired[prop.Identifier] = &temp
+	}
+	err := s.save()
+	delta := s.delta()
+	s.lock.Unlock()
+	s.notify(delta)
+	return err
+}
+
+//存在差异时回调delta，用于断线重连后重新同步期望值
+func (s *Shadow) Reconcile() {
+	s.lock.Lock()
+	delta := s.delta()
+	s.lock.Unlock()
+	s.notify(delta)
+}
+
+//获取最后上报的属性值，按照标识id排序
+func (s *Shadow) GetReported() []*common.AppSdkMsgProperty {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return sortedProperties(s.doc.Reported)
+}
+
+//获取平台期望设置的属性值，按照标识id排序
+func (s *Shadow) GetDesired() []*common.AppSdkMsgProperty {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return sortedProperties(s.doc.Desired)
+}
+
+//获取期望值与上报值不一致的属性，按照标识id排序
+func (s *Shadow) GetDelta() []*common.AppSdkMsgProperty {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.delta()
+}
+
+func (s *Shadow) delta() []*common.AppSdkMsgProperty {
+	results := make(map[string]*common.AppSdkMsgProperty)
+	for k, desired := range s.doc.Desired {
+		reported, ok := s.doc.Reported[k]
+		if ok && equalValue(reported.Value, desired.Value) {
+			continue
+		}
+		results[k] = desired
+	}
+	return sortedProperties(results)
+}
+
+func (s *Shadow) notify(delta []*common.AppSdkMsgProperty) {
+	if s.deltaCB == nil || len(delta) == 0 {
+		return
+	}
+	s.deltaCB(delta)
+}
+
+//立即写入未持久化的上报值，SDK停止时调用
+func (s *Shadow) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+//标记变化并在间隔之后写入文件，间隔内的多次变化只写入一次，调用前需要持有锁
+func (s *Shadow) saveLater() error {
+	if s.path == "" {
+		return nil
+	}
+	if s.interval < 0 {
+		return s.save()
+	}
+	s.dirty = true
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.onTimer)
+	}
+	return nil
+}
+
+func (s *Shadow) onTimer() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timer = nil
+	if !s.dirty {
+		return
+	}
+	err := s.save()
+	if err != nil {
+		fmt.Println("APP SDK save shadow failed, err: " + err.Error())
+	}
+}
+
+//先写临时文件再重命名，避免写入过程中断导致文件损坏，调用前需要持有锁
+func (s *Shadow) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.doc)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+	err = os.Rename(tempFile.Name(), s.path)
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+//属性值可能来自不同的JSON解码结果(如int和float64)，统一序列化之后比较
+func equalValue(a interface{}, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return bytes.Equal(dataA, dataB)
+}
+
+func sortedProperties(props map[string]*common.AppSdkMsgProperty) []*common.AppSdkMsgProperty {
+	results := make([]*common.AppSdkMsgProperty, 0, len(props))
+	for _, prop := range props {
+		temp := *prop
+		results = append(results, &temp)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Identifier < results[j].Identifier
+	})
+	return results
+}
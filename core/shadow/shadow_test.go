@@ -0,0 +1,92 @@
+package shadow
+
+import (
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShadow_Delta(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "shadow")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "shadow.json")
+	deltas := make([][]*common.AppSdkMsgProperty, 0)
+	s := NewShadow(path, func(delta []*common.AppSdkMsgProperty) {
+		deltas = append(deltas, delta)
+	})
+	assert.Nil(s.Load())
+	assert.Nil(s.Report([]*common.AppSdkMsgProperty{
+		{Identifier: "switch", Timestamp: 1593274999806, Value: 0},
+		{Identifier: "level", Timestamp: 1593274999806, Value: 10},
+	}))
+	assert.Nil(s.Desire([]*common.AppSdkMsgProperty{
+		{Identifier: "switch", Value: 1},
+		{Identifier: "level", Value: 10.0},
+	}))
+	if assert.Len(deltas, 1) && assert.Len(deltas[0], 1) {
+		assert.Equal("switch", deltas[0][0].Identifier)
+	}
+	//重新加载之后差异保持不变
+	loaded := NewShadow(path, nil)
+	assert.Nil(loaded.Load())
+	assert.Len(loaded.GetReported(), 2)
+	assert.Len(loaded.GetDesired(), 2)
+	assert.Len(loaded.GetDelta(), 1)
+	//上报期望值之后差异消失
+	assert.Nil(loaded.Report([]*common.AppSdkMsgProperty{
+		{Identifier: "switch", Timestamp: 1593274999807, Value: 1},
+	}))
+	assert.Len(loaded.GetDelta(), 0)
+}
+
+//间隔内的多次上报只写入一次文件，期望值立即写入，Flush写入未持久化的上报值
+func TestShadow_SaveInterval(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "shadow")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "shadow.json")
+	reported := func() []*common.AppSdkMsgProperty {
+		loaded := NewShadow(path, nil)
+		assert.Nil(loaded.Load())
+		return loaded.GetReported()
+	}
+
+	s := NewShadow(path, nil)
+	s.SetSaveInterval(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		assert.Nil(s.Report([]*common.AppSdkMsgProperty{{Identifier: "temp", Timestamp: int64(i), Value: i}}))
+	}
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+	time.Sleep(300 * time.Millisecond)
+	if props := reported(); assert.Len(props, 1) {
+		assert.EqualValues(9, props[0].Value)
+	}
+
+	//期望值立即写入，同时写入未持久化的上报值
+	assert.Nil(s.Report([]*common.AppSdkMsgProperty{{Identifier: "level", Timestamp: 1, Value: 1}}))
+	assert.Len(reported(), 1)
+	assert.Nil(s.Desire([]*common.AppSdkMsgProperty{{Identifier: "level", Value: 2}}))
+	assert.Len(reported(), 2)
+
+	assert.Nil(s.Report([]*common.AppSdkMsgProperty{{Identifier: "mode", Timestamp: 1, Value: "auto"}}))
+	assert.Len(reported(), 2)
+	assert.Nil(s.Flush())
+	assert.Len(reported(), 3)
+
+	//小于0时每次上报都写入文件
+	s.SetSaveInterval(-1)
+	assert.Nil(s.Report([]*common.AppSdkMsgProperty{{Identifier: "speed", Timestamp: 1, Value: 3}}))
+	assert.Len(reported(), 4)
+}
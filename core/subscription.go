@@ -0,0 +1,377 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"sort"
+	"sync"
+)
+
+/*
+	订阅状态管理：记录运行时动态增删的服务调用id和子设备模型id，
+	以及当前已经在EdgeHub上生效的topic，断线重连后根据记录重新订阅
+*/
+type subscriptionState struct {
+	sync.Mutex
+	//订阅的边设备服务调用id
+	serviceIds 		map[string]struct{}
+	//订阅的子设备过滤条件，key为模型id
+	filters 		map[string]*common.EndpointFilter
+	//已经订阅成功的topic
+	subscribed 		map[string]struct{}
+	//边设备事件的最低级别，为空时不过滤
+	minEventLevel 	common.EventLevel
+	//是否已经连接EdgeHub
+	connected 		bool
+	//连接状态变化的次数，订阅期间连接状态变化时不记录订阅结果
+	epoch 			uint64
+	//保证同一时间只有一次订阅同步，同步期间不持有状态锁，不阻塞消息接收
+	syncLock 		sync.Mutex
+}
+
+func newSubscriptionState(srvIds []string, thingIds []string) *subscriptionState {
+	s := &subscriptionState{
+		serviceIds: make(map[string]struct{}),
+		filters: make(map[string]*common.EndpointFilter),
+		subscribed: make(map[string]struct{}),
+	}
+	addKeys(s.serviceIds, srvIds)
+	for _, thingId := range thingIds {
+		if thingId == "" {
+			continue
+		}
+		s.filters[thingId] = &common.EndpointFilter{ThingId: thingId}
+	}
+	return s
+}
+
+//获取事件的最低级别，为空表示不过滤
+func (s *subscriptionState) eventLevelFilter(thingId string, endpoint bool) common.EventLevel {
+	s.Lock()
+	defer s.Unlock()
+	if !endpoint {
+		return s.minEventLevel
+	}
+	filter, ok := s.filters[thingId]
+	if !ok {
+		return ""
+	}
+	return filter.MinEventLevel
+}
+
+//获取子设备模型的属性过滤条件，返回nil表示不过滤
+func (s *subscriptionState) propertyFilter(thingId string) map[string]struct{} {
+	s.Lock()
+	defer s.Unlock()
+	filter, ok := s.filters[thingId]
+	if !ok || len(filter.PropertyIds) == 0 {
+		return nil
+	}
+	ids := make(map[string]struct{})
+	addKeys(ids, filter.PropertyIds)
+	return ids
+}
+
+//更新连接状态，重新连接后之前的订阅已经失效(clean session)，需要全部重新订阅
+func (s *subscriptionState) setConnected(connected bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.connected = connected
+	s.epoch++
+	if connected {
+		s.subscribed = make(map[string]struct{})
+	}
+}
+
+//计算需要新增订阅和取消订阅的topic，调用前需要持有锁
+func (s *subscriptionState) diff(desired []string) ([]string, []string) {
+	wanted := make(map[string]struct{})
+	added := make([]string, 0)
+	for _, topic := range desired {
+		if topic == "" {
+			continue
+		}
+		wanted[topic] = struct{}{}
+		if _, ok := s.subscribed[topic]; !ok {
+			added = append(added, topic)
+		}
+	}
+	removed := make([]string, 0)
+	for topic := range s.subscribed {
+		if _, ok := wanted[topic]; !ok {
+			removed = append(removed, topic)
+		}
+	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+func addKeys(set map[string]struct{}, keys []string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		set[key] = struct{}{}
+	}
+}
+
+func removeKeys(set map[string]struct{}, keys []string) {
+	for _, key := range keys {
+		delete(set, key)
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//订阅子设备模型消息，只有在非Proxy模式下才生效
+func (c *AppCoreClient) SubscribeEndpoints(thingIds ...string) error {
+	if len(thingIds) == 0 {
+		return errors.New("APP SDK SubscribeEndpoints failed, err: invalid arguments")
+	}
+	filters := make([]*common.EndpointFilter, 0, len(thingIds))
+	for _, thingId := range thingIds {
+		filters = append(filters, &common.EndpointFilter{ThingId: thingId})
+	}
+	return c.SubscribeEndpointFilters(filters...)
+}
+
+//按过滤条件订阅子设备模型消息，同一模型id的过滤条件会替换之前的订阅，只有在非Proxy模式下才生效
+func (c *AppCoreClient) SubscribeEndpointFilters(filters ...*common.EndpointFilter) error {
+	if len(filters) == 0 {
+		return errors.New("APP SDK SubscribeEndpointFilters failed, err: invalid arguments")
+	}
+	for _, filter := range filters {
+		if filter == nil || filter.ThingId == "" {
+			return errors.New("APP SDK SubscribeEndpointFilters failed, err: invalid arguments")
+		}
+	}
+	c.subs.Lock()
+	for _, filter := range filters {
+		temp := *filter
+		c.subs.filters[filter.ThingId] = &temp
+	}
+	c.subs.Unlock()
+	return c.syncSubscriptions()
+}
+
+//取消订阅子设备模型消息
+func (c *AppCoreClient) UnsubscribeEndpoints(thingIds ...string) error {
+	if len(thingIds) == 0 {
+		return errors.New("APP SDK UnsubscribeEndpoints failed, err: invalid arguments")
+	}
+	c.subs.Lock()
+	for _, thingId := range thingIds {
+		delete(c.subs.filters, thingId)
+	}
+	c.subs.Unlock()
+	return c.syncSubscriptions()
+}
+
+//订阅边设备服务调用
+func (c *AppCoreClient) AddServices(serviceIds ...string) error {
+	if len(serviceIds) == 0 {
+		return errors.New("APP SDK AddServices failed, err: invalid arguments")
+	}
+	c.subs.Lock()
+	addKeys(c.subs.serviceIds, serviceIds)
+	c.subs.Unlock()
+	return c.syncSubscriptions()
+}
+
+//取消订阅边设备服务调用
+func (c *AppCoreClient) RemoveServices(serviceIds ...string) error {
+	if len(serviceIds) == 0 {
+		return errors.New("APP SDK RemoveServices failed, err: invalid arguments")
+	}
+	c.subs.Lock()
+	removeKeys(c.subs.serviceIds, serviceIds)
+	c.subs.Unlock()
+	return c.syncSubscriptions()
+}
+
+//根据当前订阅状态计算需要订阅的topic，并与已订阅的topic比较，只订阅或取消变化的部分；
+//未连接时只记录状态，等待连接成功后再订阅。
+//在锁内计算差异，订阅和取消订阅的网络请求不持有c.subs的锁，完成后重新加锁记录结果
+func (c *AppCoreClient) syncSubscriptions() error {
+	if c.mqttHandler == nil || c.codecHandler == nil || c.cfg == nil {
+		return nil
+	}
+	c.subs.syncLock.Lock()
+	defer c.subs.syncLock.Unlock()
+	c.subs.Lock()
+	if !c.subs.connected {
+		c.subs.Unlock()
+		return nil
+	}
+	epoch := c.subs.epoch
+	added, removed := c.subs.diff(c.buildTopics())
+	c.subs.Unlock()
+	if len(removed) > 0 {
+		err := c.mqttHandler.Unsubscribe(removed)
+		if err != nil {
+			return errors.New("APP SDK unsubscribe topics failed, err: " + err.Error())
+		}
+		c.commitSubscriptions(epoch, nil, removed)
+	}
+	if len(added) > 0 {
+		err := c.mqttHandler.SubscribeMultiple(added, c.onRecvData)
+		if err != nil {
+			return errors.New("APP SDK subscribe topics failed, err: " + err.Error())
+		}
+		c.commitSubscriptions(epoch, added, nil)
+	}
+	return nil
+}
+
+//记录订阅结果，订阅期间连接状态发生变化时丢弃结果，由重新连接后的同步重新订阅
+func (c *AppCoreClient) commitSubscriptions(epoch uint64, added []string, removed []string) {
+	c.subs.Lock()
+	defer c.subs.Unlock()
+	if c.subs.epoch != epoch {
+		return
+	}
+	removeKeys(c.subs.subscribed, removed)
+	addKeys(c.subs.subscribed, added)
+}
+
+//生成当前需要订阅的全部topic，调用前需要持有c.subs的锁
+func (c *AppCoreClient) buildTopics() []string {
+	//Subscribe topics of edge device
+	topics := make([]string, 0)
+	tempTopic, err := c.codecHandler.EncodeTopic(codec.TopicType_SubProperty, "+", c.cfg.ThingId, c.cfg.DeviceId)
+	if err != nil {
+		fmt.Printf("APP SDK EncodeTopic failed, topicType: %s, err: %s\n",
+			codec.TopicType_SubProperty, err.Error())
+	} else {
+		topics = append(topics, tempTopic)
+	}
+	tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubEvent, "+", c.cfg.ThingId, c.cfg.DeviceId)
+	if err != nil {
+		fmt.Printf("APP SDK EncodeTopic failed, topicType: %s, err: %s\n",
+			codec.TopicType_SubEvent, err.Error())
+	} else {
+		topics = append(topics, tempTopic)
+	}
+	tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubPropertySet, "", c.cfg.ThingId, c.cfg.DeviceId)
+	if err != nil {
+		fmt.Printf("APP SDK EncodeTopic failed, topicType: %s, err: %s\n",
+			codec.TopicType_SubPropertySet, err.Error())
+	} else {
+		topics = append(topics, tempTopic)
+	}
+	for _, srvId := range sortedKeys(c.subs.serviceIds) {
+		tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubService, srvId, c.cfg.ThingId, c.cfg.DeviceId)
+		if err != nil {
+			fmt.Printf("APP SDK EncodeTopic failed, topicType: %s, err: %s\n",
+				codec.TopicType_SubService, err.Error())
+		} else {
+			topics = append(topics, tempTopic)
+		}
+	}
+	//非代理模式下，可以直接订阅子设备的模型消息
+	if !c.cfg.ProxyMode {
+		//Subscribe topics of endpoints
+		for _, thingId := range sortedFilterKeys(c.subs.filters) {
+			topics = append(topics, c.buildEndpointTopics(c.subs.filters[thingId])...)
+		}
+	}
+	return topics
+}
+
+//生成子设备过滤条件对应的topic，未指定设备id或事件id时使用通配符"+"
+func (c *AppCoreClient) buildEndpointTopics(filter *common.EndpointFilter) []string {
+	deviceIds := uniqueOrWildcard(filter.DeviceIds)
+	eventIds := uniqueOrWildcard(filter.EventIds)
+	topics := make([]string, 0)
+	for _, deviceId := range deviceIds {
+		tempTopic, err := c.codecHandler.EncodeTopic(codec.TopicType_SubProperty, "+", filter.ThingId, deviceId)
+		if err != nil {
+			fmt.Printf("APP SDK EncodeTopic for endpoints failed, topicType: %s, err: %s\n",
+				codec.TopicType_SubProperty, err.Error())
+		} else {
+			topics = append(topics, tempTopic)
+		}
+		for _, eventId := range eventIds {
+			tempTopic, err = c.codecHandler.EncodeTopic(codec.TopicType_SubEvent, eventId, filter.ThingId, deviceId)
+			if err != nil {
+				fmt.Printf("APP SDK EncodeTopic for endpoints failed, topicType: %s, err: %s\n",
+					codec.TopicType_SubEvent, err.Error())
+			} else {
+				topics = append(topics, tempTopic)
+			}
+		}
+	}
+	return topics
+}
+
+//去重并排序，列表为空或者包含通配符时返回通配符
+func uniqueOrWildcard(values []string) []string {
+	set := make(map[string]struct{})
+	for _, value := range values {
+		if value == "+" {
+			return []string{"+"}
+		}
+		if value != "" {
+			set[value] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return []string{"+"}
+	}
+	return sortedKeys(set)
+}
+
+func sortedFilterKeys(filters map[string]*common.EndpointFilter) []string {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//过滤属性消息，只保留指定标识id的属性，全部被过滤时返回nil
+func filterProperties(data []byte, ids map[string]struct{}) ([]byte, error) {
+	props := make([]*common.AppSdkMsgProperty, 0)
+	err := json.Unmarshal(data, &props)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*common.AppSdkMsgProperty, 0, len(props))
+	for _, prop := range props {
+		if _, ok := ids[prop.Identifier]; ok {
+			results = append(results, prop)
+		}
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(results)
+}
+
+//判断事件级别是否低于最低级别
+func filterEvent(data []byte, minLevel common.EventLevel) (bool, error) {
+	evt := &common.AppSdkMsgEvent{}
+	err := json.Unmarshal(data, evt)
+	if err != nil {
+		return false, err
+	}
+	return evt.Level.Severity() < minLevel.Severity(), nil
+}
+
+//设置边设备事件的最低级别，低于此级别的事件不会回调
+func (c *AppCoreClient) SetMinEventLevel(level common.EventLevel) {
+	c.subs.Lock()
+	defer c.subs.Unlock()
+	c.subs.minEventLevel = level
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSubscriptionState_Diff(t *testing.T) {
+	assert := assert.New(t)
+	s := newSubscriptionState([]string{"reboot", ""}, []string{"iott-sub", ""})
+	assert.Len(s.serviceIds, 1)
+	assert.Len(s.filters, 1)
+
+	added, removed := s.diff([]string{"a", "b", ""})
+	assert.Equal([]string{"a", "b"}, added)
+	assert.Empty(removed)
+	addKeys(s.subscribed, added)
+
+	added, removed = s.diff([]string{"b", "c"})
+	assert.Equal([]string{"c"}, added)
+	assert.Equal([]string{"a"}, removed)
+
+	//重新连接后之前的订阅失效，全部重新订阅
+	epoch := s.epoch
+	s.setConnected(true)
+	assert.True(s.connected)
+	assert.NotEqual(epoch, s.epoch)
+	added, removed = s.diff([]string{"b", "c"})
+	assert.Equal([]string{"b", "c"}, added)
+	assert.Empty(removed)
+
+	//断开连接时保留订阅记录，重新连接时再清除
+	addKeys(s.subscribed, added)
+	s.setConnected(false)
+	assert.False(s.connected)
+	assert.Len(s.subscribed, 2)
+}
+
+func TestUniqueOrWildcard(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"+"}, uniqueOrWildcard(nil))
+	assert.Equal([]string{"+"}, uniqueOrWildcard([]string{""}))
+	assert.Equal([]string{"+"}, uniqueOrWildcard([]string{"a", "+"}))
+	assert.Equal([]string{"a", "b"}, uniqueOrWildcard([]string{"b", "a", "b"}))
+}
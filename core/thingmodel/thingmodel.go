@@ -0,0 +1,393 @@
+package thingmodel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	数据类型定义
+*/
+const (
+	//整型
+	DataType_Int 		= "int"
+	//单精度浮点型
+	DataType_Float 		= "float"
+	//双精度浮点型
+	DataType_Double 	= "double"
+	//布尔型
+	DataType_Bool 		= "bool"
+	//字符串
+	DataType_String 	= "string"
+	//枚举，值为Enum中定义的key
+	DataType_Enum 		= "enum"
+	//时间，毫秒时间戳或者RFC3339格式字符串
+	DataType_Date 		= "date"
+	//结构体，成员定义在Specs中
+	DataType_Struct 	= "struct"
+	//数组，元素类型定义在Item中
+	DataType_Array 		= "array"
+)
+
+//数据类型定义
+type DataType struct {
+	//类型，参考DataType_*定义
+	Type 		string 				`json:"type"`
+	//最小值，数值类型有效
+	Min 		*float64 			`json:"min,omitempty"`
+	//最大值，数值类型有效
+	Max 		*float64 			`json:"max,omitempty"`
+	//单位
+	Unit 		string 				`json:"unit,omitempty"`
+	//最大长度，字符串和数组类型有效
+	Length 		int 				`json:"length,omitempty"`
+	//枚举值和描述，枚举类型有效
+	Enum 		map[string]string 	`json:"enum,omitempty"`
+	//结构体成员，结构体类型有效
+	Specs 		[]*Param 			`json:"specs,omitempty"`
+	//数组元素类型，数组类型有效
+	Item 		*DataType 			`json:"item,omitempty"`
+}
+
+//参数定义，用于事件参数、服务调用输入输出参数和结构体成员
+type Param struct {
+	//标识id
+	Identifier 	string 				`json:"identifier"`
+	//名称
+	Name 		string 				`json:"name"`
+	//数据类型
+	DataType 	*DataType 			`json:"dataType"`
+	//是否必填
+	Required 	bool 				`json:"required"`
+}
+
+//属性定义
+type Property struct {
+	//标识id
+	Identifier 	string 				`json:"identifier"`
+	//名称
+	Name 		string 				`json:"name"`
+	//数据类型
+	DataType 	*DataType 			`json:"dataType"`
+	//读写模式，r为只读，rw为读写
+	AccessMode 	string 				`json:"accessMode"`
+}
+
+//事件定义
+type Event struct {
+	//标识id
+	Identifier 	string 				`json:"identifier"`
+	//名称
+	Name 		string 				`json:"name"`
+	//事件参数
+	Params 		[]*Param 			`json:"params"`
+}
+
+//服务定义
+type Service struct {
+	//标识id
+	Identifier 	string 				`json:"identifier"`
+	//名称
+	Name 		string 				`json:"name"`
+	//输入参数
+	Input 		[]*Param 			`json:"input"`
+	//输出参数
+	Output 		[]*Param 			`json:"output"`
+}
+
+/*
+	物模型定义
+*/
+type Model struct {
+	//模型id
+	ThingId 	string 				`json:"thingId"`
+	//模型名称
+	Name 		string 				`json:"name"`
+	//属性列表
+	Properties 	[]*Property 		`json:"properties"`
+	//事件列表
+	Events 		[]*Event 			`json:"events"`
+	//服务列表
+	Services 	[]*Service 			`json:"services"`
+}
+
+//校验失败的错误，包含全部不符合物模型定义的内容
+type ValidationError struct {
+	Errors 		[]string
+}
+
+func (e *ValidationError) Error() string {
+	return "thing model validation failed: " + strings.Join(e.Errors, "; ")
+}
+
+//从JSON文件加载物模型
+func LoadFile(path string) (*Model, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+//解析JSON格式的物模型定义
+func Parse(data []byte) (*Model, error) {
+	m := &Model{}
+	err := json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	err = m.check()
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//查找属性定义
+func (m *Model) Property(identifier string) *Property {
+	for _, prop := range m.Properties {
+		if prop.Identifier == identifier {
+			return prop
+		}
+	}
+	return nil
+}
+
+//查找事件定义
+func (m *Model) Event(identifier string) *Event {
+	for _, evt := range m.Events {
+		if evt.Identifier == identifier {
+			return evt
+		}
+	}
+	return nil
+}
+
+//查找服务定义
+func (m *Model) Service(identifier string) *Service {
+	for _, srv := range m.Services {
+		if srv.Identifier == identifier {
+			return srv
+		}
+	}
+	return nil
+}
+
+//校验属性标识id和属性值
+func (m *Model) ValidateProperty(identifier string, value interface{}) error {
+	prop := m.Property(identifier)
+	if prop == nil {
+		return newValidationError([]string{fmt.Sprintf("unknown property %q", identifier)})
+	}
+	return newValidationError(validateValue("property "+identifier, prop.DataType, value))
+}
+
+//校验属性单位，物模型或者属性没有指定单位时不校验
+func (m *Model) ValidateUnit(identifier string, unit string) error {
+	prop := m.Property(identifier)
+	if prop == nil || prop.DataType == nil || prop.DataType.Unit == "" || unit == "" {
+		return nil
+	}
+	if prop.DataType.Unit != unit {
+		return newValidationError([]string{fmt.Sprintf("property %s: unit %q does not match %q", identifier, unit, prop.DataType.Unit)})
+	}
+	return nil
+}
+
+//校验事件标识id和事件参数
+func (m *Model) ValidateEvent(identifier string, params map[string]interface{}) error {
+	evt := m.Event(identifier)
+	if evt == nil {
+		return newValidationError([]string{fmt.Sprintf("unknown event %q", identifier)})
+	}
+	return newValidationError(validateParams("event "+identifier, evt.Params, params))
+}
+
+//校验服务调用的输入参数
+func (m *Model) ValidateServiceInput(identifier string, params map[string]interface{}) error {
+	srv := m.Service(identifier)
+	if srv == nil {
+		return newValidationError([]string{fmt.Sprintf("unknown service %q", identifier)})
+	}
+	return newValidationError(validateParams("service "+identifier+" input", srv.Input, params))
+}
+
+//校验服务调用回应的输出参数
+func (m *Model) ValidateServiceOutput(identifier string, params map[string]interface{}) error {
+	srv := m.Service(identifier)
+	if srv == nil {
+		return newValidationError([]string{fmt.Sprintf("unknown service %q", identifier)})
+	}
+	return newValidationError(validateParams("service "+identifier+" output", srv.Output, params))
+}
+
+//检查物模型定义本身是否完整
+func (m *Model) check() error {
+	errs := make([]string, 0)
+	for _, prop := range m.Properties {
+		if prop.Identifier == "" || prop.DataType == nil {
+			errs = append(errs, "property identifier and dataType should not be empty")
+		}
+	}
+	for _, evt := range m.Events {
+		if evt.Identifier == "" {
+			errs = append(errs, "event identifier should not be empty")
+		}
+		errs = append(errs, checkParams("event "+evt.Identifier, evt.Params)...)
+	}
+	for _, srv := range m.Services {
+		if srv.Identifier == "" {
+			errs = append(errs, "service identifier should not be empty")
+		}
+		errs = append(errs, checkParams("service "+srv.Identifier+" input", srv.Input)...)
+		errs = append(errs, checkParams("service "+srv.Identifier+" output", srv.Output)...)
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid thing model: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func checkParams(path string, params []*Param) []string {
+	errs := make([]string, 0)
+	for _, param := range params {
+		if param.Identifier == "" || param.DataType == nil {
+			errs = append(errs, path+" param identifier and dataType should not be empty")
+		}
+	}
+	return errs
+}
+
+func newValidationError(errs []string) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+func validateParams(path string, defs []*Param, params map[string]interface{}) []string {
+	errs := make([]string, 0)
+	known := make(map[string]*Param)
+	for _, def := range defs {
+		known[def.Identifier] = def
+		if _, ok := params[def.Identifier]; !ok && def.Required {
+			errs = append(errs, fmt.Sprintf("%s: missing param %q", path, def.Identifier))
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		def, ok := known[k]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: unknown param %q", path, k))
+			continue
+		}
+		errs = append(errs, validateValue(path+"."+k, def.DataType, params[k])...)
+	}
+	return errs
+}
+
+/*
+	物模型校验中的数值转换，与common.ToFloat不同，不接受字符串，
+	"12"这样的字符串不能通过int、float、double类型的校验，只有json.Number按照数值处理
+*/
+func toNumber(value interface{}) (float64, error) {
+	if num, ok := value.(json.Number); ok {
+		return num.Float64()
+	}
+	if value != nil && reflect.TypeOf(value).Kind() == reflect.String {
+		return 0, fmt.Errorf("cannot convert %T to number", value)
+	}
+	return common.ToFloat(value)
+}
+
+func validateValue(path string, dt *DataType, value interface{}) []string {
+	if dt == nil {
+		return nil
+	}
+	switch dt.Type {
+	case DataType_Int, DataType_Float, DataType_Double:
+		num, err := toNumber(value)
+		if err != nil {
+			return []string{fmt.Sprintf("%s: expect %s, got %T", path, dt.Type, value)}
+		}
+		if dt.Type == DataType_Int && num != math.Trunc(num) {
+			return []string{fmt.Sprintf("%s: expect int, got %v", path, value)}
+		}
+		if dt.Min != nil && num < *dt.Min {
+			return []string{fmt.Sprintf("%s: %v is less than min %v", path, value, *dt.Min)}
+		}
+		if dt.Max != nil && num > *dt.Max {
+			return []string{fmt.Sprintf("%s: %v is greater than max %v", path, value, *dt.Max)}
+		}
+	case DataType_Bool:
+		switch v := value.(type) {
+		case bool:
+		default:
+			//兼容使用0和1表示的布尔值
+			num, err := toNumber(v)
+			if err != nil || (num != 0 && num != 1) {
+				return []string{fmt.Sprintf("%s: expect bool, got %v", path, value)}
+			}
+		}
+	case DataType_String:
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expect string, got %T", path, value)}
+		}
+		if dt.Length > 0 && len(str) > dt.Length {
+			return []string{fmt.Sprintf("%s: length %d exceeds %d", path, len(str), dt.Length)}
+		}
+	case DataType_Enum:
+		key := fmt.Sprint(value)
+		if _, ok := dt.Enum[key]; !ok {
+			return []string{fmt.Sprintf("%s: %v is not a valid enum value", path, value)}
+		}
+	case DataType_Date:
+		switch v := value.(type) {
+		case string:
+			//字符串只接受RFC3339格式，毫秒时间戳需要使用数值
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				return []string{fmt.Sprintf("%s: invalid date %q", path, v)}
+			}
+		default:
+			if _, err := toNumber(v); err != nil {
+				return []string{fmt.Sprintf("%s: expect date, got %T", path, value)}
+			}
+		}
+	case DataType_Struct:
+		params, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expect struct, got %T", path, value)}
+		}
+		return validateParams(path, dt.Specs, params)
+	case DataType_Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expect array, got %T", path, value)}
+		}
+		if dt.Length > 0 && len(items) > dt.Length {
+			return []string{fmt.Sprintf("%s: length %d exceeds %d", path, len(items), dt.Length)}
+		}
+		errs := make([]string, 0)
+		for i, item := range items {
+			errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", path, i), dt.Item, item)...)
+		}
+		return errs
+	default:
+		return []string{fmt.Sprintf("%s: unsupported data type %q", path, dt.Type)}
+	}
+	return nil
+}
+
@@ -0,0 +1,55 @@
+package thingmodel
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testModel = `{
+	"thingId": "iott-test",
+	"properties": [
+		{"identifier": "temperature", "dataType": {"type": "float", "min": -40, "max": 120, "unit": "C"}, "accessMode": "r"},
+		{"identifier": "mode", "dataType": {"type": "enum", "enum": {"0": "auto", "1": "manual"}}, "accessMode": "rw"}
+	],
+	"events": [
+		{"identifier": "overheat", "params": [{"identifier": "value", "dataType": {"type": "float"}, "required": true}]}
+	],
+	"services": [
+		{"identifier": "setTemperature", "input": [{"identifier": "temperature", "dataType": {"type": "int", "min": 0, "max": 50}, "required": true}], "output": []}
+	]
+}`
+
+func TestModel_Validate(t *testing.T) {
+	assert := assert.New(t)
+	m, err := Parse([]byte(testModel))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Nil(m.ValidateProperty("temperature", 25.5))
+	assert.Nil(m.ValidateProperty("mode", 1))
+	assert.NotNil(m.ValidateProperty("temprature", 25.5))
+	assert.NotNil(m.ValidateProperty("temperature", 200))
+	assert.NotNil(m.ValidateProperty("mode", 3))
+	assert.Nil(m.ValidateEvent("overheat", map[string]interface{}{"value": 90.0}))
+	assert.NotNil(m.ValidateEvent("overheat", map[string]interface{}{}))
+	assert.Nil(m.ValidateServiceInput("setTemperature", map[string]interface{}{"temperature": 35}))
+	err = m.ValidateServiceInput("setTemperature", map[string]interface{}{"temperature": 35.5, "speed": 1})
+	if assert.IsType(&ValidationError{}, err) {
+		assert.Len(err.(*ValidationError).Errors, 2)
+	}
+}
+
+//数值类型不接受字符串，只有json.Number按照数值处理
+func TestModel_ValidateNumberString(t *testing.T) {
+	assert := assert.New(t)
+	m, err := Parse([]byte(testModel))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.NotNil(m.ValidateServiceInput("setTemperature", map[string]interface{}{"temperature": "12"}))
+	assert.NotNil(m.ValidateProperty("temperature", "25.5"))
+	assert.Nil(m.ValidateServiceInput("setTemperature", map[string]interface{}{"temperature": json.Number("12")}))
+	assert.NotNil(m.ValidateServiceInput("setTemperature", map[string]interface{}{"temperature": json.Number("12.5")}))
+	assert.Nil(m.ValidateProperty("temperature", json.Number("25.5")))
+}
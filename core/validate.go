@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/thingmodel"
+)
+
+//设置物模型文件和校验模式，需要在Init之前调用，path为空时从metadata服务获取边设备的物模型
+func (c *AppCoreClient) SetThingModel(path string, mode common.ValidateMode) {
+	c.modelFile = path
+	c.validateMode = mode
+}
+
+//加载物模型，Strict模式下加载失败返回错误，Warn模式下只打印警告
+func (c *AppCoreClient) loadThingModel() error {
+	if c.validateMode == common.ValidateMode_None {
+		return nil
+	}
+	var model *thingmodel.Model
+	var err error
+	if c.modelFile != "" {
+		model, err = thingmodel.LoadFile(c.modelFile)
+	} else {
+		var data []byte
+		data, err = c.metaHandler.GetThingModel(c.cfg.ThingId)
+		if err == nil {
+			model, err = thingmodel.Parse(data)
+		}
+	}
+	if err != nil {
+		if c.validateMode == common.ValidateMode_Strict {
+			return errors.New("load thing model failed, err: " + err.Error())
+		}
+		fmt.Println("APP SDK load thing model failed, validation disabled, err: " + err.Error())
+		return nil
+	}
+	c.model = model
+	return nil
+}
+
+//根据物模型校验发送的属性、事件和服务调用回应
+func (c *AppCoreClient) validateOutgoing(msgType common.AppSdkMessageType, payload []byte) error {
+	if c.model == nil {
+		return nil
+	}
+	var err error
+	switch msgType {
+	case common.AppSdkMessageType_Property:
+		props := make([]*common.AppSdkMsgProperty, 0)
+		err = json.Unmarshal(payload, &props)
+		if err == nil {
+			errs := make([]string, 0)
+			for _, prop := range props {
+				errs = append(errs, validationErrors(c.model.ValidateProperty(prop.Identifier, prop.Value))...)
+				errs = append(errs, validationErrors(c.model.ValidateUnit(prop.Identifier, prop.Unit))...)
+			}
+			if len(errs) > 0 {
+				err = &thingmodel.ValidationError{Errors: errs}
+			}
+		}
+	case common.AppSdkMessageType_Event:
+		evt := &common.AppSdkMsgEvent{}
+		err = json.Unmarshal(payload, evt)
+		if err == nil {
+			err = c.model.ValidateEvent(evt.Identifier, evt.Params)
+		}
+	case common.AppSdkMessageType_ServiceReply:
+		reply := &common.AppSdkMsgServiceReply{}
+		err = json.Unmarshal(payload, reply)
+		if err == nil {
+			err = c.model.ValidateServiceOutput(reply.Identifier, reply.Params)
+		}
+	}
+	return c.checkValidation(err)
+}
+
+//根据物模型校验收到的服务调用输入参数
+func (c *AppCoreClient) validateServiceCall(ctx context.Context, data []byte) error {
+	if c.model == nil {
+		return nil
+	}
+	call := &common.AppSdkMsgServiceCall{}
+	err := json.Unmarshal(data, call)
+	if err == nil {
+		err = c.model.ValidateServiceInput(call.Identifier, call.Params)
+	}
+	err = c.checkValidation(err)
+	if err != nil {
+		//Strict模式下直接回应参数错误，回应中的message参数和未知的服务标识不在物模型中，不能再经过校验
+		reply := &common.AppSdkMsgServiceReply{
+			MessageId: call.MessageId,
+			Identifier: call.Identifier,
+			Code: 400,
+			Params: map[string]interface{}{
+				"message": err.Error(),
+			},
+		}
+		replyData, _ := json.Marshal(reply)
+		sendErr := c.sendMessage(ctx, common.AppSdkMessageType_ServiceReply, replyData, nil, false)
+		if sendErr != nil && !errors.Is(sendErr, common.ErrMessageDropped) {
+			fmt.Println("APP SDK reply invalid service call failed, err: " + sendErr.Error())
+		}
+	}
+	return err
+}
+
+//Warn模式下只打印校验错误，Strict模式下返回校验错误
+func (c *AppCoreClient) checkValidation(err error) error {
+	if err == nil {
+		return nil
+	}
+	if c.validateMode == common.ValidateMode_Strict {
+		return err
+	}
+	fmt.Println("APP SDK thing model validation warning: " + err.Error())
+	return nil
+}
+
+//展开校验错误中的全部内容，其他类型的错误作为一条内容返回
+func validationErrors(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var validationErr *thingmodel.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Errors
+	}
+	return []string{err.Error()}
+}
@@ -1,9 +1,11 @@
 package edge_app_go
 
 import (
+	"context"
 	"errors"
 	"github.com/qingcloud-iot/edge-app-go/common"
 	"github.com/qingcloud-iot/edge-app-go/core"
+	"time"
 )
 
 /*
@@ -16,7 +18,7 @@ type Options struct {
 	MessageCB   		common.AppSdkMessageCB
 	//模型消息回调处理函数的用户自定义参数
 	MessageParam  		interface{}
-	//SDK事件回调处理函数
+	//SDK事件回调处理函数，消息解码失败时回调EventType_DecodeError事件
 	EventCB				common.AppSdkEventCB
 	//SDK事件回调处理函数的用户自定义参数
 	EventParam    		interface{}
@@ -24,6 +26,24 @@ type Options struct {
 	ServiceIds			[]string
 	//订阅子设备消息模型ID数组,只有在非Proxy模式下才生效
 	EndpointThingIds 	[]string
+	//按设备id和属性/事件标识id过滤的子设备订阅条件,只有在非Proxy模式下才生效
+	EndpointFilters 	[]*common.EndpointFilter
+	//设备影子持久化文件路径，为空时设备影子只保存在内存中
+	ShadowFile 			string
+	//设备影子差异回调处理函数，收到属性设置或者重连成功后，期望值与上报值不一致时回调
+	ShadowDeltaCB 		common.AppSdkShadowDeltaCB
+	//设备影子上报值持久化的最短间隔，间隔内的多次上报只写入一次文件，为0时默认1秒，小于0时每次上报都写入文件
+	ShadowSaveInterval 	time.Duration
+	//边设备事件的最低级别，低于此级别的事件不会回调，为空时不过滤；子设备事件通过EndpointFilter.MinEventLevel过滤
+	MinEventLevel 		common.EventLevel
+	//物模型校验模式，默认不校验
+	ValidateMode 		common.ValidateMode
+	//物模型JSON文件路径，为空并且启用校验时从metadata服务获取边设备的物模型
+	ThingModelFile 		string
+	//消息录制文件路径，设置后将收到和发送的模型消息追加写入JSONL文件，可以通过record包回放
+	RecordFile 			string
+	//消息拦截器，收到的消息在回调之前、发送的消息在编码之前按照顺序执行，可以检查、修改或者丢弃消息
+	Interceptors 		[]common.AppSdkInterceptor
 }
 
 /*
@@ -38,14 +58,66 @@ type Client interface {
 	Start() error
 	//停止SDK
 	Stop()
-	//发送消息
+	//发送消息，消息被拦截器丢弃时返回包含common.ErrMessageDropped的错误，可以通过errors.Is判断
 	SendMessage(msgType common.AppSdkMessageType, payload []byte) error
+	//发送消息并设置元信息，如属性和事件消息的设备源，消息被拦截器丢弃时与SendMessage相同
+	SendMessageWithMeta(msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error
 	//获取边设备信息
 	GetEdgeDeviceInfo() (*common.EdgeLocalInfo, error)
 	//获取子设备信息列表
 	GetEndpointInfos() ([]*common.EndpointInfo, error)
-	//调用子设备服务调用
+	//调用子设备服务调用，调用被拦截器丢弃时返回包含common.ErrMessageDropped的错误
 	CallEndpoint(thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error)
+	//订阅子设备模型消息，只有在非Proxy模式下才生效，断线重连后自动恢复
+	SubscribeEndpoints(thingIds ...string) error
+	//按过滤条件订阅子设备模型消息，只有在非Proxy模式下才生效，断线重连后自动恢复
+	SubscribeEndpointFilters(filters ...*common.EndpointFilter) error
+	//取消订阅子设备模型消息
+	UnsubscribeEndpoints(thingIds ...string) error
+	//订阅边设备服务调用，断线重连后自动恢复
+	AddServices(serviceIds ...string) error
+	//取消订阅边设备服务调用
+	RemoveServices(serviceIds ...string) error
+	//注册属性设置处理函数，注册后SDK根据处理结果自动回应属性设置，否则通过MessageCB回调AppSdkMessageType_PropertySet消息
+	OnPropertySet(handler common.AppSdkPropertySetHandler)
+	//按照模型id、设备id和属性标识id注册属性消息处理函数，支持通配符"*"，没有匹配的属性回调MessageCB
+	OnProperty(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler)
+	//按照模型id、设备id和事件标识id注册事件消息处理函数，支持通配符"*"，没有匹配的事件回调MessageCB
+	OnEvent(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler)
+	//按照模型id、设备id和服务标识id注册服务调用处理函数，支持通配符"*"，没有匹配的服务调用回调MessageCB
+	OnServiceCall(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler)
+	//获取设备影子中最后上报的属性值
+	GetReported() []*common.AppSdkMsgProperty
+	//获取设备影子中平台期望设置的属性值
+	GetDesired() []*common.AppSdkMsgProperty
+	//获取设备影子中期望值与上报值不一致的属性
+	GetDelta() []*common.AppSdkMsgProperty
+	//发布原始mqtt消息，不经过模型消息编码
+	PublishRaw(topic string, qos int32, retain bool, payload []byte) error
+	//订阅原始mqtt消息，支持通配符，消息不回调MessageCB，断线重连后自动恢复
+	SubscribeRaw(filter string, handler common.AppSdkRawMessageCB) error
+	//取消订阅原始mqtt消息
+	UnsubscribeRaw(filter string) error
+	//获取模型消息接收统计，包括解码失败和无法识别类型的消息数
+	GetMessageStats() *common.AppSdkMessageStats
+	//启动SDK并等待第一次连接成功，ctx取消或者超时时停止连接并返回AppSdkContextError
+	StartContext(ctx context.Context) error
+	//发送消息，ctx传递给消息拦截器，ctx取消或者超时时返回AppSdkContextError
+	SendMessageContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte) error
+	//获取子设备信息列表，ctx取消或者超时时中断请求并返回AppSdkContextError
+	GetEndpointInfosContext(ctx context.Context) ([]*common.EndpointInfo, error)
+	//调用子设备服务调用，ctx设置了截止时间时替代默认的5秒超时，ctx取消或者超时时返回AppSdkContextError
+	CallEndpointContext(ctx context.Context, thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error)
+	//发送消息并设置元信息，ctx传递给消息拦截器，ctx取消或者超时时返回AppSdkContextError
+	SendMessageWithMetaContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error
+	//注册带context的属性设置处理函数，ctx在处理完成或者SDK停止时取消
+	OnPropertySetContext(handler common.AppSdkPropertySetHandlerContext)
+	//注册带context的属性消息处理函数，ctx在处理完成或者SDK停止时取消
+	OnPropertyContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext)
+	//注册带context的事件消息处理函数，ctx在处理完成或者SDK停止时取消
+	OnEventContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext)
+	//注册带context的服务调用处理函数，ctx在处理完成或者SDK停止时取消
+	OnServiceCallContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext)
 }
 
 func NewClient(opt *Options) (Client, error) {
@@ -54,5 +126,18 @@ func NewClient(opt *Options) (Client, error) {
 	}
 	obj := core.NewAppCoreClient(opt.Type, opt.MessageCB, opt.MessageParam,
 		opt.EventCB, opt.EventParam, opt.ServiceIds, opt.EndpointThingIds)
+	obj.SetShadow(opt.ShadowFile, opt.ShadowDeltaCB)
+	obj.SetShadowSaveInterval(opt.ShadowSaveInterval)
+	obj.SetMinEventLevel(opt.MinEventLevel)
+	obj.SetThingModel(opt.ThingModelFile, opt.ValidateMode)
+	obj.SetRecordFile(opt.RecordFile)
+	obj.SetInterceptors(opt.Interceptors)
+	if len(opt.EndpointFilters) > 0 {
+		//未初始化时只记录订阅条件，连接成功后再订阅
+		err := obj.SubscribeEndpointFilters(opt.EndpointFilters...)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return obj, nil
 }
@@ -0,0 +1,236 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+//解析属性消息
+func (m *SentMessage) Properties() ([]*common.AppSdkMsgProperty, error) {
+	props := make([]*common.AppSdkMsgProperty, 0)
+	err := m.unmarshal(common.AppSdkMessageType_Property, &props)
+	if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+//解析事件消息
+func (m *SentMessage) Event() (*common.AppSdkMsgEvent, error) {
+	evt := &common.AppSdkMsgEvent{}
+	err := m.unmarshal(common.AppSdkMessageType_Event, evt)
+	if err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+//解析服务调用回应消息
+func (m *SentMessage) ServiceReply() (*common.AppSdkMsgServiceReply, error) {
+	reply := &common.AppSdkMsgServiceReply{}
+	err := m.unmarshal(common.AppSdkMessageType_ServiceReply, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+//解析属性设置回应消息
+func (m *SentMessage) PropertySetReply() (*common.AppSdkMsgPropertySetReply, error) {
+	reply := &common.AppSdkMsgPropertySetReply{}
+	err := m.unmarshal(common.AppSdkMessageType_PropertySetReply, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (m *SentMessage) unmarshal(msgType common.AppSdkMessageType, v interface{}) error {
+	if m.Type != msgType {
+		return fmt.Errorf("message type is %d, not %d", m.Type, msgType)
+	}
+	return json.Unmarshal(m.Payload, v)
+}
+
+//返回全部发送的消息
+func (c *Client) Sent() []*SentMessage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*SentMessage{}, c.sent...)
+}
+
+//返回指定类型的发送消息
+func (c *Client) SentOf(msgType common.AppSdkMessageType) []*SentMessage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	result := make([]*SentMessage, 0)
+	for _, msg := range c.sent {
+		if msg.Type == msgType {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+//返回全部子设备服务调用
+func (c *Client) Calls() []*EndpointCall {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*EndpointCall{}, c.calls...)
+}
+
+//返回全部发布的原始mqtt消息
+func (c *Client) RawPublished() []*RawMessage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*RawMessage{}, c.raws...)
+}
+
+//清除发送消息、服务调用和原始消息的记录
+func (c *Client) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sent = make([]*SentMessage, 0)
+	c.calls = make([]*EndpointCall, 0)
+	c.raws = make([]*RawMessage, 0)
+}
+
+//返回订阅的边设备服务调用id，按照字典序排列
+func (c *Client) Services() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return sortedKeys(c.services)
+}
+
+//返回订阅的子设备模型id，按照字典序排列
+func (c *Client) EndpointThingIds() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return sortedKeys(c.thingIds)
+}
+
+//返回订阅的子设备过滤条件
+func (c *Client) EndpointFilters() []*common.EndpointFilter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*common.EndpointFilter{}, c.filters...)
+}
+
+/*
+	断言方法，失败时通过t.Errorf报告，不会中止测试
+*/
+
+//断言发送过指定类型的消息，返回最后一条
+func (c *Client) AssertSent(t testing.TB, msgType common.AppSdkMessageType) *SentMessage {
+	t.Helper()
+	msgs := c.SentOf(msgType)
+	if len(msgs) == 0 {
+		t.Errorf("mock: expected message of type %d to be sent, but it was not", msgType)
+		return nil
+	}
+	return msgs[len(msgs)-1]
+}
+
+//断言没有发送过指定类型的消息
+func (c *Client) AssertNotSent(t testing.TB, msgType common.AppSdkMessageType) bool {
+	t.Helper()
+	msgs := c.SentOf(msgType)
+	if len(msgs) > 0 {
+		t.Errorf("mock: expected no message of type %d, but %d sent", msgType, len(msgs))
+		return false
+	}
+	return true
+}
+
+/*
+	断言最后一次上报的属性identifier的值为value，值按照JSON序列化后的结果比较，因此数字类型不需要完全一致
+*/
+func (c *Client) AssertSentProperty(t testing.TB, identifier string, value interface{}) bool {
+	t.Helper()
+	msgs := c.SentOf(common.AppSdkMessageType_Property)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		props, err := msgs[i].Properties()
+		if err != nil {
+			continue
+		}
+		for j := len(props) - 1; j >= 0; j-- {
+			if props[j].Identifier != identifier {
+				continue
+			}
+			if !jsonEqual(props[j].Value, value) {
+				t.Errorf("mock: property %s expected %v, actual %v", identifier, value, props[j].Value)
+				return false
+			}
+			return true
+		}
+	}
+	t.Errorf("mock: expected property %s to be sent, but it was not", identifier)
+	return false
+}
+
+//断言发送过标识为identifier的事件，返回最后一条
+func (c *Client) AssertSentEvent(t testing.TB, identifier string) *common.AppSdkMsgEvent {
+	t.Helper()
+	msgs := c.SentOf(common.AppSdkMessageType_Event)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		evt, err := msgs[i].Event()
+		if err == nil && evt.Identifier == identifier {
+			return evt
+		}
+	}
+	t.Errorf("mock: expected event %s to be sent, but it was not", identifier)
+	return nil
+}
+
+//断言回应过messageId的服务调用，返回回应内容
+func (c *Client) AssertServiceReplied(t testing.TB, messageId string) *common.AppSdkMsgServiceReply {
+	t.Helper()
+	for _, msg := range c.SentOf(common.AppSdkMessageType_ServiceReply) {
+		reply, err := msg.ServiceReply()
+		if err == nil && reply.MessageId == messageId {
+			return reply
+		}
+	}
+	t.Errorf("mock: expected service call %s to be replied, but it was not", messageId)
+	return nil
+}
+
+//断言调用过子设备服务，返回最后一次调用
+func (c *Client) AssertCalled(t testing.TB, thingId string, deviceId string, identifier string) *EndpointCall {
+	t.Helper()
+	calls := c.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		call := calls[i]
+		if call.ThingId == thingId && call.DeviceId == deviceId && call.Request.Identifier == identifier {
+			return call
+		}
+	}
+	t.Errorf("mock: expected endpoint %s/%s service %s to be called, but it was not", thingId, deviceId, identifier)
+	return nil
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	var valueA, valueB interface{}
+	if json.Unmarshal(dataA, &valueA) != nil || json.Unmarshal(dataB, &valueB) != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	result := make([]string, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,639 @@
+/*
+	mock提供edge_app_go.Client接口的模拟实现，用于应用的单元测试：
+	记录发送的消息和服务调用，可以预设子设备列表、服务调用回应和接口错误，
+	并且可以向注册的MessageCB和EventCB回调模拟收到的消息和事件
+*/
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/mqtt"
+	"github.com/qingcloud-iot/edge-app-go/core/router"
+	"github.com/satori/go.uuid"
+	"strings"
+	"sync"
+)
+
+var _ edge_app_go.Client = (*Client)(nil)
+
+//没有预设回应的服务调用返回的错误
+var ErrNoReply = errors.New("mock: no reply for endpoint call")
+
+//服务调用处理函数，用于根据请求动态生成回应
+type CallHandler func(thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error)
+
+/*
+	发送的消息记录
+*/
+type SentMessage struct {
+	//消息类型
+	Type 		common.AppSdkMessageType
+	//消息内容，格式与SendMessage的payload相同
+	Payload 	[]byte
+	//消息元信息，通过SendMessage发送时为nil
+	Meta 		*common.AppSdkMessageMeta
+}
+
+/*
+	子设备服务调用记录
+*/
+type EndpointCall struct {
+	ThingId 	string
+	DeviceId 	string
+	Request 	*common.AppSdkMsgServiceCall
+}
+
+/*
+	原始mqtt消息发布记录
+*/
+type RawMessage struct {
+	Topic 		string
+	Qos 		int32
+	Retain 		bool
+	Payload 	[]byte
+}
+
+//预设的服务调用回应
+type callReply struct {
+	reply 		*common.AppSdkMsgServiceReply
+	err 		error
+}
+
+type Client struct {
+	opt 			edge_app_go.Options
+	info 			*common.EdgeLocalInfo
+
+	lock 			sync.Mutex
+	inited 			bool
+	started 		bool
+	//接口方法名与预设错误的对应关系
+	errs 			map[string]error
+	sent 			[]*SentMessage
+	calls 			[]*EndpointCall
+	raws 			[]*RawMessage
+	endpoints 		[]*common.EndpointInfo
+	//key为thingId/deviceId/identifier
+	replies 		map[string]*callReply
+	callCB 			CallHandler
+	services 		map[string]struct{}
+	thingIds 		map[string]struct{}
+	filters 		[]*common.EndpointFilter
+	rawCBs 			map[string]common.AppSdkRawMessageCB
+	propertySetCB 	common.AppSdkPropertySetHandlerContext
+	router 			*router.Router
+	reported 		[]*common.AppSdkMsgProperty
+	desired 		[]*common.AppSdkMsgProperty
+	delta 			[]*common.AppSdkMsgProperty
+	stats 			common.AppSdkMessageStats
+}
+
+/*
+	创建模拟的SDK客户端，opt中的MessageCB、EventCB、ServiceIds、EndpointThingIds和EndpointFilters生效，
+	边设备信息默认为app-mock、iott-mock和iotd-mock，可以通过SetEdgeDeviceInfo修改
+*/
+func NewClient(opt *edge_app_go.Options) *Client {
+	c := &Client{
+		info: &common.EdgeLocalInfo{
+			AppId: "app-mock",
+			ThingId: "iott-mock",
+			DeviceId: "iotd-mock",
+		},
+		errs: make(map[string]error),
+		sent: make([]*SentMessage, 0),
+		calls: make([]*EndpointCall, 0),
+		raws: make([]*RawMessage, 0),
+		endpoints: make([]*common.EndpointInfo, 0),
+		replies: make(map[string]*callReply),
+		services: make(map[string]struct{}),
+		thingIds: make(map[string]struct{}),
+		filters: make([]*common.EndpointFilter, 0),
+		rawCBs: make(map[string]common.AppSdkRawMessageCB),
+		router: router.NewRouter(),
+	}
+	if opt != nil {
+		c.opt = *opt
+		for _, id := range opt.ServiceIds {
+			c.services[id] = struct{}{}
+		}
+		for _, id := range opt.EndpointThingIds {
+			c.thingIds[id] = struct{}{}
+		}
+		c.filters = append(c.filters, opt.EndpointFilters...)
+	}
+	return c
+}
+
+/*
+	预设方法返回的错误，method为Client接口的方法名，如"SendMessage"、"CallEndpoint"，err为nil时清除
+*/
+func (c *Client) SetError(method string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		delete(c.errs, method)
+		return
+	}
+	c.errs[method] = err
+}
+
+//设置GetEdgeDeviceInfo返回的边设备信息，模拟消息默认使用该边设备的模型id和设备id
+func (c *Client) SetEdgeDeviceInfo(info *common.EdgeLocalInfo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.info = info
+}
+
+//设置GetEndpointInfos返回的子设备列表
+func (c *Client) SetEndpointInfos(infos ...*common.EndpointInfo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.endpoints = append([]*common.EndpointInfo{}, infos...)
+}
+
+//预设子设备服务调用的回应，回应的MessageId和Identifier为空时使用请求的值
+func (c *Client) SetCallReply(thingId string, deviceId string, identifier string, reply *common.AppSdkMsgServiceReply, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replies[callKey(thingId, deviceId, identifier)] = &callReply{reply: reply, err: err}
+}
+
+//设置子设备服务调用处理函数，没有匹配的预设回应时调用
+func (c *Client) OnCallEndpoint(handler CallHandler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.callCB = handler
+}
+
+//设置设备影子的上报值、期望值和差异
+func (c *Client) SetShadow(reported []*common.AppSdkMsgProperty, desired []*common.AppSdkMsgProperty, delta []*common.AppSdkMsgProperty) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reported = reported
+	c.desired = desired
+	c.delta = delta
+}
+
+func (c *Client) Init() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["Init"]; err != nil {
+		return err
+	}
+	c.inited = true
+	return nil
+}
+
+func (c *Client) Cleanup() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.inited = false
+	c.started = false
+}
+
+func (c *Client) Start() error {
+	c.lock.Lock()
+	if err := c.errs["Start"]; err != nil {
+		c.lock.Unlock()
+		return err
+	}
+	if !c.inited {
+		c.lock.Unlock()
+		return errors.New("APP SDK start failed, err: not init")
+	}
+	c.started = true
+	c.lock.Unlock()
+	c.EmitSdkEvent(common.EventType_Connected, nil)
+	return nil
+}
+
+func (c *Client) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.started = false
+}
+
+//是否已经调用Start启动
+func (c *Client) Started() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.started
+}
+
+func (c *Client) SendMessage(msgType common.AppSdkMessageType, payload []byte) error {
+	return c.SendMessageWithMeta(msgType, payload, nil)
+}
+
+func (c *Client) SendMessageWithMeta(msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["SendMessageWithMeta"]; err != nil {
+		return err
+	}
+	if err := c.errs["SendMessage"]; err != nil && meta == nil {
+		return err
+	}
+	if payload == nil {
+		return errors.New("APP SDK send message failed, err: invalid arguments")
+	}
+	c.sent = append(c.sent, &SentMessage{
+		Type: msgType,
+		Payload: append([]byte{}, payload...),
+		Meta: meta,
+	})
+	return nil
+}
+
+func (c *Client) GetEdgeDeviceInfo() (*common.EdgeLocalInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["GetEdgeDeviceInfo"]; err != nil {
+		return nil, err
+	}
+	info := *c.info
+	return &info, nil
+}
+
+func (c *Client) GetEndpointInfos() ([]*common.EndpointInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["GetEndpointInfos"]; err != nil {
+		return nil, err
+	}
+	return append([]*common.EndpointInfo{}, c.endpoints...), nil
+}
+
+/*
+	记录服务调用，按照预设回应、CallHandler的顺序生成回应，都没有时返回ErrNoReply
+*/
+func (c *Client) CallEndpoint(thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error) {
+	if thingId == "" || deviceId == "" || req == nil || req.Identifier == "" {
+		return nil, errors.New("APP SDK CallEndpoint failed, err: invalid arguments")
+	}
+	if req.MessageId == "" {
+		req.MessageId = uuid.NewV1().String()
+	}
+	c.lock.Lock()
+	c.calls = append(c.calls, &EndpointCall{
+		ThingId: thingId,
+		DeviceId: deviceId,
+		Request: req,
+	})
+	err := c.errs["CallEndpoint"]
+	scripted, ok := c.replies[callKey(thingId, deviceId, req.Identifier)]
+	handler := c.callCB
+	c.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var reply *common.AppSdkMsgServiceReply
+	switch {
+	case ok:
+		if scripted.err != nil {
+			return nil, scripted.err
+		}
+		if scripted.reply != nil {
+			value := *scripted.reply
+			reply = &value
+		}
+	case handler != nil:
+		reply, err = handler(thingId, deviceId, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if reply == nil {
+		return nil, ErrNoReply
+	}
+	if reply.MessageId == "" {
+		reply.MessageId = req.MessageId
+	}
+	if reply.Identifier == "" {
+		reply.Identifier = req.Identifier
+	}
+	return reply, nil
+}
+
+func (c *Client) SubscribeEndpoints(thingIds ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["SubscribeEndpoints"]; err != nil {
+		return err
+	}
+	for _, id := range thingIds {
+		c.thingIds[id] = struct{}{}
+	}
+	return nil
+}
+
+func (c *Client) SubscribeEndpointFilters(filters ...*common.EndpointFilter) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["SubscribeEndpointFilters"]; err != nil {
+		return err
+	}
+	c.filters = append(c.filters, filters...)
+	return nil
+}
+
+func (c *Client) UnsubscribeEndpoints(thingIds ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["UnsubscribeEndpoints"]; err != nil {
+		return err
+	}
+	for _, id := range thingIds {
+		delete(c.thingIds, id)
+	}
+	return nil
+}
+
+func (c *Client) AddServices(serviceIds ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["AddServices"]; err != nil {
+		return err
+	}
+	for _, id := range serviceIds {
+		c.services[id] = struct{}{}
+	}
+	return nil
+}
+
+func (c *Client) RemoveServices(serviceIds ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["RemoveServices"]; err != nil {
+		return err
+	}
+	for _, id := range serviceIds {
+		delete(c.services, id)
+	}
+	return nil
+}
+
+func (c *Client) OnPropertySet(handler common.AppSdkPropertySetHandler) {
+	var temp common.AppSdkPropertySetHandlerContext
+	if handler != nil {
+		temp = func(ctx context.Context, props []*common.AppSdkMsgProperty) error {
+			return handler(props)
+		}
+	}
+	c.OnPropertySetContext(temp)
+}
+
+func (c *Client) OnPropertySetContext(handler common.AppSdkPropertySetHandlerContext) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.propertySetCB = handler
+}
+
+func (c *Client) OnProperty(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_Property, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) OnEvent(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_Event, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) OnServiceCall(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandler) {
+	c.router.Handle(common.AppSdkMessageType_ServiceCall, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) OnPropertyContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_Property, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) OnEventContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_Event, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) OnServiceCallContext(thingId string, deviceId string, identifier string, handler common.AppSdkMessageHandlerContext) {
+	c.router.HandleContext(common.AppSdkMessageType_ServiceCall, thingId, deviceId, identifier, handler)
+}
+
+func (c *Client) GetReported() []*common.AppSdkMsgProperty {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*common.AppSdkMsgProperty{}, c.reported...)
+}
+
+func (c *Client) GetDesired() []*common.AppSdkMsgProperty {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*common.AppSdkMsgProperty{}, c.desired...)
+}
+
+func (c *Client) GetDelta() []*common.AppSdkMsgProperty {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*common.AppSdkMsgProperty{}, c.delta...)
+}
+
+func (c *Client) PublishRaw(topic string, qos int32, retain bool, payload []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["PublishRaw"]; err != nil {
+		return err
+	}
+	if topic == "" || strings.ContainsAny(topic, "+#") || qos < 0 || qos > 2 {
+		return errors.New("APP SDK PublishRaw failed, err: invalid arguments")
+	}
+	c.raws = append(c.raws, &RawMessage{
+		Topic: topic,
+		Qos: qos,
+		Retain: retain,
+		Payload: append([]byte{}, payload...),
+	})
+	return nil
+}
+
+func (c *Client) SubscribeRaw(filter string, handler common.AppSdkRawMessageCB) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["SubscribeRaw"]; err != nil {
+		return err
+	}
+	if filter == "" || handler == nil {
+		return errors.New("APP SDK SubscribeRaw failed, err: invalid arguments")
+	}
+	c.rawCBs[filter] = handler
+	return nil
+}
+
+func (c *Client) UnsubscribeRaw(filter string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := c.errs["UnsubscribeRaw"]; err != nil {
+		return err
+	}
+	delete(c.rawCBs, filter)
+	return nil
+}
+
+//Received为模拟收到的模型消息数量
+func (c *Client) GetMessageStats() *common.AppSdkMessageStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.stats
+	return &stats
+}
+
+//ctx已经取消或者超时时返回AppSdkContextError，否则与Start相同
+func (c *Client) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &common.AppSdkContextError{Op: "Start", Err: err}
+	}
+	return c.Start()
+}
+
+//ctx已经取消或者超时时返回AppSdkContextError，否则与SendMessage相同
+func (c *Client) SendMessageContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return &common.AppSdkContextError{Op: "SendMessage", Err: err}
+	}
+	return c.SendMessage(msgType, payload)
+}
+
+//ctx已经取消或者超时时返回AppSdkContextError，否则与SendMessageWithMeta相同
+func (c *Client) SendMessageWithMetaContext(ctx context.Context, msgType common.AppSdkMessageType, payload []byte, meta *common.AppSdkMessageMeta) error {
+	if err := ctx.Err(); err != nil {
+		return &common.AppSdkContextError{Op: "SendMessage", Err: err}
+	}
+	return c.SendMessageWithMeta(msgType, payload, meta)
+}
+
+//ctx已经取消或者超时时返回AppSdkContextError，否则与GetEndpointInfos相同
+func (c *Client) GetEndpointInfosContext(ctx context.Context) ([]*common.EndpointInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &common.AppSdkContextError{Op: "GetEndpointInfos", Err: err}
+	}
+	return c.GetEndpointInfos()
+}
+
+//ctx已经取消或者超时时返回AppSdkContextError，否则与CallEndpoint相同
+func (c *Client) CallEndpointContext(ctx context.Context, thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &common.AppSdkContextError{Op: "CallEndpoint", Err: err}
+	}
+	return c.CallEndpoint(thingId, deviceId, req)
+}
+
+/*
+	模拟收到模型消息，按照OnProperty、OnEvent和OnServiceCall注册的处理函数分发，没有匹配时回调MessageCB，
+	ThingId和DeviceId为空时使用边设备的id；处理函数的ctx为context.Background()
+*/
+func (c *Client) EmitMessage(data *common.AppSdkMessageData) {
+	c.lock.Lock()
+	c.stats.Received++
+	if data.ThingId == "" && data.DeviceId == "" {
+		data.ThingId, data.DeviceId = c.info.ThingId, c.info.DeviceId
+	}
+	c.lock.Unlock()
+	for _, target := range c.router.Route(data) {
+		if target.Handler != nil {
+			target.Handler(context.Background(), target.Message)
+		} else if c.opt.MessageCB != nil {
+			c.opt.MessageCB(target.Message, c.opt.MessageParam)
+		}
+	}
+}
+
+//模拟收到属性消息，thingId和deviceId为空时为边设备属性
+func (c *Client) EmitProperties(thingId string, deviceId string, props ...*common.AppSdkMsgProperty) error {
+	return c.emit(common.AppSdkMessageType_Property, thingId, deviceId, props)
+}
+
+//模拟收到事件消息，thingId和deviceId为空时为边设备事件
+func (c *Client) EmitEvent(thingId string, deviceId string, evt *common.AppSdkMsgEvent) error {
+	return c.emit(common.AppSdkMessageType_Event, thingId, deviceId, evt)
+}
+
+//模拟收到边设备服务调用，MessageId为空时自动生成
+func (c *Client) EmitServiceCall(call *common.AppSdkMsgServiceCall) error {
+	if call == nil {
+		return errors.New("invalid arguments")
+	}
+	if call.MessageId == "" {
+		call.MessageId = uuid.NewV1().String()
+	}
+	return c.emit(common.AppSdkMessageType_ServiceCall, "", "", call)
+}
+
+/*
+	模拟收到属性设置消息，返回消息id；与SDK相同，注册了OnPropertySet处理函数时
+	根据处理结果记录属性设置回应消息，否则回调MessageCB
+*/
+func (c *Client) EmitPropertySet(props ...*common.AppSdkMsgProperty) (string, error) {
+	set := &common.AppSdkMsgPropertySet{
+		MessageId: uuid.NewV1().String(),
+		Properties: props,
+	}
+	c.lock.Lock()
+	handler := c.propertySetCB
+	c.lock.Unlock()
+	if handler == nil {
+		return set.MessageId, c.emit(common.AppSdkMessageType_PropertySet, "", "", set)
+	}
+	c.lock.Lock()
+	c.stats.Received++
+	c.lock.Unlock()
+	reply := &common.AppSdkMsgPropertySetReply{
+		MessageId: set.MessageId,
+		Code: 200,
+	}
+	err := handler(context.Background(), props)
+	if err != nil {
+		reply.Code = 500
+		reply.Message = err.Error()
+	}
+	data, _ := json.Marshal(reply)
+	return set.MessageId, c.SendMessage(common.AppSdkMessageType_PropertySetReply, data)
+}
+
+//模拟收到原始mqtt消息，回调全部匹配topic的SubscribeRaw处理函数
+func (c *Client) EmitRaw(topic string, payload []byte) {
+	c.lock.Lock()
+	handlers := make([]common.AppSdkRawMessageCB, 0)
+	for filter, handler := range c.rawCBs {
+		if mqtt.TopicMatch(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.lock.Unlock()
+	for _, handler := range handlers {
+		handler(topic, payload)
+	}
+}
+
+//模拟SDK事件，回调EventCB
+func (c *Client) EmitSdkEvent(evtType common.EventType, payload interface{}) {
+	if c.opt.EventCB == nil {
+		return
+	}
+	c.opt.EventCB(&common.AppSdkEventData{
+		Type: evtType,
+		Payload: payload,
+	}, c.opt.EventParam)
+}
+
+func (c *Client) emit(msgType common.AppSdkMessageType, thingId string, deviceId string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.EmitMessage(&common.AppSdkMessageData{
+		Type: msgType,
+		ThingId: thingId,
+		DeviceId: deviceId,
+		Payload: data,
+	})
+	return nil
+}
+
+func callKey(thingId string, deviceId string, identifier string) string {
+	return thingId + "/" + deviceId + "/" + identifier
+}
@@ -0,0 +1,218 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+//记录断言失败次数，用于检查断言方法本身
+type recordTB struct {
+	testing.TB
+	failed 	int
+}
+
+func (r *recordTB) Helper() {}
+
+func (r *recordTB) Errorf(format string, args ...interface{}) {
+	r.failed++
+}
+
+func TestClient_Send(t *testing.T) {
+	assert := assert.New(t)
+	events := make([]common.EventType, 0)
+	c := NewClient(&edge_app_go.Options{
+		EventCB: func(evt *common.AppSdkEventData, arg interface{}) {
+			events = append(events, evt.Type)
+		},
+		ServiceIds: []string{"reboot"},
+	})
+	assert.NotNil(c.Start())
+	assert.Nil(c.Init())
+	assert.Nil(c.Start())
+	assert.Equal([]common.EventType{common.EventType_Connected}, events)
+
+	assert.Nil(c.SendMessage(common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":1,"value":25}]`)))
+	assert.Nil(c.SendMessage(common.AppSdkMessageType_Event, []byte(`{"identifier":"alarm","timestamp":1,"params":{}}`)))
+	c.AssertSent(t, common.AppSdkMessageType_Property)
+	c.AssertSentProperty(t, "temp", 25.0)
+	c.AssertSentEvent(t, "alarm")
+	c.AssertNotSent(t, common.AppSdkMessageType_ServiceReply)
+
+	r := &recordTB{TB: t}
+	c.AssertSentProperty(r, "temp", 26)
+	c.AssertSentProperty(r, "humi", 50)
+	c.AssertSent(r, common.AppSdkMessageType_ServiceReply)
+	assert.Equal(3, r.failed)
+
+	sendErr := errors.New("send failed")
+	c.SetError("SendMessage", sendErr)
+	assert.Equal(sendErr, c.SendMessage(common.AppSdkMessageType_Property, []byte(`[]`)))
+	c.SetError("SendMessage", nil)
+	c.Reset()
+	assert.Len(c.Sent(), 0)
+	assert.Equal([]string{"reboot"}, c.Services())
+}
+
+func TestClient_CallEndpoint(t *testing.T) {
+	assert := assert.New(t)
+	c := NewClient(nil)
+	c.SetEndpointInfos(&common.EndpointInfo{ThingId: "iott-sub", DeviceId: "iotd-sub"})
+	infos, err := c.GetEndpointInfos()
+	if assert.Nil(err) {
+		assert.Len(infos, 1)
+	}
+	metaErr := errors.New("metadata unavailable")
+	c.SetError("GetEndpointInfos", metaErr)
+	_, err = c.GetEndpointInfos()
+	assert.Equal(metaErr, err)
+
+	c.SetCallReply("iott-sub", "iotd-sub", "open", &common.AppSdkMsgServiceReply{Code: 200}, nil)
+	reply, err := c.CallEndpoint("iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	if assert.Nil(err) {
+		assert.Equal("open", reply.Identifier)
+		assert.EqualValues(200, reply.Code)
+		assert.NotEmpty(reply.MessageId)
+	}
+	_, err = c.CallEndpoint("iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "close"})
+	assert.Equal(ErrNoReply, err)
+	c.OnCallEndpoint(func(thingId string, deviceId string, req *common.AppSdkMsgServiceCall) (*common.AppSdkMsgServiceReply, error) {
+		return nil, errors.New("offline")
+	})
+	_, err = c.CallEndpoint("iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "close"})
+	assert.EqualError(err, "offline")
+	call := c.AssertCalled(t, "iott-sub", "iotd-sub", "close")
+	if assert.NotNil(call) {
+		assert.Equal("close", call.Request.Identifier)
+	}
+	assert.Len(c.Calls(), 3)
+}
+
+func TestClient_Emit(t *testing.T) {
+	assert := assert.New(t)
+	msgs := make([]*common.AppSdkMessageData, 0)
+	c := NewClient(&edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgs = append(msgs, data)
+			if data.Type == common.AppSdkMessageType_ServiceCall {
+				call := &common.AppSdkMsgServiceCall{}
+				json.Unmarshal(data.Payload, call)
+				reply, _ := json.Marshal(&common.AppSdkMsgServiceReply{MessageId: call.MessageId, Identifier: call.Identifier, Code: 200})
+				arg.(*Client).SendMessage(common.AppSdkMessageType_ServiceReply, reply)
+			}
+		},
+	})
+	c.opt.MessageParam = c
+	assert.Nil(c.EmitProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 1}))
+	call := &common.AppSdkMsgServiceCall{Identifier: "reboot"}
+	assert.Nil(c.EmitServiceCall(call))
+	if assert.Len(msgs, 2) {
+		assert.Equal("iotd-sub", msgs[0].DeviceId)
+		assert.Equal("iotd-mock", msgs[1].DeviceId)
+	}
+	c.AssertServiceReplied(t, call.MessageId)
+
+	//注册属性设置处理函数后自动回应
+	c.OnPropertySet(func(props []*common.AppSdkMsgProperty) error {
+		return errors.New("read only")
+	})
+	messageId, err := c.EmitPropertySet(&common.AppSdkMsgProperty{Identifier: "switch", Value: true})
+	assert.Nil(err)
+	reply, err := c.AssertSent(t, common.AppSdkMessageType_PropertySetReply).PropertySetReply()
+	if assert.Nil(err) {
+		assert.Equal(messageId, reply.MessageId)
+		assert.EqualValues(500, reply.Code)
+	}
+	assert.EqualValues(3, c.GetMessageStats().Received)
+
+	raws := make([]string, 0)
+	assert.Nil(c.SubscribeRaw("vendor/+/status", func(topic string, payload []byte) {
+		raws = append(raws, topic)
+	}))
+	c.EmitRaw("vendor/a/status", []byte("on"))
+	c.EmitRaw("vendor/a/b/status", []byte("on"))
+	assert.Equal([]string{"vendor/a/status"}, raws)
+}
+
+func TestClient_Handlers(t *testing.T) {
+	assert := assert.New(t)
+	fallback := make([]*common.AppSdkMessageData, 0)
+	c := NewClient(&edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			fallback = append(fallback, data)
+		},
+	})
+	handled := make([]string, 0)
+	c.OnEvent("*", "*", "overheat", func(msg *common.AppSdkMessageData) {
+		handled = append(handled, "overheat:"+msg.DeviceId)
+	})
+	c.OnServiceCall("", "", "reboot", func(msg *common.AppSdkMessageData) {
+		handled = append(handled, "reboot")
+	})
+	c.OnProperty("iott-sub", "", "temp", func(msg *common.AppSdkMessageData) {
+		handled = append(handled, "temp:"+string(msg.Payload))
+	})
+	assert.Nil(c.EmitEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "overheat"}))
+	assert.Nil(c.EmitEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "alarm"}))
+	assert.Nil(c.EmitServiceCall(&common.AppSdkMsgServiceCall{Identifier: "reboot"}))
+	assert.Nil(c.EmitProperties("iott-sub", "iotd-sub",
+		&common.AppSdkMsgProperty{Identifier: "temp", Timestamp: 1, Value: 20},
+		&common.AppSdkMsgProperty{Identifier: "humi", Timestamp: 1, Value: 50}))
+	assert.Equal([]string{"overheat:iotd-sub", "reboot", `temp:[{"identifier":"temp","timestamp":1,"value":20}]`}, handled)
+	if assert.Len(fallback, 2) {
+		assert.Equal(common.AppSdkMessageType_Event, fallback[0].Type)
+		assert.JSONEq(`[{"identifier":"humi","timestamp":1,"value":50}]`, string(fallback[1].Payload))
+	}
+}
+
+func TestClient_Context(t *testing.T) {
+	assert := assert.New(t)
+	c := NewClient(nil)
+	assert.Nil(c.Init())
+	assert.Nil(c.StartContext(context.Background()))
+	c.SetCallReply("iott-sub", "iotd-sub", "open", &common.AppSdkMsgServiceReply{Code: 200}, nil)
+	_, err := c.CallEndpointContext(context.Background(), "iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	assert.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = c.SendMessageContext(ctx, common.AppSdkMessageType_Property, []byte(`[]`))
+	assert.True(errors.Is(err, context.Canceled))
+	ctxErr := &common.AppSdkContextError{}
+	if assert.True(errors.As(err, &ctxErr)) {
+		assert.Equal("SendMessage", ctxErr.Op)
+	}
+	_, err = c.GetEndpointInfosContext(ctx)
+	assert.True(errors.Is(err, context.Canceled))
+	_, err = c.CallEndpointContext(ctx, "iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	assert.True(errors.Is(err, context.Canceled))
+	err = c.SendMessageWithMetaContext(ctx, common.AppSdkMessageType_Property, []byte(`[]`), &common.AppSdkMessageMeta{Source: []string{"site-a"}})
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Len(c.Sent(), 0)
+	assert.Len(c.Calls(), 1)
+
+	//带context的处理函数
+	called := 0
+	c.OnEventContext("*", "*", "alarm", func(ctx context.Context, msg *common.AppSdkMessageData) {
+		assert.NotNil(ctx)
+		called++
+	})
+	c.OnPropertySetContext(func(ctx context.Context, props []*common.AppSdkMsgProperty) error {
+		assert.NotNil(ctx)
+		called++
+		return nil
+	})
+	assert.Nil(c.EmitEvent("", "", &common.AppSdkMsgEvent{Identifier: "alarm", Params: map[string]interface{}{}}))
+	_, err = c.EmitPropertySet(&common.AppSdkMsgProperty{Identifier: "switch", Value: true})
+	assert.Nil(err)
+	assert.Equal(2, called)
+	assert.Nil(c.SendMessageWithMetaContext(context.Background(), common.AppSdkMessageType_Property, []byte(`[]`), &common.AppSdkMessageMeta{Source: []string{"site-a"}}))
+	sent := c.Sent()
+	if assert.Len(sent, 2) {
+		assert.Equal([]string{"site-a"}, sent[1].Meta.Source)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+	record提供消息录制和回放：SDK设置Options.RecordFile后，将收到和发送的模型消息按行写入JSONL文件，
+	Replayer可以将录制的消息按照原始速度或者指定倍速回调MessageCB，或者发布到EdgeHub，用于复现现场问题
+*/
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	消息方向
+*/
+const (
+	//SDK收到的消息
+	Direction_In 	= "in"
+	//SDK发送的消息
+	Direction_Out 	= "out"
+)
+
+//单行记录的最大长度
+const maxLineSize = 16 * 1024 * 1024
+
+/*
+	录制的消息
+*/
+type Record struct {
+	//收到或者发送的时间
+	Time 		time.Time 					`json:"time"`
+	//消息方向，Direction_In或Direction_Out
+	Direction 	string 						`json:"direction"`
+	//mqtt topic
+	Topic 		string 						`json:"topic"`
+	//mqtt原始消息数据，JSON中为base64编码
+	Raw 		[]byte 						`json:"raw"`
+	//消息类型，解码失败时为AppSdkMessageType_Unknown
+	Type 		common.AppSdkMessageType 	`json:"type"`
+	ThingId 	string 						`json:"thingId,omitempty"`
+	DeviceId 	string 						`json:"deviceId,omitempty"`
+	//解码后的SDK接口消息数据，格式与AppSdkMessageData.Payload相同
+	Payload 	json.RawMessage 			`json:"payload,omitempty"`
+	Version 	string 						`json:"version,omitempty"`
+	MessageId 	string 						`json:"messageId,omitempty"`
+	RawType 	string 						`json:"rawType,omitempty"`
+	Source 		[]string 					`json:"source,omitempty"`
+	EpochTime 	int64 						`json:"epochTime,omitempty"`
+	//解码失败的原因
+	Error 		string 						`json:"error,omitempty"`
+}
+
+//转换为MessageCB回调的消息数据
+func (r *Record) MessageData() *common.AppSdkMessageData {
+	return &common.AppSdkMessageData{
+		Type: r.Type,
+		ThingId: r.ThingId,
+		DeviceId: r.DeviceId,
+		Payload: []byte(r.Payload),
+		Version: r.Version,
+		MessageId: r.MessageId,
+		Source: r.Source,
+		EpochTime: r.EpochTime,
+		RawType: r.RawType,
+	}
+}
+
+/*
+	消息录制，每条消息写入一行JSON，可以并发调用
+*/
+type Recorder struct {
+	lock 	sync.Mutex
+	w 		io.Writer
+	closer 	io.Closer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+//以追加方式打开录制文件，文件不存在时创建
+func CreateRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{w: file, closer: file}, nil
+}
+
+func (r *Recorder) Record(rec *Record) error {
+	if rec == nil {
+		return errors.New("invalid arguments")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.w == nil {
+		return errors.New("recorder is closed")
+	}
+	_, err = r.w.Write(data)
+	return err
+}
+
+//关闭录制，通过CreateRecorder创建时同时关闭文件
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.w = nil
+	if r.closer == nil {
+		return nil
+	}
+	err := r.closer.Close()
+	r.closer = nil
+	return err
+}
+
+/*
+	按行读取录制的消息
+*/
+type Reader struct {
+	scanner 	*bufio.Scanner
+	line 		int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &Reader{scanner: scanner}
+}
+
+//返回下一条消息，读取结束时返回io.EOF，跳过空行
+func (r *Reader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		rec := &Record{}
+		err := json.Unmarshal(line, rec)
+		if err != nil {
+			return nil, errors.New("invalid record at line " + strconv.Itoa(r.line) + ": " + err.Error())
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+//读取录制文件中的全部消息
+func ReadFile(path string) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := NewReader(file)
+	records := make([]*Record, 0)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,127 @@
+package record
+
+import (
+	"bytes"
+	"context"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "record")
+	if !assert.Nil(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traffic.jsonl")
+	recorder, err := CreateRecorder(path)
+	if !assert.Nil(err) {
+		return
+	}
+	now := time.Now()
+	assert.Nil(recorder.Record(&Record{
+		Time: now,
+		Direction: Direction_In,
+		Topic: "/sys/iott-001/iotd-001/thing/property/base/post",
+		Raw: []byte{0x00, 0x01, 0xa0},
+		Type: common.AppSdkMessageType_Property,
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+		Payload: []byte(`[{"identifier":"temp","timestamp":1,"value":25}]`),
+		MessageId: "msg-001",
+	}))
+	assert.Nil(recorder.Record(&Record{
+		Time: now.Add(time.Second),
+		Direction: Direction_In,
+		Topic: "/sys/iott-001/iotd-001/thing/event/alarm/post",
+		Raw: []byte("{"),
+		Error: "unexpected end of JSON input",
+	}))
+	assert.Nil(recorder.Close())
+	assert.NotNil(recorder.Record(&Record{}))
+
+	//追加写入
+	recorder, err = CreateRecorder(path)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Nil(recorder.Record(&Record{Time: now.Add(2 * time.Second), Direction: Direction_Out, Topic: "out"}))
+	assert.Nil(recorder.Close())
+
+	records, err := ReadFile(path)
+	if !assert.Nil(err) || !assert.Len(records, 3) {
+		return
+	}
+	assert.Equal([]byte{0x00, 0x01, 0xa0}, records[0].Raw)
+	assert.True(now.Equal(records[0].Time))
+	data := records[0].MessageData()
+	assert.Equal(common.AppSdkMessageType_Property, data.Type)
+	assert.Equal("msg-001", data.MessageId)
+	assert.JSONEq(`[{"identifier":"temp","timestamp":1,"value":25}]`, string(data.Payload))
+	assert.Equal("unexpected end of JSON input", records[1].Error)
+	assert.Equal(Direction_Out, records[2].Direction)
+
+	reader := NewReader(strings.NewReader("\n{\"topic\":\"a\"}\nnot json\n"))
+	rec, err := reader.Next()
+	if assert.Nil(err) {
+		assert.Equal("a", rec.Topic)
+	}
+	_, err = reader.Next()
+	assert.EqualError(err, "invalid record at line 3: invalid character 'o' in literal null (expecting 'u')")
+	_, err = NewReader(&bytes.Buffer{}).Next()
+	assert.Equal(io.EOF, err)
+}
+
+func TestReplayer(t *testing.T) {
+	assert := assert.New(t)
+	base := time.Now()
+	records := []*Record{
+		{Time: base, Direction: Direction_In, Type: common.AppSdkMessageType_Property, Payload: []byte(`[]`), Topic: "t1", Raw: []byte("r1")},
+		{Time: base.Add(100 * time.Millisecond), Direction: Direction_Out, Type: common.AppSdkMessageType_Event, Topic: "t2"},
+		{Time: base.Add(200 * time.Millisecond), Direction: Direction_In, Error: "decode failed", Topic: "t3", Raw: []byte("r3")},
+		{Time: base.Add(400 * time.Millisecond), Direction: Direction_In, Type: common.AppSdkMessageType_Event, Payload: []byte(`{}`), Topic: "t4", Raw: []byte("r4")},
+	}
+
+	//回调MessageCB，只回放收到的并且解码成功的消息，4倍速
+	msgs := make([]*common.AppSdkMessageData, 0)
+	start := time.Now()
+	replayer := &Replayer{Speed: 4}
+	err := replayer.Replay(context.Background(), records, MessageHandler(func(data *common.AppSdkMessageData, arg interface{}) {
+		assert.Equal("param", arg)
+		msgs = append(msgs, data)
+	}, "param"))
+	elapsed := time.Since(start)
+	assert.Nil(err)
+	assert.Len(msgs, 2)
+	assert.True(elapsed >= 100*time.Millisecond && elapsed < 300*time.Millisecond, elapsed.String())
+
+	//发布原始消息，不等待
+	topics := make([]string, 0)
+	replayer = &Replayer{Speed: -1, Direction: Direction_In}
+	err = replayer.Replay(context.Background(), records, PublishHandler(func(topic string, qos int32, retain bool, payload []byte) error {
+		topics = append(topics, topic+":"+string(payload))
+		return nil
+	}))
+	assert.Nil(err)
+	assert.Equal([]string{"t1:r1", "t3:r3", "t4:r4"}, topics)
+
+	//取消回放
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	replayer = &Replayer{}
+	err = replayer.Replay(ctx, records, func(rec *Record) error {
+		count++
+		cancel()
+		return nil
+	})
+	assert.Equal(context.Canceled, err)
+	assert.Equal(1, count)
+}
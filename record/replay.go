@@ -0,0 +1,78 @@
+package record
+
+import (
+	"context"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"time"
+)
+
+//回放处理函数，返回错误时停止回放
+type Handler func(rec *Record) error
+
+/*
+	消息回放，按照录制时间间隔依次处理消息
+*/
+type Replayer struct {
+	//回放速度倍数，为0时按照原始速度，2表示两倍速，小于0时不等待
+	Speed 		float64
+	//只回放指定方向的消息，为空时回放全部消息
+	Direction 	string
+}
+
+/*
+	回放消息，第一条消息立即处理，之后按照与上一条消息的录制时间间隔除以Speed等待，
+	ctx取消时返回ctx.Err()
+*/
+func (p *Replayer) Replay(ctx context.Context, records []*Record, handler Handler) error {
+	speed := p.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	var last time.Time
+	for _, rec := range records {
+		if p.Direction != "" && rec.Direction != p.Direction {
+			continue
+		}
+		if !last.IsZero() && speed > 0 && rec.Time.After(last) {
+			wait := time.Duration(float64(rec.Time.Sub(last)) / speed)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		last = rec.Time
+		err := handler(rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+	回调MessageCB，只处理收到的并且解码成功的消息；录制的是过滤前的消息，
+	回放时不再按照订阅条件和事件级别过滤
+*/
+func MessageHandler(cb common.AppSdkMessageCB, param interface{}) Handler {
+	return func(rec *Record) error {
+		if rec.Direction != Direction_In || rec.Error != "" || cb == nil {
+			return nil
+		}
+		cb(rec.MessageData(), param)
+		return nil
+	}
+}
+
+/*
+	发布原始消息到EdgeHub，参数与Client.PublishRaw相同，可以直接使用client.PublishRaw
+*/
+func PublishHandler(publish func(topic string, qos int32, retain bool, payload []byte) error) Handler {
+	return func(rec *Record) error {
+		return publish(rec.Topic, 0, false, rec.Raw)
+	}
+}
@@ -0,0 +1,244 @@
+package testhub
+
+import (
+	"errors"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/qingcloud-iot/edge-app-go/core/mqtt"
+	"net"
+	"sync"
+)
+
+//收到客户端发布的消息时的回调
+type publishHandler func(clientId string, pkt *packets.PublishPacket)
+
+/*
+	嵌入式mqtt服务端，只实现测试需要的MQTT 3.1.1功能：
+	clean session、qos 0/1/2的发布确认、订阅通配符和保留消息，下发消息统一使用qos 0
+*/
+type broker struct {
+	listener 	net.Listener
+	onPublish 	publishHandler
+
+	lock 		sync.Mutex
+	sessions 	map[*session]struct{}
+	retained 	map[string]*packets.PublishPacket
+	connectCnt 	int
+	wg 			sync.WaitGroup
+}
+
+//客户端连接
+type session struct {
+	conn 		net.Conn
+	clientId 	string
+	//写操作互斥
+	writeLock 	sync.Mutex
+	//订阅的filter，由broker.lock保护
+	filters 	map[string]struct{}
+}
+
+func newBroker(onPublish publishHandler) (*broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &broker{
+		listener: listener,
+		onPublish: onPublish,
+		sessions: make(map[*session]struct{}),
+		retained: make(map[string]*packets.PublishPacket),
+	}
+	b.wg.Add(1)
+	go b.serve()
+	return b, nil
+}
+
+func (b *broker) port() int {
+	return b.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (b *broker) close() {
+	b.listener.Close()
+	b.disconnectAll()
+	b.wg.Wait()
+}
+
+func (b *broker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go b.handle(conn)
+	}
+}
+
+//断开全部客户端连接，客户端会自动重连
+func (b *broker) disconnectAll() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer b.wg.Done()
+	defer conn.Close()
+	pkt, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := pkt.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	s := &session{
+		conn: conn,
+		clientId: connect.ClientIdentifier,
+		filters: make(map[string]struct{}),
+	}
+	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	connack.ReturnCode = packets.Accepted
+	if s.write(connack) != nil {
+		return
+	}
+	b.lock.Lock()
+	b.sessions[s] = struct{}{}
+	b.connectCnt++
+	b.lock.Unlock()
+	defer func() {
+		b.lock.Lock()
+		delete(b.sessions, s)
+		b.lock.Unlock()
+	}()
+	for {
+		pkt, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := pkt.(type) {
+		case *packets.PublishPacket:
+			switch p.Qos {
+			case 1:
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				s.write(ack)
+			case 2:
+				rec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				rec.MessageID = p.MessageID
+				s.write(rec)
+			}
+			if b.onPublish != nil {
+				b.onPublish(s.clientId, p)
+			}
+			b.publish(p.TopicName, p.Payload, p.Retain)
+		case *packets.PubrelPacket:
+			comp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			comp.MessageID = p.MessageID
+			s.write(comp)
+		case *packets.SubscribePacket:
+			b.subscribe(s, p)
+		case *packets.UnsubscribePacket:
+			b.lock.Lock()
+			for _, filter := range p.Topics {
+				delete(s.filters, filter)
+			}
+			b.lock.Unlock()
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			s.write(ack)
+		case *packets.PingreqPacket:
+			s.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *broker) subscribe(s *session, p *packets.SubscribePacket) {
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+	retained := make([]*packets.PublishPacket, 0)
+	b.lock.Lock()
+	for _, filter := range p.Topics {
+		s.filters[filter] = struct{}{}
+		ack.ReturnCodes = append(ack.ReturnCodes, 0)
+		for topic, msg := range b.retained {
+			if mqtt.TopicMatch(filter, topic) {
+				retained = append(retained, msg)
+			}
+		}
+	}
+	b.lock.Unlock()
+	s.write(ack)
+	for _, msg := range retained {
+		s.deliver(msg.TopicName, msg.Payload, true)
+	}
+}
+
+//向订阅了topic的客户端转发消息，每个客户端最多转发一次
+func (b *broker) publish(topic string, payload []byte, retain bool) {
+	b.lock.Lock()
+	if retain {
+		if len(payload) == 0 {
+			delete(b.retained, topic)
+		} else {
+			pkt := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+			pkt.TopicName = topic
+			pkt.Payload = payload
+			b.retained[topic] = pkt
+		}
+	}
+	targets := make([]*session, 0)
+	for s := range b.sessions {
+		for filter := range s.filters {
+			if mqtt.TopicMatch(filter, topic) {
+				targets = append(targets, s)
+				break
+			}
+		}
+	}
+	b.lock.Unlock()
+	for _, s := range targets {
+		s.deliver(topic, payload, false)
+	}
+}
+
+//返回当前连接数和累计连接次数
+func (b *broker) connections() (int, int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.sessions), b.connectCnt
+}
+
+//返回当前全部客户端订阅的filter
+func (b *broker) subscriptions() map[string]struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	result := make(map[string]struct{})
+	for s := range b.sessions {
+		for filter := range s.filters {
+			result[filter] = struct{}{}
+		}
+	}
+	return result
+}
+
+func (s *session) deliver(topic string, payload []byte, retain bool) {
+	pkt := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	pkt.TopicName = topic
+	pkt.Payload = payload
+	pkt.Retain = retain
+	s.write(pkt)
+}
+
+func (s *session) write(pkt packets.ControlPacket) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if pkt == nil {
+		return errors.New("invalid packet")
+	}
+	return pkt.Write(s.conn)
+}
@@ -0,0 +1,412 @@
+/*
+	testhub提供进程内的EdgeHub模拟，用于在没有EdgeWize网关的环境下测试基于SDK开发的应用：
+	包括嵌入式mqtt服务端和metadata服务，可以向应用注入属性、事件、服务调用和属性设置消息，
+	检查应用发布的消息，模拟子设备的服务调用回应和连接断开
+*/
+package testhub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/core/config"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//等待条件满足时的轮询间隔
+const pollInterval = 10 * time.Millisecond
+
+//子设备服务调用处理函数，返回nil表示不回应
+type EndpointHandler func(thingId string, deviceId string, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply
+
+/*
+	EdgeHub模拟参数
+*/
+type Options struct {
+	//应用id
+	AppId 			string
+	//边设备模型id
+	ThingId 		string
+	//边设备id
+	DeviceId 		string
+	//是否为消息代理模式
+	ProxyMode 		bool
+	//注入消息的负载格式，为空默认为json
+	PayloadFormat 	string
+}
+
+type Hub struct {
+	opt 		*Options
+	broker 		*broker
+	meta 		*metaServer
+	//按照配置的模式编码注入的消息
+	codec 		*codec.Codec
+	//按照普通模式解码应用发布的消息
+	direct 		*codec.Codec
+
+	lock 		sync.Mutex
+	published 	[]*Message
+	//已经通过NextPublished返回的消息
+	taken 		map[*Message]bool
+	endpointCB 	EndpointHandler
+}
+
+//启动EdgeHub模拟，使用完成后需要调用Close
+func NewHub(opt *Options) (*Hub, error) {
+	if opt == nil || opt.AppId == "" || opt.ThingId == "" || opt.DeviceId == "" {
+		return nil, errors.New("invalid arguments")
+	}
+	payloadCodec, err := codec.NewPayloadCodec(opt.PayloadFormat)
+	if err != nil {
+		return nil, err
+	}
+	h := &Hub{
+		opt: opt,
+		codec: codec.NewCodec(opt.AppId, opt.DeviceId, opt.ThingId, opt.ProxyMode),
+		direct: codec.NewCodec(opt.AppId, opt.DeviceId, opt.ThingId, false),
+		published: make([]*Message, 0),
+		taken: make(map[*Message]bool),
+	}
+	h.codec.Payload = payloadCodec
+	h.direct.Payload = payloadCodec
+	h.broker, err = newBroker(h.onPublish)
+	if err != nil {
+		return nil, err
+	}
+	h.meta, err = newMetaServer()
+	if err != nil {
+		h.broker.close()
+		return nil, err
+	}
+	return h, nil
+}
+
+//关闭mqtt服务端和metadata服务
+func (h *Hub) Close() {
+	h.broker.close()
+	h.meta.close()
+}
+
+//EdgeHub地址
+func (h *Hub) HubAddr() string {
+	return "127.0.0.1"
+}
+
+//mqtt服务端端口
+func (h *Hub) HubPort() int {
+	return h.broker.port()
+}
+
+//metadata服务端口
+func (h *Hub) MetaPort() int {
+	return h.meta.port()
+}
+
+//Docker应用使用的环境变量
+func (h *Hub) Env() map[string]string {
+	return map[string]string{
+		config.ENV_EDGE_HUB_PROTOCOL: "tcp",
+		config.ENV_EDGE_HUB_HOST: h.HubAddr(),
+		config.ENV_EDGE_HUB_PORT: strconv.Itoa(h.HubPort()),
+		config.ENV_EDGE_META_PORT: strconv.Itoa(h.MetaPort()),
+		config.ENV_EDGE_APP_ID: h.opt.AppId,
+		config.ENV_EDGE_DEVICE_ID: h.opt.DeviceId,
+		config.ENV_EDGE_THING_ID: h.opt.ThingId,
+		config.ENV_EDGE_PROXY_MODE: strconv.FormatBool(h.opt.ProxyMode),
+		config.ENV_EDGE_PAYLOAD_FORMAT: h.opt.PayloadFormat,
+	}
+}
+
+//设置环境变量，之后以AppSdkRuntimeType_Docker类型初始化的SDK会连接到此EdgeHub模拟
+func (h *Hub) Setenv() error {
+	for k, v := range h.Env() {
+		err := os.Setenv(k, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//生成二进制应用使用的配置文件，通过-edgeconfig参数指定
+func (h *Hub) WriteConfig(path string) error {
+	cfg := &config.EdgeConfig{
+		Protocol: "tcp",
+		HubAddr: h.HubAddr(),
+		HubPort: h.HubPort(),
+		AppId: h.opt.AppId,
+		DeviceId: h.opt.DeviceId,
+		ThingId: h.opt.ThingId,
+		ProxyMode: h.opt.ProxyMode,
+		PayloadFormat: h.opt.PayloadFormat,
+		MetaPort: h.MetaPort(),
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+//设置metadata服务返回的子设备列表
+func (h *Hub) SetEndpoints(infos ...*common.EndpointInfo) {
+	h.meta.lock.Lock()
+	defer h.meta.lock.Unlock()
+	h.meta.endpoints = append([]*common.EndpointInfo{}, infos...)
+}
+
+//设置metadata服务返回的物模型
+func (h *Hub) SetThingModel(thingId string, model []byte) {
+	h.meta.lock.Lock()
+	defer h.meta.lock.Unlock()
+	h.meta.models[thingId] = model
+}
+
+//注册子设备服务调用处理函数，应用调用CallEndpoint时由handler生成回应
+func (h *Hub) OnEndpointCall(handler EndpointHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.endpointCB = handler
+}
+
+//按照配置的模式生成topic，可用于WaitSubscribed等待应用订阅
+func (h *Hub) Topic(topicType string, identifier string, thingId string, deviceId string) (string, error) {
+	return h.codec.EncodeTopic(topicType, identifier, thingId, deviceId)
+}
+
+//注入属性消息，thingId和deviceId不是边设备时为子设备属性消息
+func (h *Hub) InjectProperties(thingId string, deviceId string, props ...*common.AppSdkMsgProperty) error {
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	return h.inject(codec.TopicType_SubProperty, thingId, deviceId, data)
+}
+
+//注入事件消息，thingId和deviceId不是边设备时为子设备事件消息
+func (h *Hub) InjectEvent(thingId string, deviceId string, evt *common.AppSdkMsgEvent) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return h.inject(codec.TopicType_SubEvent, thingId, deviceId, data)
+}
+
+//注入边设备的服务调用消息，MessageId为空时自动生成
+func (h *Hub) InjectServiceCall(call *common.AppSdkMsgServiceCall) error {
+	if call == nil {
+		return errors.New("invalid arguments")
+	}
+	if call.MessageId == "" {
+		call.MessageId = uuid.NewV1().String()
+	}
+	data, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	return h.inject(codec.TopicType_SubService, h.opt.ThingId, h.opt.DeviceId, data)
+}
+
+//注入边设备的属性设置消息，返回消息id
+func (h *Hub) InjectPropertySet(props ...*common.AppSdkMsgProperty) (string, error) {
+	msg := &codec.MdmpPropertyMsg{
+		Params: make(map[string]*codec.ModelPropertyData),
+	}
+	msg.ID = uuid.NewV1().String()
+	msg.Version = codec.DefaultMessageVersion
+	msg.Type = codec.MessageTypeTemplate_PropertySet
+	msg.Metadata = &codec.ServiceMetadata{
+		ModelId: h.opt.ThingId,
+		EntityId: h.opt.DeviceId,
+	}
+	for _, prop := range props {
+		msg.Params[prop.Identifier] = &codec.ModelPropertyData{
+			Value: prop.Value,
+			Time: prop.Timestamp,
+		}
+	}
+	data, err := h.codec.Payload.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	topic, err := h.codec.EncodeTopic(codec.TopicType_SubPropertySet, "", h.opt.ThingId, h.opt.DeviceId)
+	if err != nil {
+		return "", err
+	}
+	h.broker.publish(topic, data, false)
+	return msg.ID, nil
+}
+
+//注入原始mqtt消息
+func (h *Hub) InjectRaw(topic string, payload []byte, retain bool) {
+	h.broker.publish(topic, payload, retain)
+}
+
+func (h *Hub) inject(topicType string, thingId string, deviceId string, data []byte) error {
+	topic, payload, err := h.codec.EncodeMessage(topicType, thingId, deviceId, data)
+	if err != nil {
+		return err
+	}
+	h.broker.publish(topic, payload, false)
+	return nil
+}
+
+//断开全部客户端连接，SDK会自动重连
+func (h *Hub) DisconnectClients() {
+	h.broker.disconnectAll()
+}
+
+//当前连接的客户端数量
+func (h *Hub) Connections() int {
+	current, _ := h.broker.connections()
+	return current
+}
+
+//等待累计连接次数达到count，可用于等待断开后重连成功
+func (h *Hub) WaitConnected(count int, timeout time.Duration) error {
+	return waitFor(timeout, func() bool {
+		current, total := h.broker.connections()
+		return current > 0 && total >= count
+	}, fmt.Sprintf("wait for %d connections timeout", count))
+}
+
+//当前全部客户端订阅的filter，按照字典序排列
+func (h *Hub) Subscriptions() []string {
+	filters := h.broker.subscriptions()
+	result := make([]string, 0, len(filters))
+	for filter := range filters {
+		result = append(result, filter)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//等待filter被订阅，SDK连接成功后异步订阅，注入消息前需要等待订阅完成
+func (h *Hub) WaitSubscribed(filter string, timeout time.Duration) error {
+	return waitFor(timeout, func() bool {
+		_, ok := h.broker.subscriptions()[filter]
+		return ok
+	}, "wait for subscription timeout: "+filter)
+}
+
+//返回应用发布的全部消息
+func (h *Hub) Published() []*Message {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return append([]*Message{}, h.published...)
+}
+
+//清除记录的应用发布的消息
+func (h *Hub) ClearPublished() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.published = make([]*Message, 0)
+	h.taken = make(map[*Message]bool)
+}
+
+//按照发布顺序返回下一个指定类型的消息，没有时等待直到超时
+func (h *Hub) NextPublished(msgType common.AppSdkMessageType, timeout time.Duration) (*Message, error) {
+	var result *Message
+	err := waitFor(timeout, func() bool {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		for _, msg := range h.published {
+			if msg.Type == msgType && !h.taken[msg] {
+				h.taken[msg] = true
+				result = msg
+				return true
+			}
+		}
+		return false
+	}, fmt.Sprintf("wait for published message of type %d timeout", msgType))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//与NextPublished相同，超时时测试失败
+func (h *Hub) RequirePublished(t testing.TB, msgType common.AppSdkMessageType, timeout time.Duration) *Message {
+	t.Helper()
+	msg, err := h.NextPublished(msgType, timeout)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return msg
+}
+
+//记录应用发布的消息，并模拟子设备回应服务调用
+func (h *Hub) onPublish(clientId string, pkt *packets.PublishPacket) {
+	msg := &Message{
+		ClientId: clientId,
+		Topic: pkt.TopicName,
+		Payload: append([]byte{}, pkt.Payload...),
+		Qos: pkt.Qos,
+		Retain: pkt.Retain,
+	}
+	if h.decodePublished(msg) != nil {
+		msg.Type = common.AppSdkMessageType_Unknown
+		msg.Data = nil
+	}
+	h.lock.Lock()
+	h.published = append(h.published, msg)
+	handler := h.endpointCB
+	h.lock.Unlock()
+	if msg.Type != common.AppSdkMessageType_ServiceCall || handler == nil {
+		return
+	}
+	if msg.ThingId == h.opt.ThingId && msg.DeviceId == h.opt.DeviceId {
+		return
+	}
+	call, err := msg.ServiceCall()
+	if err != nil {
+		return
+	}
+	reply := handler(msg.ThingId, msg.DeviceId, call)
+	if reply == nil {
+		return
+	}
+	if reply.MessageId == "" {
+		reply.MessageId = call.MessageId
+	}
+	if reply.Identifier == "" {
+		reply.Identifier = call.Identifier
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	_, payload, err := h.codec.EncodeMessage(codec.TopicType_PubServiceReply, msg.ThingId, msg.DeviceId, data)
+	if err != nil {
+		return
+	}
+	//回应发送到应用订阅的回应topic
+	topic, err := h.codec.EncodeTopic(codec.TopicType_SubServiceReply, reply.Identifier, msg.ThingId, msg.DeviceId)
+	if err != nil {
+		return
+	}
+	h.broker.publish(topic, payload, false)
+}
+
+func waitFor(timeout time.Duration, cond func() bool, errMsg string) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New(errMsg)
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,1197 @@
+package testhub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/qingcloud-iot/edge-app-go"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"github.com/qingcloud-iot/edge-app-go/core/config"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 3 * time.Second
+
+//拦截器使用的ctx key，设置后丢弃发送的消息
+type dropKey struct{}
+
+func startClient(t *testing.T, hub *Hub, opt *edge_app_go.Options) edge_app_go.Client {
+	if !assert.Nil(t, hub.Setenv()) {
+		t.FailNow()
+	}
+	opt.Type = common.AppSdkRuntimeType_Docker
+	client, err := edge_app_go.NewClient(opt)
+	if !assert.Nil(t, err) || !assert.Nil(t, client.Init()) || !assert.Nil(t, client.Start()) {
+		t.FailNow()
+	}
+	return client
+}
+
+//等待指定类型的消息，应用会收到自身发布的属性和事件，需要跳过
+func waitMessage(t *testing.T, ch chan *common.AppSdkMessageData, msgType common.AppSdkMessageType) *common.AppSdkMessageData {
+	timer := time.After(waitTimeout)
+	for {
+		select {
+		case data := <-ch:
+			if data.Type == msgType {
+				return data
+			}
+		case <-timer:
+			t.Fatalf("wait for message of type %d timeout", msgType)
+		}
+	}
+}
+
+func TestHub_Direct(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		ServiceIds: []string{"reboot"},
+		EndpointThingIds: []string{"iott-sub"},
+	})
+	defer client.Cleanup()
+	filter, err := hub.Topic(codec.TopicType_SubProperty, "", "iott-sub", "+")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+
+	//注入子设备属性
+	err = hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{
+		Identifier: "temp",
+		Timestamp: 1593274999806,
+		Value: 25.5,
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	assert.Equal("iott-sub", data.ThingId)
+	assert.Equal("iotd-sub", data.DeviceId)
+
+	//检查应用发布的属性
+	err = client.SendMessage(common.AppSdkMessageType_Property, []byte(`[{"identifier":"humi","timestamp":1593274999806,"value":50}]`))
+	if !assert.Nil(err) {
+		return
+	}
+	msg := hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout)
+	assert.Equal("iott-001", msg.ThingId)
+	assert.Equal("iotd-001", msg.DeviceId)
+	props, err := msg.Properties()
+	if assert.Nil(err) && assert.Len(props, 1) {
+		assert.Equal("humi", props[0].Identifier)
+		assert.EqualValues(50, props[0].Value)
+	}
+
+	//模拟子设备回应服务调用
+	hub.OnEndpointCall(func(thingId string, deviceId string, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply {
+		return &common.AppSdkMsgServiceReply{
+			Code: 0,
+			Params: map[string]interface{}{"device": deviceId},
+		}
+	})
+	reply, err := client.CallEndpoint("iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{
+		Identifier: "open",
+		Params: map[string]interface{}{},
+	})
+	if assert.Nil(err) {
+		assert.Equal("open", reply.Identifier)
+		assert.Equal("iotd-sub", reply.Params["device"])
+	}
+	call := hub.RequirePublished(t, common.AppSdkMessageType_ServiceCall, waitTimeout)
+	assert.Equal("iott-sub", call.ThingId)
+	assert.Equal("iotd-sub", call.DeviceId)
+
+	//断开连接后自动重连并恢复订阅
+	hub.DisconnectClients()
+	if !assert.Nil(hub.WaitConnected(2, waitTimeout)) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+	err = hub.InjectServiceCall(&common.AppSdkMsgServiceCall{
+		Identifier: "reboot",
+		Params: map[string]interface{}{"delay": 1},
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	data = waitMessage(t, msgCh, common.AppSdkMessageType_ServiceCall)
+	req := &common.AppSdkMsgServiceCall{}
+	if assert.Nil(json.Unmarshal(data.Payload, req)) {
+		assert.Equal("reboot", req.Identifier)
+	}
+
+	//metadata服务
+	hub.SetEndpoints(&common.EndpointInfo{DeviceId: "iotd-sub", ThingId: "iott-sub", DeviceName: "sub"})
+	infos, err := client.GetEndpointInfos()
+	if assert.Nil(err) && assert.Len(infos, 1) {
+		assert.Equal("iotd-sub", infos[0].DeviceId)
+	}
+}
+
+func TestHub_Proxy(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-002",
+		ThingId: "iott-002",
+		DeviceId: "iotd-002",
+		ProxyMode: true,
+		PayloadFormat: "cbor",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	setCh := make(chan []*common.AppSdkMsgProperty, 1)
+	client := startClient(t, hub, &edge_app_go.Options{})
+	defer client.Cleanup()
+	client.OnPropertySet(func(props []*common.AppSdkMsgProperty) error {
+		setCh <- props
+		return nil
+	})
+	filter, err := hub.Topic(codec.TopicType_SubPropertySet, "", "iott-002", "iotd-002")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+
+	//属性设置由SDK自动回应
+	messageId, err := hub.InjectPropertySet(&common.AppSdkMsgProperty{Identifier: "switch", Value: true})
+	if !assert.Nil(err) {
+		return
+	}
+	select {
+	case props := <-setCh:
+		if assert.Len(props, 1) {
+			assert.Equal("switch", props[0].Identifier)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("wait for property set timeout")
+	}
+	msg := hub.RequirePublished(t, common.AppSdkMessageType_PropertySetReply, waitTimeout)
+	reply, err := msg.PropertySetReply()
+	if assert.Nil(err) {
+		assert.Equal(messageId, reply.MessageId)
+		assert.EqualValues(200, reply.Code)
+	}
+
+	//代理模式发布的事件
+	err = client.SendMessage(common.AppSdkMessageType_Event, []byte(`{"identifier":"alarm","timestamp":1593274999806,"params":{"level":3}}`))
+	if !assert.Nil(err) {
+		return
+	}
+	msg = hub.RequirePublished(t, common.AppSdkMessageType_Event, waitTimeout)
+	assert.Equal("iott-002", msg.ThingId)
+	evt, err := msg.Event()
+	if assert.Nil(err) {
+		assert.Equal("alarm", evt.Identifier)
+	}
+}
+
+//Strict模式下参数错误的服务调用由SDK直接回应400，回应本身不经过物模型校验
+func TestHub_StrictServiceCall(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	hub.SetThingModel("iott-001", []byte(`{
+		"thingId": "iott-001",
+		"services": [
+			{"identifier": "setTemperature", "input": [{"identifier": "temperature", "dataType": {"type": "int", "min": 0, "max": 50}, "required": true}], "output": []}
+		]
+	}`))
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		ServiceIds: []string{"setTemperature", "reboot"},
+		ValidateMode: common.ValidateMode_Strict,
+	})
+	defer client.Cleanup()
+	filter, err := hub.Topic(codec.TopicType_SubService, "reboot", "iott-001", "iotd-001")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+
+	for _, call := range []*common.AppSdkMsgServiceCall{
+		{Identifier: "setTemperature", Params: map[string]interface{}{"temperature": 80}},
+		{Identifier: "reboot", Params: map[string]interface{}{}},
+	} {
+		if !assert.Nil(hub.InjectServiceCall(call)) {
+			return
+		}
+		msg := hub.RequirePublished(t, common.AppSdkMessageType_ServiceReply, waitTimeout)
+		reply, err := msg.ServiceReply()
+		if assert.Nil(err) {
+			assert.Equal(call.MessageId, reply.MessageId)
+			assert.Equal(call.Identifier, reply.Identifier)
+			assert.EqualValues(400, reply.Code)
+			assert.NotEmpty(reply.Params["message"])
+		}
+	}
+	select {
+	case data := <-msgCh:
+		t.Fatalf("unexpected message of type %d", data.Type)
+	default:
+	}
+}
+
+func TestHub_CallbackPanic(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	panicCh := make(chan *common.AppSdkCallbackPanic, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			if data.Type == common.AppSdkMessageType_Event {
+				panic("bad event")
+			}
+			msgCh <- data
+		},
+		EventCB: func(data *common.AppSdkEventData, arg interface{}) {
+			if data.Type == common.EventType_CallbackPanic {
+				panicCh <- data.Payload.(*common.AppSdkCallbackPanic)
+			}
+			//EventCB自身panic不影响后续消息
+			panic("bad event callback")
+		},
+		EndpointThingIds: []string{"iott-sub"},
+		Interceptors: []common.AppSdkInterceptor{
+			func(ctx context.Context, direction common.MessageDirection, msg *common.AppSdkMessageData) error {
+				if bytes.Contains(msg.Payload, []byte(`"identifier":"boom"`)) {
+					panic("bad interceptor")
+				}
+				return nil
+			},
+		},
+	})
+	defer client.Cleanup()
+	client.OnProperty("iott-sub", "*", "crash", func(msg *common.AppSdkMessageData) {
+		panic("bad handler")
+	})
+	client.OnPropertySet(func(props []*common.AppSdkMsgProperty) error {
+		var m map[string]int
+		m["switch"] = 1
+		return nil
+	})
+	filter, err := hub.Topic(codec.TopicType_SubPropertySet, "", "iott-001", "iotd-001")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+	waitPanic := func() *common.AppSdkCallbackPanic {
+		select {
+		case info := <-panicCh:
+			return info
+		case <-time.After(waitTimeout):
+			t.Fatal("wait for callback panic timeout")
+		}
+		return nil
+	}
+
+	//MessageCB panic之后继续处理后续消息
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "alarm", Params: map[string]interface{}{}}))
+	info := waitPanic()
+	assert.Equal("MessageCB", info.Callback)
+	assert.Equal(common.AppSdkMessageType_Event, info.Type)
+	assert.Equal("bad event", info.Value)
+	assert.Contains(info.Topic, "/thing/event/alarm/post")
+	assert.NotEmpty(info.Stack)
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 25}))
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	assert.Equal("iotd-sub", data.DeviceId)
+
+	//OnProperty注册的处理函数panic之后继续处理后续消息
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "crash", Value: 1}))
+	info = waitPanic()
+	assert.Equal("MessageHandler", info.Callback)
+	assert.Equal(common.AppSdkMessageType_Property, info.Type)
+	assert.Equal("bad handler", info.Value)
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 26}))
+	data = waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	assert.Contains(string(data.Payload), `"value":26`)
+
+	//拦截器panic时丢弃消息，继续处理后续消息
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "boom", Value: 1}))
+	info = waitPanic()
+	assert.Equal("Interceptor", info.Callback)
+	assert.Equal("bad interceptor", info.Value)
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 27}))
+	data = waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	assert.Contains(string(data.Payload), `"value":27`)
+
+	//属性设置处理函数panic时回应失败
+	_, err = hub.InjectPropertySet(&common.AppSdkMsgProperty{Identifier: "switch", Value: true})
+	if !assert.Nil(err) {
+		return
+	}
+	info = waitPanic()
+	assert.Equal("PropertySetHandler", info.Callback)
+	reply, err := hub.RequirePublished(t, common.AppSdkMessageType_PropertySetReply, waitTimeout).PropertySetReply()
+	if assert.Nil(err) {
+		assert.EqualValues(500, reply.Code)
+		assert.Contains(reply.Message, "PropertySetHandler panic")
+	}
+
+	//原始消息回调panic
+	assert.Nil(client.SubscribeRaw("custom/#", func(topic string, payload []byte) {
+		panic(topic)
+	}))
+	if !assert.Nil(hub.WaitSubscribed("custom/#", waitTimeout)) {
+		return
+	}
+	hub.InjectRaw("custom/a", []byte("x"), false)
+	info = waitPanic()
+	assert.Equal("RawMessageCB", info.Callback)
+	assert.Equal("custom/a", info.Value)
+}
+
+func TestHub_Interceptors(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	order := make(chan string, 20)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		EndpointThingIds: []string{"iott-sub"},
+		Interceptors: []common.AppSdkInterceptor{
+			//丢弃调试事件
+			func(ctx context.Context, direction common.MessageDirection, msg *common.AppSdkMessageData) error {
+				order <- "first"
+				if msg.Type == common.AppSdkMessageType_Event && bytes.Contains(msg.Payload, []byte(`"identifier":"debug"`)) {
+					return common.ErrMessageDropped
+				}
+				return nil
+			},
+			//子设备温度转换为华氏度，发送的消息增加设备源，服务调用转发到备用设备
+			func(ctx context.Context, direction common.MessageDirection, msg *common.AppSdkMessageData) error {
+				order <- "second"
+				if direction == common.MessageDirection_Outbound {
+					msg.Source = append(msg.Source, "site-a")
+					if msg.Type == common.AppSdkMessageType_ServiceCall {
+						msg.DeviceId = "iotd-backup"
+					}
+					return nil
+				}
+				if msg.Type != common.AppSdkMessageType_Property || msg.ThingId != "iott-sub" {
+					return nil
+				}
+				props := make([]*common.AppSdkMsgProperty, 0)
+				err := json.Unmarshal(msg.Payload, &props)
+				if err != nil {
+					return err
+				}
+				for _, prop := range props {
+					if value, ok := prop.Value.(float64); ok && prop.Identifier == "temp" {
+						prop.Value = value*9/5 + 32
+					}
+				}
+				msg.Payload, err = json.Marshal(props)
+				return err
+			},
+		},
+	})
+	defer client.Cleanup()
+	filter, err := hub.Topic(codec.TopicType_SubEvent, "+", "iott-sub", "+")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+
+	//收到的消息
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "debug", Params: map[string]interface{}{}}))
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 100}))
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	props := make([]*common.AppSdkMsgProperty, 0)
+	if assert.Nil(json.Unmarshal(data.Payload, &props)) && assert.Len(props, 1) {
+		assert.EqualValues(212, props[0].Value)
+	}
+	//丢弃消息后不再执行后续的拦截器
+	assert.Equal([]string{"first", "first", "second"}, []string{<-order, <-order, <-order})
+	select {
+	case data := <-msgCh:
+		t.Fatalf("unexpected message of type %d", data.Type)
+	default:
+	}
+
+	//发送的消息
+	err = client.SendMessage(common.AppSdkMessageType_Event, []byte(`{"identifier":"debug","timestamp":1,"params":{}}`))
+	assert.True(errors.Is(err, common.ErrMessageDropped))
+	assert.Nil(client.SendMessage(common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":1,"value":20}]`)))
+	msg := hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout)
+	assert.Equal([]string{"site-a"}, msg.Source)
+	for _, msg := range hub.Published() {
+		assert.NotEqual(common.AppSdkMessageType_Event, msg.Type)
+	}
+	hub.OnEndpointCall(func(thingId string, deviceId string, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply {
+		return &common.AppSdkMsgServiceReply{Code: 200, Params: map[string]interface{}{"device": deviceId}}
+	})
+	reply, err := client.CallEndpoint("iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	if assert.Nil(err) {
+		assert.Equal("iotd-backup", reply.Params["device"])
+	}
+}
+
+func TestHub_Router(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	handledCh := make(chan string, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			if data.ThingId == "iott-sub" {
+				msgCh <- data
+			}
+		},
+		EndpointThingIds: []string{"iott-sub"},
+	})
+	defer client.Cleanup()
+	client.OnEvent("iott-sub", "*", "overheat", func(msg *common.AppSdkMessageData) {
+		handledCh <- "thing:" + msg.DeviceId
+	})
+	client.OnEvent("*", "iotd-hot", "overheat", func(msg *common.AppSdkMessageData) {
+		handledCh <- "device:" + msg.DeviceId
+	})
+	client.OnProperty("iott-sub", "*", "temp", func(msg *common.AppSdkMessageData) {
+		handledCh <- "temp:" + msg.DeviceId
+	})
+	filter, err := hub.Topic(codec.TopicType_SubEvent, "+", "iott-sub", "+")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+	waitHandled := func() string {
+		select {
+		case name := <-handledCh:
+			return name
+		case <-time.After(waitTimeout):
+			t.Fatal("wait for handler timeout")
+		}
+		return ""
+	}
+
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "overheat", Params: map[string]interface{}{}}))
+	assert.Equal("thing:iotd-sub", waitHandled())
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-hot", &common.AppSdkMsgEvent{Identifier: "overheat", Params: map[string]interface{}{}}))
+	assert.Equal("device:iotd-hot", waitHandled())
+
+	//没有匹配的事件和属性回调MessageCB
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "alarm", Params: map[string]interface{}{}}))
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Event)
+	assert.Contains(string(data.Payload), `"alarm"`)
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub",
+		&common.AppSdkMsgProperty{Identifier: "temp", Value: 20},
+		&common.AppSdkMsgProperty{Identifier: "humi", Value: 50}))
+	assert.Equal("temp:iotd-sub", waitHandled())
+	data = waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	props := make([]*common.AppSdkMsgProperty, 0)
+	if assert.Nil(json.Unmarshal(data.Payload, &props)) && assert.Len(props, 1) {
+		assert.Equal("humi", props[0].Identifier)
+	}
+}
+
+func TestHub_Context(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	if !assert.Nil(hub.Setenv()) {
+		return
+	}
+	hub.SetEndpoints(&common.EndpointInfo{ThingId: "iott-sub", DeviceId: "iotd-sub"})
+	client, err := edge_app_go.NewClient(&edge_app_go.Options{
+		Type: common.AppSdkRuntimeType_Docker,
+		EndpointThingIds: []string{"iott-sub"},
+		Interceptors: []common.AppSdkInterceptor{
+			//拦截器收到调用方的ctx
+			func(ctx context.Context, direction common.MessageDirection, msg *common.AppSdkMessageData) error {
+				if ctx.Value(dropKey{}) != nil {
+					return common.ErrMessageDropped
+				}
+				return nil
+			},
+		},
+	})
+	if !assert.Nil(err) || !assert.Nil(client.Init()) {
+		return
+	}
+	defer client.Cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	//返回时已经连接成功，不需要等待订阅
+	if !assert.Nil(client.StartContext(ctx)) {
+		return
+	}
+	assert.Equal(1, hub.Connections())
+
+	assert.Nil(client.SendMessageContext(ctx, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":1,"value":20}]`)))
+	hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout)
+	hub.ClearPublished()
+	//拦截器丢弃的消息和服务调用都返回包含ErrMessageDropped的错误
+	dropCtx := context.WithValue(ctx, dropKey{}, true)
+	err = client.SendMessageContext(dropCtx, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":2,"value":21}]`))
+	assert.True(errors.Is(err, common.ErrMessageDropped))
+	err = client.SendMessageWithMetaContext(dropCtx, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":2,"value":21}]`), &common.AppSdkMessageMeta{Source: []string{"site-a"}})
+	assert.True(errors.Is(err, common.ErrMessageDropped))
+	_, err = client.CallEndpointContext(dropCtx, "iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	assert.True(errors.Is(err, common.ErrMessageDropped))
+	infos, err := client.GetEndpointInfosContext(ctx)
+	if assert.Nil(err) {
+		assert.Len(infos, 1)
+	}
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	err = client.SendMessageContext(canceled, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":3,"value":22}]`))
+	assert.True(errors.Is(err, context.Canceled))
+	ctxErr := &common.AppSdkContextError{}
+	if assert.True(errors.As(err, &ctxErr)) {
+		assert.Equal("SendMessage", ctxErr.Op)
+	}
+	_, err = client.GetEndpointInfosContext(canceled)
+	assert.True(errors.Is(err, context.Canceled))
+	err = client.SendMessageWithMetaContext(canceled, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":3,"value":22}]`), &common.AppSdkMessageMeta{Source: []string{"site-a"}})
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Len(hub.Published(), 0)
+	assert.Nil(client.SendMessageWithMetaContext(ctx, common.AppSdkMessageType_Property, []byte(`[{"identifier":"temp","timestamp":4,"value":23}]`), &common.AppSdkMessageMeta{Source: []string{"site-a"}}))
+	msg := hub.RequirePublished(t, common.AppSdkMessageType_Property, waitTimeout)
+	assert.Equal([]string{"site-a"}, msg.Source)
+	hub.ClearPublished()
+
+	//子设备没有回应时按照ctx的截止时间返回
+	short, cancelShort := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelShort()
+	begin := time.Now()
+	_, err = client.CallEndpointContext(short, "iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	if assert.True(errors.As(err, &ctxErr)) {
+		assert.Equal("CallEndpoint", ctxErr.Op)
+	}
+	assert.True(time.Since(begin) < time.Second)
+	hub.OnEndpointCall(func(thingId string, deviceId string, call *common.AppSdkMsgServiceCall) *common.AppSdkMsgServiceReply {
+		return &common.AppSdkMsgServiceReply{Code: 200}
+	})
+	reply, err := client.CallEndpointContext(ctx, "iott-sub", "iotd-sub", &common.AppSdkMsgServiceCall{Identifier: "open"})
+	if assert.Nil(err) {
+		assert.EqualValues(200, reply.Code)
+	}
+}
+
+//收到的消息按照每条消息创建的ctx处理，处理完成或者Stop时取消
+func TestHub_MessageContext(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	ctxCh := make(chan context.Context, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		EndpointThingIds: []string{"iott-sub"},
+		Interceptors: []common.AppSdkInterceptor{
+			func(ctx context.Context, direction common.MessageDirection, msg *common.AppSdkMessageData) error {
+				if direction == common.MessageDirection_Inbound && ctx.Err() == nil {
+					ctxCh <- ctx
+				}
+				return nil
+			},
+		},
+	})
+	defer client.Cleanup()
+	handled := make(chan error, 10)
+	client.OnEventContext("iott-sub", "*", "alarm", func(ctx context.Context, msg *common.AppSdkMessageData) {
+		handled <- ctx.Err()
+		//耗时的处理在Stop时取消
+		<-ctx.Done()
+		handled <- ctx.Err()
+	})
+	client.OnPropertySetContext(func(ctx context.Context, props []*common.AppSdkMsgProperty) error {
+		return ctx.Err()
+	})
+	filter, err := hub.Topic(codec.TopicType_SubPropertySet, "", "iott-001", "iotd-001")
+	if !assert.Nil(err) || !assert.Nil(hub.WaitSubscribed(filter, waitTimeout)) {
+		return
+	}
+	waitCtx := func() context.Context {
+		select {
+		case ctx := <-ctxCh:
+			return ctx
+		case <-time.After(waitTimeout):
+			t.Fatal("wait for message context timeout")
+		}
+		return nil
+	}
+
+	//属性设置处理完成后ctx取消
+	_, err = hub.InjectPropertySet(&common.AppSdkMsgProperty{Identifier: "switch", Value: true})
+	if !assert.Nil(err) {
+		return
+	}
+	reply, err := hub.RequirePublished(t, common.AppSdkMessageType_PropertySetReply, waitTimeout).PropertySetReply()
+	if assert.Nil(err) {
+		assert.EqualValues(200, reply.Code)
+	}
+	assert.Equal(context.Canceled, waitCtx().Err())
+
+	//Stop时正在处理的消息的ctx取消
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "alarm", Params: map[string]interface{}{}}))
+	ctx := waitCtx()
+	select {
+	case err := <-handled:
+		assert.Nil(err)
+	case <-time.After(waitTimeout):
+		t.Fatal("wait for event handler timeout")
+	}
+	assert.Nil(ctx.Err())
+	client.Stop()
+	select {
+	case err := <-handled:
+		assert.Equal(context.Canceled, err)
+	case <-time.After(waitTimeout):
+		t.Fatal("wait for event handler cancel timeout")
+	}
+}
+
+func TestHub_StartContextTimeout(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) || !assert.Nil(hub.Setenv()) {
+		return
+	}
+	//EdgeHub不可用时一直无法连接
+	hub.Close()
+	client, err := edge_app_go.NewClient(&edge_app_go.Options{Type: common.AppSdkRuntimeType_Docker})
+	if !assert.Nil(err) || !assert.Nil(client.Init()) {
+		return
+	}
+	defer client.Cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = client.StartContext(ctx)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	ctxErr := &common.AppSdkContextError{}
+	if assert.True(errors.As(err, &ctxErr)) {
+		assert.Equal("Start", ctxErr.Op)
+		assert.EqualError(err, "APP SDK Start failed, err: context deadline exceeded")
+	}
+}
+
+//订阅的增删，每次调用前后检查服务端的订阅，断开重连后恢复当前的订阅
+func TestHub_Subscriptions(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	topic := func(topicType string, identifier string, thingId string, deviceId string) string {
+		tempTopic, err := hub.Topic(topicType, identifier, thingId, deviceId)
+		if !assert.Nil(err) {
+			t.FailNow()
+		}
+		return tempTopic
+	}
+	base := []string{
+		topic(codec.TopicType_SubProperty, "+", "iott-001", "iotd-001"),
+		topic(codec.TopicType_SubEvent, "+", "iott-001", "iotd-001"),
+		topic(codec.TopicType_SubPropertySet, "", "iott-001", "iotd-001"),
+	}
+	reboot := topic(codec.TopicType_SubService, "reboot", "iott-001", "iotd-001")
+	upgrade := topic(codec.TopicType_SubService, "upgrade", "iott-001", "iotd-001")
+	subProperty := topic(codec.TopicType_SubProperty, "+", "iott-sub", "+")
+	subEvent := topic(codec.TopicType_SubEvent, "+", "iott-sub", "+")
+	expected := func(topics ...string) map[string]struct{} {
+		result := make(map[string]struct{})
+		for _, tempTopic := range append(append([]string{}, base...), topics...) {
+			result[tempTopic] = struct{}{}
+		}
+		return result
+	}
+	//等待服务端的订阅与预期一致，订阅在连接成功后异步完成
+	waitSubscriptions := func(topics ...string) {
+		want := expected(topics...)
+		err := waitFor(waitTimeout, func() bool {
+			return reflect.DeepEqual(want, hub.broker.subscriptions())
+		}, "wait for subscriptions timeout")
+		assert.Nil(err)
+		assert.Equal(want, hub.broker.subscriptions())
+	}
+
+	disconnected := make(chan struct{}, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		EventCB: func(data *common.AppSdkEventData, arg interface{}) {
+			if data.Type == common.EventType_Disconnected {
+				disconnected <- struct{}{}
+			}
+		},
+		ServiceIds: []string{"reboot"},
+	})
+	defer client.Cleanup()
+	waitDisconnected := func() {
+		select {
+		case <-disconnected:
+		case <-time.After(waitTimeout):
+			t.Fatal("wait for disconnected timeout")
+		}
+	}
+	waitSubscriptions(reboot)
+
+	//订阅和取消订阅在返回前已经完成
+	assert.Nil(client.AddServices("upgrade"))
+	assert.Equal(expected(reboot, upgrade), hub.broker.subscriptions())
+	assert.Nil(client.SubscribeEndpoints("iott-sub"))
+	assert.Equal(expected(reboot, upgrade, subProperty, subEvent), hub.broker.subscriptions())
+	//重复订阅不会改变订阅
+	assert.Nil(client.AddServices("upgrade"))
+	assert.Equal(expected(reboot, upgrade, subProperty, subEvent), hub.broker.subscriptions())
+	assert.Nil(client.RemoveServices("reboot"))
+	assert.Equal(expected(upgrade, subProperty, subEvent), hub.broker.subscriptions())
+
+	//断开连接后恢复当前的订阅，已经取消的订阅不会恢复
+	hub.DisconnectClients()
+	waitDisconnected()
+	if !assert.Nil(hub.WaitConnected(2, waitTimeout)) {
+		return
+	}
+	waitSubscriptions(upgrade, subProperty, subEvent)
+
+	assert.Nil(client.UnsubscribeEndpoints("iott-sub"))
+	assert.Equal(expected(upgrade), hub.broker.subscriptions())
+	assert.Nil(client.RemoveServices("upgrade"))
+	assert.Equal(expected(), hub.broker.subscriptions())
+	assert.NotNil(client.AddServices())
+	assert.NotNil(client.UnsubscribeEndpoints())
+
+	//未连接时只记录订阅状态，重新连接后订阅
+	hub.DisconnectClients()
+	waitDisconnected()
+	assert.Nil(client.AddServices("reboot"))
+	if !assert.Nil(hub.WaitConnected(3, waitTimeout)) {
+		return
+	}
+	waitSubscriptions(reboot)
+}
+
+//子设备过滤条件：设备id和事件id缩小订阅的topic，属性标识和事件级别在接收时过滤
+func TestHub_EndpointFilters(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 20)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+	})
+	defer client.Cleanup()
+	err = client.SubscribeEndpointFilters(&common.EndpointFilter{
+		ThingId: "iott-sub",
+		DeviceIds: []string{"iotd-a"},
+		PropertyIds: []string{"temp"},
+		EventIds: []string{"alarm"},
+		MinEventLevel: common.EventLevel_Warn,
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	//只订阅指定设备和事件的topic，不使用通配符
+	propFilter, _ := hub.Topic(codec.TopicType_SubProperty, "+", "iott-sub", "iotd-a")
+	evtFilter, _ := hub.Topic(codec.TopicType_SubEvent, "alarm", "iott-sub", "iotd-a")
+	wildcardProp, _ := hub.Topic(codec.TopicType_SubProperty, "+", "iott-sub", "+")
+	wildcardEvt, _ := hub.Topic(codec.TopicType_SubEvent, "+", "iott-sub", "iotd-a")
+	if !assert.Nil(hub.WaitSubscribed(propFilter, waitTimeout)) || !assert.Nil(hub.WaitSubscribed(evtFilter, waitTimeout)) {
+		return
+	}
+	subscriptions := hub.broker.subscriptions()
+	assert.NotContains(subscriptions, wildcardProp)
+	assert.NotContains(subscriptions, wildcardEvt)
+
+	//被过滤的设备、事件、属性和事件级别
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-b", &common.AppSdkMsgProperty{Identifier: "temp", Value: 1}))
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-a", &common.AppSdkMsgEvent{Identifier: "overheat", Level: common.EventLevel_Critical}))
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-b", &common.AppSdkMsgEvent{Identifier: "alarm", Level: common.EventLevel_Critical}))
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-a", &common.AppSdkMsgProperty{Identifier: "humi", Value: 2}))
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-a", &common.AppSdkMsgEvent{Identifier: "alarm", Level: common.EventLevel_Info}))
+	//符合过滤条件的消息，只保留指定的属性
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-a",
+		&common.AppSdkMsgProperty{Identifier: "temp", Value: 3},
+		&common.AppSdkMsgProperty{Identifier: "humi", Value: 4}))
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-a", &common.AppSdkMsgEvent{Identifier: "alarm", Level: common.EventLevel_Error}))
+
+	received := make([]*common.AppSdkMessageData, 0)
+	timer := time.After(waitTimeout)
+	for len(received) < 2 {
+		select {
+		case data := <-msgCh:
+			received = append(received, data)
+		case <-timer:
+			t.Fatalf("wait for filtered messages timeout, received %d", len(received))
+		}
+	}
+	//等待可能迟到的消息，MessageCB不应该收到被过滤的消息
+	time.Sleep(100 * time.Millisecond)
+	close(msgCh)
+	for data := range msgCh {
+		received = append(received, data)
+	}
+	if !assert.Len(received, 2) {
+		return
+	}
+	for _, data := range received {
+		assert.Equal("iott-sub", data.ThingId)
+		assert.Equal("iotd-a", data.DeviceId)
+		switch data.Type {
+		case common.AppSdkMessageType_Property:
+			props := make([]*common.AppSdkMsgProperty, 0)
+			if assert.Nil(json.Unmarshal(data.Payload, &props)) && assert.Len(props, 1) {
+				assert.Equal("temp", props[0].Identifier)
+				assert.EqualValues(3, props[0].Value)
+			}
+		case common.AppSdkMessageType_Event:
+			evt := &common.AppSdkMsgEvent{}
+			if assert.Nil(json.Unmarshal(data.Payload, evt)) {
+				assert.Equal("alarm", evt.Identifier)
+				assert.Equal(common.EventLevel_Error, evt.Level)
+			}
+		default:
+			t.Errorf("unexpected message type %d", data.Type)
+		}
+	}
+}
+
+//等待解码失败事件
+func waitDecodeError(t *testing.T, ch chan *common.AppSdkDecodeError) *common.AppSdkDecodeError {
+	select {
+	case decodeErr := <-ch:
+		return decodeErr
+	case <-time.After(waitTimeout):
+		t.Fatal("wait for decode error timeout")
+	}
+	return nil
+}
+
+//格式错误的负载通过EventType_DecodeError事件上报，不回调MessageCB，并计入消息统计
+func TestHub_DecodeErrors(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	errCh := make(chan *common.AppSdkDecodeError, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		EventCB: func(data *common.AppSdkEventData, arg interface{}) {
+			if data.Type == common.EventType_DecodeError {
+				errCh <- data.Payload.(*common.AppSdkDecodeError)
+			}
+		},
+		EndpointThingIds: []string{"iott-sub"},
+	})
+	defer client.Cleanup()
+	propTopic, _ := hub.Topic(codec.TopicType_SubProperty, "", "iott-001", "iotd-001")
+	evtTopic, _ := hub.Topic(codec.TopicType_SubEvent, "alarm", "iott-sub", "iotd-sub")
+	evtFilter, _ := hub.Topic(codec.TopicType_SubEvent, "+", "iott-sub", "+")
+	if !assert.Nil(hub.WaitSubscribed(propTopic, waitTimeout)) || !assert.Nil(hub.WaitSubscribed(evtFilter, waitTimeout)) {
+		return
+	}
+	assert.Equal(&common.AppSdkMessageStats{}, client.GetMessageStats())
+
+	//不是合法的消息格式
+	hub.InjectRaw(propTopic, []byte{0x01, 0x02, 0x03}, false)
+	decodeErr := waitDecodeError(t, errCh)
+	assert.Equal(propTopic, decodeErr.Topic)
+	assert.Equal([]byte{0x01, 0x02, 0x03}, decodeErr.Payload)
+	assert.False(decodeErr.Unknown)
+	assert.NotNil(decodeErr.Err)
+
+	//消息格式正确但是缺少事件参数
+	hub.InjectRaw(evtTopic, []byte(`{"id":"msg-001","version":"1.0","type":"thing.event.alarm.post"}`), false)
+	decodeErr = waitDecodeError(t, errCh)
+	assert.Equal(evtTopic, decodeErr.Topic)
+	assert.False(decodeErr.Unknown)
+	assert.EqualError(decodeErr.Err, "event params is empty")
+
+	//不支持的消息版本
+	hub.InjectRaw(evtTopic, []byte(`{"id":"msg-002","version":"9.0","type":"thing.event.alarm.post","params":{"value":{},"time":1}}`), false)
+	decodeErr = waitDecodeError(t, errCh)
+	assert.True(errors.Is(decodeErr, codec.ErrUnsupportedVersion))
+
+	//解码失败的消息之后，正常的消息不受影响
+	assert.Nil(hub.InjectEvent("iott-sub", "iotd-sub", &common.AppSdkMsgEvent{Identifier: "alarm", Params: map[string]interface{}{}}))
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Event)
+	assert.Equal("iotd-sub", data.DeviceId)
+	select {
+	case data := <-msgCh:
+		t.Errorf("unexpected message of type %d", data.Type)
+	default:
+	}
+	assert.Equal(&common.AppSdkMessageStats{Received: 4, DecodeErrors: 3}, client.GetMessageStats())
+}
+
+/*
+	无法解析的topic和无法处理的消息类型：模版方案中发布事件的topic与订阅事件的通配符重叠，
+	标识id为空的事件topic按照发布事件解码，子设备id为空的属性topic无法解码
+*/
+func TestHub_UnknownTopics(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	templates := `{"SubProperty": "/things/{thingId}/{deviceId}/props", "SubEvent": "/things/{thingId}/{deviceId}/events/{identifier}", ` +
+		`"PubEvent": "/things/{thingId}/{deviceId}/events/", "SubPropertySet": "/things/{thingId}/{deviceId}/set"}`
+	if !assert.Nil(os.Setenv(config.ENV_EDGE_TOPIC_TEMPLATES, templates)) {
+		return
+	}
+	defer os.Unsetenv(config.ENV_EDGE_TOPIC_TEMPLATES)
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	errCh := make(chan *common.AppSdkDecodeError, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		EventCB: func(data *common.AppSdkEventData, arg interface{}) {
+			if data.Type == common.EventType_DecodeError {
+				errCh <- data.Payload.(*common.AppSdkDecodeError)
+			}
+		},
+		EndpointThingIds: []string{"iott-sub"},
+	})
+	defer client.Cleanup()
+	if !assert.Nil(hub.WaitSubscribed("/things/iott-sub/+/props", waitTimeout)) ||
+		!assert.Nil(hub.WaitSubscribed("/things/iott-001/iotd-001/events/+", waitTimeout)) {
+		return
+	}
+
+	//无法解析的topic
+	hub.InjectRaw("/things/iott-sub//props", []byte(`{"id":"msg-001","version":"1.0","params":{}}`), false)
+	decodeErr := waitDecodeError(t, errCh)
+	assert.Equal("/things/iott-sub//props", decodeErr.Topic)
+	assert.False(decodeErr.Unknown)
+	assert.EqualError(decodeErr.Err, "invalid topic format: /things/iott-sub//props")
+
+	//无法处理的消息类型，上报事件并兼容之前的行为回调MessageCB
+	payload := []byte(`{"id":"msg-002","version":"1.0","type":"thing.event.post","params":{"value":{},"time":1}}`)
+	hub.InjectRaw("/things/iott-001/iotd-001/events/", payload, false)
+	decodeErr = waitDecodeError(t, errCh)
+	assert.Equal("/things/iott-001/iotd-001/events/", decodeErr.Topic)
+	assert.Equal(payload, decodeErr.Payload)
+	assert.True(decodeErr.Unknown)
+	assert.Contains(decodeErr.Error(), codec.TopicType_PubEvent)
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Unknown)
+	assert.Equal("iott-001", data.ThingId)
+	assert.Equal(&common.AppSdkMessageStats{Received: 2, DecodeErrors: 1, Unknown: 1}, client.GetMessageStats())
+}
+
+type rawMessage struct {
+	topic 	string
+	payload []byte
+}
+
+func waitRaw(t *testing.T, ch chan *rawMessage) *rawMessage {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(waitTimeout):
+		t.Fatal("wait for raw message timeout")
+	}
+	return nil
+}
+
+//原始消息的发布和订阅：不经过模型消息编解码，断开重连后恢复订阅
+func TestHub_Raw(t *testing.T) {
+	assert := assert.New(t)
+	hub, err := NewHub(&Options{
+		AppId: "app-001",
+		ThingId: "iott-001",
+		DeviceId: "iotd-001",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+	defer hub.Close()
+	msgCh := make(chan *common.AppSdkMessageData, 10)
+	errCh := make(chan *common.AppSdkDecodeError, 10)
+	client := startClient(t, hub, &edge_app_go.Options{
+		MessageCB: func(data *common.AppSdkMessageData, arg interface{}) {
+			msgCh <- data
+		},
+		EventCB: func(data *common.AppSdkEventData, arg interface{}) {
+			if data.Type == common.EventType_DecodeError {
+				errCh <- data.Payload.(*common.AppSdkDecodeError)
+			}
+		},
+		EndpointThingIds: []string{"iott-sub"},
+	})
+	defer client.Cleanup()
+	propFilter, _ := hub.Topic(codec.TopicType_SubProperty, "", "iott-sub", "+")
+	if !assert.Nil(hub.WaitSubscribed(propFilter, waitTimeout)) {
+		return
+	}
+
+	//发布原始消息，topic和payload保持不变
+	assert.NotNil(client.PublishRaw("custom/+", 0, false, []byte("x")))
+	assert.NotNil(client.PublishRaw("custom/out", 3, false, []byte("x")))
+	assert.Nil(client.PublishRaw("custom/out", 1, true, []byte{0x00, 0xff}))
+	var published *Message
+	err = waitFor(waitTimeout, func() bool {
+		for _, msg := range hub.Published() {
+			if msg.Topic == "custom/out" {
+				published = msg
+				return true
+			}
+		}
+		return false
+	}, "wait for raw message published timeout")
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal([]byte{0x00, 0xff}, published.Payload)
+	assert.EqualValues(1, published.Qos)
+	assert.True(published.Retain)
+	assert.Equal(common.AppSdkMessageType_Unknown, published.Type)
+
+	//订阅原始消息，订阅成功后收到保留消息
+	rawCh := make(chan *rawMessage, 10)
+	handler := func(topic string, payload []byte) {
+		rawCh <- &rawMessage{topic: topic, payload: payload}
+	}
+	assert.NotNil(client.SubscribeRaw("custom/#/a", handler))
+	assert.NotNil(client.SubscribeRaw("custom/#", nil))
+	if !assert.Nil(client.SubscribeRaw("custom/#", handler)) {
+		return
+	}
+	assert.Contains(hub.broker.subscriptions(), "custom/#")
+	raw := waitRaw(t, rawCh)
+	assert.Equal("custom/out", raw.topic)
+	assert.Equal([]byte{0x00, 0xff}, raw.payload)
+
+	//原始消息不经过模型消息解码，不会上报解码失败，也不会回调MessageCB
+	hub.InjectRaw("custom/a", []byte("not a model message"), false)
+	raw = waitRaw(t, rawCh)
+	assert.Equal("custom/a", raw.topic)
+	assert.Equal([]byte("not a model message"), raw.payload)
+
+	//与模型消息重叠的原始订阅收到未解码的负载，模型消息仍然解码后回调MessageCB
+	assert.Nil(client.SubscribeRaw(propFilter, handler))
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 1}))
+	raw = waitRaw(t, rawCh)
+	assert.Equal("/sys/iott-sub/iotd-sub/thing/property/base/post", raw.topic)
+	assert.True(bytes.Contains(raw.payload, []byte(`"type":"thing.property.post"`)))
+	data := waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	assert.Equal("iotd-sub", data.DeviceId)
+	//取消原始订阅不影响模型消息的订阅
+	assert.Nil(client.UnsubscribeRaw(propFilter))
+	assert.Contains(hub.broker.subscriptions(), propFilter)
+
+	//断开连接后恢复原始消息订阅
+	hub.DisconnectClients()
+	if !assert.Nil(hub.WaitConnected(2, waitTimeout)) || !assert.Nil(hub.WaitSubscribed("custom/#", waitTimeout)) {
+		return
+	}
+	//重新订阅时再次收到保留消息
+	raw = waitRaw(t, rawCh)
+	assert.Equal("custom/out", raw.topic)
+	hub.InjectRaw("custom/b", []byte("after reconnect"), false)
+	raw = waitRaw(t, rawCh)
+	assert.Equal("custom/b", raw.topic)
+	assert.Equal([]byte("after reconnect"), raw.payload)
+
+	//取消订阅后不再收到原始消息
+	assert.Nil(client.UnsubscribeRaw("custom/#"))
+	assert.NotContains(hub.broker.subscriptions(), "custom/#")
+	hub.InjectRaw("custom/c", []byte("x"), false)
+	assert.Nil(hub.InjectProperties("iott-sub", "iotd-sub", &common.AppSdkMsgProperty{Identifier: "temp", Value: 2}))
+	waitMessage(t, msgCh, common.AppSdkMessageType_Property)
+	select {
+	case raw := <-rawCh:
+		t.Errorf("unexpected raw message of topic %s", raw.topic)
+	case decodeErr := <-errCh:
+		t.Errorf("unexpected decode error: %v", decodeErr)
+	default:
+	}
+	assert.Equal(&common.AppSdkMessageStats{Received: 2}, client.GetMessageStats())
+}
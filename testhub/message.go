@@ -0,0 +1,197 @@
+package testhub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"github.com/qingcloud-iot/edge-app-go/core/codec"
+	"strings"
+)
+
+/*
+	应用发布的消息
+*/
+type Message struct {
+	//发布消息的客户端id
+	ClientId 	string
+	//消息topic
+	Topic 		string
+	//原始消息数据
+	Payload 	[]byte
+	//消息qos
+	Qos 		byte
+	//是否为保留消息
+	Retain 		bool
+	//消息类型，不是MDMP消息时为AppSdkMessageType_Unknown
+	Type 		common.AppSdkMessageType
+	//消息的模型id
+	ThingId 	string
+	//消息的设备id
+	DeviceId 	string
+	//MDMP消息id
+	MessageId 	string
+	//MDMP消息类型，如thing.property.post
+	RawType 	string
+	//设备源
+	Source 		[]string
+	//解码后的SDK接口消息数据，格式与AppSdkMessageData.Payload相同
+	Data 		[]byte
+}
+
+//解析属性消息
+func (m *Message) Properties() ([]*common.AppSdkMsgProperty, error) {
+	props := make([]*common.AppSdkMsgProperty, 0)
+	err := m.unmarshal(common.AppSdkMessageType_Property, &props)
+	if err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+//解析事件消息
+func (m *Message) Event() (*common.AppSdkMsgEvent, error) {
+	evt := &common.AppSdkMsgEvent{}
+	err := m.unmarshal(common.AppSdkMessageType_Event, evt)
+	if err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+//解析服务调用消息
+func (m *Message) ServiceCall() (*common.AppSdkMsgServiceCall, error) {
+	call := &common.AppSdkMsgServiceCall{}
+	err := m.unmarshal(common.AppSdkMessageType_ServiceCall, call)
+	if err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+//解析服务调用回应消息
+func (m *Message) ServiceReply() (*common.AppSdkMsgServiceReply, error) {
+	reply := &common.AppSdkMsgServiceReply{}
+	err := m.unmarshal(common.AppSdkMessageType_ServiceReply, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+//解析属性设置回应消息
+func (m *Message) PropertySetReply() (*common.AppSdkMsgPropertySetReply, error) {
+	reply := &common.AppSdkMsgPropertySetReply{}
+	err := m.unmarshal(common.AppSdkMessageType_PropertySetReply, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (m *Message) unmarshal(msgType common.AppSdkMessageType, v interface{}) error {
+	if m.Type != msgType {
+		return fmt.Errorf("message type is %d, not %d", m.Type, msgType)
+	}
+	return json.Unmarshal(m.Data, v)
+}
+
+//MDMP消息头，回应消息没有type和metadata
+type mdmpHeader struct {
+	ID 			string 			`json:"id"`
+	Type 		string 			`json:"type"`
+	Code 		*int32 			`json:"code"`
+	Metadata 	*struct {
+		ModelId 	string 		`json:"modelId"`
+		EntityId 	string 		`json:"entityId"`
+		Source 		[]string 	`json:"source"`
+	} 							`json:"metadata"`
+	Data 		map[string]interface{} `json:"data"`
+}
+
+/*
+	解码应用发布的消息：根据MDMP消息类型识别消息，再按照普通模式的topic解码消息内容，
+	这样代理模式和普通模式发布的消息可以使用相同的方式解析
+*/
+func (h *Hub) decodePublished(msg *Message) error {
+	header := &mdmpHeader{}
+	err := h.codec.UnmarshalPayload(msg.Payload, header)
+	if err != nil {
+		return err
+	}
+	if header.ID == "" {
+		return errors.New("not a MDMP message")
+	}
+	msg.MessageId = header.ID
+	msg.RawType = header.Type
+	msg.ThingId, msg.DeviceId = h.opt.ThingId, h.opt.DeviceId
+	if header.Metadata != nil {
+		msg.Source = header.Metadata.Source
+		if header.Metadata.ModelId != "" && header.Metadata.EntityId != "" {
+			msg.ThingId, msg.DeviceId = header.Metadata.ModelId, header.Metadata.EntityId
+		}
+	}
+	var topicType, identifier string
+	switch {
+	case header.Type == codec.MessageTypeTemplate_Property || header.Type == codec.MessageTypeTemplate_PropertyBatch:
+		msg.Type = common.AppSdkMessageType_Property
+		topicType = codec.TopicType_SubProperty
+	case strings.HasPrefix(header.Type, "thing.event.") && strings.HasSuffix(header.Type, ".post"):
+		msg.Type = common.AppSdkMessageType_Event
+		topicType = codec.TopicType_SubEvent
+		identifier = strings.TrimSuffix(strings.TrimPrefix(header.Type, "thing.event."), ".post")
+	case strings.HasPrefix(header.Type, "thing.service.") && strings.HasSuffix(header.Type, ".call"):
+		msg.Type = common.AppSdkMessageType_ServiceCall
+		topicType = codec.TopicType_SubService
+		identifier = strings.TrimSuffix(strings.TrimPrefix(header.Type, "thing.service."), ".call")
+	case header.Type == "" && header.Code != nil:
+		return h.decodeReply(msg, header)
+	default:
+		return errors.New("unknown message type: " + header.Type)
+	}
+	if identifier == "" && topicType != codec.TopicType_SubProperty {
+		return errors.New("invalid message type: " + header.Type)
+	}
+	topic, err := h.direct.EncodeTopic(topicType, identifier, msg.ThingId, msg.DeviceId)
+	if err != nil {
+		return err
+	}
+	decoded, err := h.direct.Decode(topic, msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Data = decoded.Payload
+	return nil
+}
+
+//回应消息根据topic区分服务调用回应和属性设置回应
+func (h *Hub) decodeReply(msg *Message, header *mdmpHeader) error {
+	units := strings.Split(msg.Topic, "/")
+	switch units[len(units)-1] {
+	case "call_reply":
+		decoded, err := h.direct.Decode(msg.Topic, msg.Payload)
+		if err != nil {
+			return err
+		}
+		msg.Type = common.AppSdkMessageType_ServiceReply
+		msg.ThingId, msg.DeviceId = decoded.ThingId, decoded.DeviceId
+		msg.Data = decoded.Payload
+	case "control_reply", "set_reply":
+		reply := &common.AppSdkMsgPropertySetReply{
+			MessageId: header.ID,
+			Code: *header.Code,
+		}
+		if message, ok := header.Data["message"].(string); ok {
+			reply.Message = message
+		}
+		data, err := json.Marshal(reply)
+		if err != nil {
+			return err
+		}
+		msg.Type = common.AppSdkMessageType_PropertySetReply
+		msg.Data = data
+	default:
+		return errors.New("unknown reply topic: " + msg.Topic)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package testhub
+
+import (
+	"encoding/json"
+	"github.com/qingcloud-iot/edge-app-go/common"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+	metadata服务模拟，提供子设备列表和物模型查询接口
+*/
+type metaServer struct {
+	listener 	net.Listener
+	server 		*http.Server
+
+	lock 		sync.RWMutex
+	endpoints 	[]*common.EndpointInfo
+	models 		map[string][]byte
+}
+
+func newMetaServer() (*metaServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	m := &metaServer{
+		listener: listener,
+		endpoints: make([]*common.EndpointInfo, 0),
+		models: make(map[string][]byte),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/data/childDevice", m.handleChildDevice)
+	mux.HandleFunc("/internal/data/thingModel/", m.handleThingModel)
+	m.server = &http.Server{Handler: mux}
+	go m.server.Serve(listener)
+	return m, nil
+}
+
+func (m *metaServer) port() int {
+	return m.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (m *metaServer) close() {
+	m.server.Close()
+}
+
+//子设备列表格式与metadata服务相同：key为"/"加设备id，value为JSON字符串格式的设备信息
+func (m *metaServer) handleChildDevice(w http.ResponseWriter, r *http.Request) {
+	m.lock.RLock()
+	result := make(map[string]string)
+	for _, info := range m.endpoints {
+		data, err := json.Marshal(info)
+		if err != nil {
+			continue
+		}
+		result["/"+info.DeviceId] = string(data)
+	}
+	m.lock.RUnlock()
+	data, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (m *metaServer) handleThingModel(w http.ResponseWriter, r *http.Request) {
+	thingId := strings.TrimPrefix(r.URL.Path, "/internal/data/thingModel/")
+	m.lock.RLock()
+	data, ok := m.models[thingId]
+	m.lock.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}